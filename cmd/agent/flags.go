@@ -20,6 +20,15 @@ var flagKey string
 var flagRateLimit int
 var flagCryptoKey string
 var flagConfig string
+var flagAgentID string
+var flagGRPCAddr string
+var flagToken string
+var flagTLSCA string
+var flagTLSCert string
+var flagTLSKey string
+var flagTLSServerName string
+var flagScrapeTargets string
+var flagScrapeTimeout int
 
 type Config struct {
 	Addr           string `env:"ADDRESS" json:"addr"`
@@ -28,6 +37,15 @@ type Config struct {
 	Key            string `env:"KEY" json:"key"`
 	RateLimit      int    `env:"RATE_LIMIT" json:"rate_limit"`
 	CryptoKey      string `env:"CRYPTO_KEY" json:"crypto_key"`
+	AgentID        string `env:"AGENT_ID" json:"agent_id"`
+	GRPCAddr       string `env:"GRPC_ADDRESS" json:"grpc_addr"`
+	Token          string `env:"API_TOKEN" json:"api_token"`
+	TLSCA          string `env:"TLS_CA" json:"tls_ca"`
+	TLSCert        string `env:"TLS_CERT" json:"tls_cert"`
+	TLSKey         string `env:"TLS_KEY" json:"tls_key"`
+	TLSServerName  string `env:"TLS_SERVER_NAME" json:"tls_server_name"`
+	ScrapeTargets  string `env:"SCRAPE_TARGETS" json:"scrape_targets"`
+	ScrapeTimeout  int    `env:"SCRAPE_TIMEOUT" json:"scrape_timeout"`
 	Config         string `env:"CONFIG"`
 }
 
@@ -41,8 +59,24 @@ func parseFlags() {
 	flag.IntVar(&flagRateLimit, "l", 1, "rate limit")
 	flag.StringVar(&flagCryptoKey, "crypto-key", "./public_key.pem", "crypto key")
 	flag.StringVar(&flagConfig, "config", "", "config path")
+	flag.StringVar(&flagAgentID, "agent-id", "", "agent id label, hostname by default")
+	flag.StringVar(&flagGRPCAddr, "grpc-addr", "", "address and port metrics grpc server, http is used if empty")
+	flag.StringVar(&flagToken, "token", "", "api token sent in Authorization header")
+	flag.StringVar(&flagTLSCA, "tls-ca", "", "server CA certificate path, enables tls")
+	flag.StringVar(&flagTLSCert, "tls-cert", "", "agent certificate path for mutual tls, enables tls")
+	flag.StringVar(&flagTLSKey, "tls-key", "", "agent private key path for mutual tls")
+	flag.StringVar(&flagTLSServerName, "tls-server-name", "", "server name to verify certificate, host of address by default")
+	flag.StringVar(&flagScrapeTargets, "scrape-targets", "", "comma separated prometheus metrics urls of local apps, scraping is disabled if empty")
+	flag.IntVar(&flagScrapeTimeout, "scrape-timeout", 5, "prometheus metrics scrape timeout")
 	flag.Parse()
 
+	// set - параметры, заданные явно флагами или переменными окружения: значения из файла конфигурации
+	// применяются только к остальным, иначе их заменяли бы значения флагов по умолчанию
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
 	var cfg Config
 	if err := godotenv.Load(); err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
@@ -56,24 +90,67 @@ func parseFlags() {
 
 	if cfg.Addr != "" {
 		flagAddr = cfg.Addr
+		set["a"] = true
 	}
 	if cfg.ReportInterval != 0 {
 		flagReportInterval = cfg.ReportInterval
+		set["r"] = true
 	}
 	if cfg.PollInterval != 0 {
 		flagPollInterval = cfg.PollInterval
+		set["p"] = true
 	}
 	if cfg.Key != "" {
 		flagKey = cfg.Key
+		set["k"] = true
 	}
 	if cfg.RateLimit != 0 {
 		flagRateLimit = cfg.RateLimit
+		set["l"] = true
 		if flagRateLimit < 1 {
 			flagRateLimit = 1
 		}
 	}
 	if cfg.CryptoKey != "" {
 		flagCryptoKey = cfg.CryptoKey
+		set["crypto-key"] = true
+	}
+
+	if cfg.AgentID != "" {
+		flagAgentID = cfg.AgentID
+		set["agent-id"] = true
+	}
+	if cfg.GRPCAddr != "" {
+		flagGRPCAddr = cfg.GRPCAddr
+		set["grpc-addr"] = true
+	}
+	if cfg.Token != "" {
+		flagToken = cfg.Token
+		set["token"] = true
+	}
+	if cfg.TLSCA != "" {
+		flagTLSCA = cfg.TLSCA
+		set["tls-ca"] = true
+	}
+	if cfg.TLSCert != "" {
+		flagTLSCert = cfg.TLSCert
+		set["tls-cert"] = true
+	}
+	if cfg.TLSKey != "" {
+		flagTLSKey = cfg.TLSKey
+		set["tls-key"] = true
+	}
+	if cfg.TLSServerName != "" {
+		flagTLSServerName = cfg.TLSServerName
+		set["tls-server-name"] = true
+	}
+	if cfg.ScrapeTargets != "" {
+		flagScrapeTargets = cfg.ScrapeTargets
+		set["scrape-targets"] = true
+	}
+	if cfg.ScrapeTimeout != 0 {
+		flagScrapeTimeout = cfg.ScrapeTimeout
+		set["scrape-timeout"] = true
 	}
 
 	if cfg.Config != "" {
@@ -95,23 +172,50 @@ func parseFlags() {
 			l.Fatal().Err(err)
 		}
 
-		if flagAddr == "" && jsonConfig.Addr != "" {
+		if !set["a"] && jsonConfig.Addr != "" {
 			flagAddr = jsonConfig.Addr
 		}
-		if flagReportInterval == 0 && jsonConfig.ReportInterval != 0 {
+		if !set["r"] && jsonConfig.ReportInterval != 0 {
 			flagReportInterval = jsonConfig.ReportInterval
 		}
-		if flagPollInterval == 0 && jsonConfig.PollInterval != 0 {
+		if !set["p"] && jsonConfig.PollInterval != 0 {
 			flagPollInterval = jsonConfig.PollInterval
 		}
-		if flagKey == "" && jsonConfig.Key != "" {
+		if !set["k"] && jsonConfig.Key != "" {
 			flagKey = jsonConfig.Key
 		}
-		if flagRateLimit == 0 && jsonConfig.RateLimit != 0 {
+		if !set["l"] && jsonConfig.RateLimit != 0 {
 			flagRateLimit = jsonConfig.RateLimit
 		}
-		if flagCryptoKey == "" && jsonConfig.CryptoKey != "" {
+		if !set["crypto-key"] && jsonConfig.CryptoKey != "" {
 			flagCryptoKey = jsonConfig.CryptoKey
 		}
+		if !set["agent-id"] && jsonConfig.AgentID != "" {
+			flagAgentID = jsonConfig.AgentID
+		}
+		if !set["grpc-addr"] && jsonConfig.GRPCAddr != "" {
+			flagGRPCAddr = jsonConfig.GRPCAddr
+		}
+		if !set["token"] && jsonConfig.Token != "" {
+			flagToken = jsonConfig.Token
+		}
+		if !set["tls-ca"] && jsonConfig.TLSCA != "" {
+			flagTLSCA = jsonConfig.TLSCA
+		}
+		if !set["tls-cert"] && jsonConfig.TLSCert != "" {
+			flagTLSCert = jsonConfig.TLSCert
+		}
+		if !set["tls-key"] && jsonConfig.TLSKey != "" {
+			flagTLSKey = jsonConfig.TLSKey
+		}
+		if !set["tls-server-name"] && jsonConfig.TLSServerName != "" {
+			flagTLSServerName = jsonConfig.TLSServerName
+		}
+		if !set["scrape-targets"] && jsonConfig.ScrapeTargets != "" {
+			flagScrapeTargets = jsonConfig.ScrapeTargets
+		}
+		if !set["scrape-timeout"] && jsonConfig.ScrapeTimeout != 0 {
+			flagScrapeTimeout = jsonConfig.ScrapeTimeout
+		}
 	}
 }
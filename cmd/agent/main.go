@@ -2,15 +2,19 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
 	"github.com/soltanat/metrics/internal/model"
 	"github.com/soltanat/metrics/internal/poller"
@@ -19,6 +23,7 @@ import (
 	"github.com/soltanat/metrics/internal/client"
 	"github.com/soltanat/metrics/internal/logger"
 	"github.com/soltanat/metrics/internal/reporter"
+	"github.com/soltanat/metrics/internal/tlsconfig"
 )
 
 var (
@@ -95,10 +100,72 @@ func main() {
 	goPSUtilPollerInst := poller.NewGoPSUtilPoller()
 
 	pollers := []internal.Poll{runtimePollerInst, goPSUtilPollerInst}
+	if flagScrapeTargets != "" {
+		targets := strings.Split(flagScrapeTargets, ",")
+		for i := range targets {
+			targets[i] = strings.TrimSpace(targets[i])
+		}
+		scrapePollerInst := poller.NewPrometheusScrapePoller(targets, time.Second*time.Duration(flagScrapeTimeout))
+		pollers = append(pollers, scrapePollerInst)
+	}
 
-	addr := fmt.Sprintf("http://%s", flagAddr)
+	hostname, err := os.Hostname()
+	if err != nil {
+		l.Error().Err(err).Msg("unable to get hostname")
+		return
+	}
+	if flagAgentID == "" {
+		flagAgentID = hostname
+	}
+	labels := model.Labels{
+		"host":     hostname,
+		"agent_id": flagAgentID,
+	}
+
+	var reporterInst internal.Reporter
+	if flagGRPCAddr != "" {
+		grpcCli, err := newGRPCClient()
+		if err != nil {
+			l.Error().Err(err).Msg("unable to create grpc client")
+			return
+		}
+		defer grpcCli.Close()
+		reporterInst = reporter.NewStream(grpcCli, labels)
+	} else {
+		httpCli, err := newHTTPClient()
+		if err != nil {
+			l.Error().Err(err).Msg("unable to create http client")
+			return
+		}
+		reporterInst = reporter.New(httpCli, make(chan struct{}, flagRateLimit), labels)
+	}
+
+	Run(
+		context.Background(),
+		time.Second*time.Duration(flagPollInterval),
+		time.Second*time.Duration(flagReportInterval),
+		pollers,
+		reporterInst,
+	)
+}
 
-	transport := http.DefaultTransport
+// newHTTPClient
+// Создает http клиент с сжатием, подписью, передачей адреса и токена агента и шифрованием запросов
+// При заданных флагах -tls-* запросы отправляются по https
+func newHTTPClient() (*client.Client, error) {
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	addr := fmt.Sprintf("http://%s", flagAddr)
+	var transport http.RoundTripper = http.DefaultTransport
+	if tlsConfig != nil {
+		addr = fmt.Sprintf("https://%s", flagAddr)
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = tlsConfig
+		transport = t
+	}
 
 	transport = &client.GzipTransport{Transport: transport}
 
@@ -107,30 +174,71 @@ func main() {
 	}
 	transport = &client.LoggingTransport{Transport: transport}
 
+	ip, err := client.OutboundIP(flagAddr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get outbound ip: %w", err)
+	}
+	transport = &client.RealIPTransport{Transport: transport, IP: ip}
+	if flagToken != "" {
+		transport = &client.BearerTransport{Transport: transport, Token: flagToken}
+	}
+
 	if flagCryptoKey != "" {
 		key, err := os.ReadFile(flagCryptoKey)
 		if err != nil {
-			l.Error().Msg("unable to read crypto key")
-			return
+			return nil, fmt.Errorf("unable to read crypto key: %w", err)
 		}
 
 		transport, err = client.NewRSAEncryptionTransport(transport, key)
 		if err != nil {
-			l.Error().Err(err).Msg("unable to create crypto transport")
-			return
+			return nil, fmt.Errorf("unable to create crypto transport: %w", err)
 		}
 	}
 
-	cli := client.New(addr, transport)
+	return client.New(addr, transport), nil
+}
 
-	reporterInst := reporter.New(cli, make(chan struct{}, flagRateLimit))
-	Run(
-		context.Background(),
-		time.Second*time.Duration(flagPollInterval),
-		time.Second*time.Duration(flagReportInterval),
-		pollers,
-		reporterInst,
+// newGRPCClient
+// Создает gRPC клиент с передачей адреса и токена агента и подписью запросов и пакетов потока
+// При заданных флагах -tls-* соединение устанавливается по TLS
+func newGRPCClient() (*client.GRPCClient, error) {
+	tlsConfig, err := newTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	var opts []grpc.DialOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	ip, err := client.OutboundIP(flagGRPCAddr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get outbound ip: %w", err)
+	}
+	interceptors := []grpc.UnaryClientInterceptor{client.RealIPInterceptor(ip)}
+	streamInterceptors := []grpc.StreamClientInterceptor{client.RealIPStreamInterceptor(ip)}
+	if flagToken != "" {
+		interceptors = append(interceptors, client.BearerInterceptor(flagToken))
+		streamInterceptors = append(streamInterceptors, client.BearerStreamInterceptor(flagToken))
+	}
+	if flagKey != "" {
+		interceptors = append(interceptors, client.SignatureInterceptor(flagKey))
+		streamInterceptors = append(streamInterceptors, client.SignatureStreamInterceptor(flagKey))
+	}
+	opts = append(opts,
+		grpc.WithChainUnaryInterceptor(interceptors...),
+		grpc.WithChainStreamInterceptor(streamInterceptors...),
 	)
+	return client.NewGRPC(flagGRPCAddr, opts...)
+}
+
+// newTLSConfig
+// Создает конфигурацию TLS по флагам -tls-*, возвращает nil, если TLS не включен
+func newTLSConfig() (*tls.Config, error) {
+	if flagTLSCA == "" && flagTLSCert == "" {
+		return nil, nil
+	}
+	return tlsconfig.Client(flagTLSCA, flagTLSCert, flagTLSKey, flagTLSServerName)
 }
 
 func merge(cs ...chan *model.Metric) chan *model.Metric {
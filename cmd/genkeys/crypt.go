@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/soltanat/metrics/internal/envelope"
+)
+
+// runEncrypt
+// Подкоманда encrypt: шифрует тело так же, как client.RSAEncryptionTransport
+// Значения заголовков X-Encrypted-Key и X-Key-ID выводятся в stdout, шифротекст записывается в файл -out
+func runEncrypt(args []string) error {
+	fs := flag.NewFlagSet("encrypt", flag.ContinueOnError)
+	keyPath := fs.String("key", "./public_key.pem", "RSA public key")
+	in := fs.String("in", "-", "plain body file, - for stdin")
+	out := fs.String("out", "", "encrypted body output file")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *out == "" {
+		fmt.Fprintf(os.Stderr, "-out is required\n")
+		fs.Usage()
+		return errUsage
+	}
+
+	keyData, err := os.ReadFile(*keyPath)
+	if err != nil {
+		return err
+	}
+	pub, err := envelope.ParsePublicKey(keyData)
+	if err != nil {
+		return err
+	}
+	body, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+
+	encryptedKey, cipherText, err := envelope.Seal(pub, body)
+	if err != nil {
+		return err
+	}
+	if err := writeOutput(*out, cipherText); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %s\n", envelope.KeyHeader, encryptedKey)
+	fmt.Printf("%s: %s\n", envelope.KeyIDHeader, envelope.KeyID(pub))
+	return nil
+}
+
+// runDecrypt
+// Подкоманда decrypt: расшифровывает перехваченное тело запроса агента
+// Ключ выбирается по -key-id из файла или каталога ключей -key, без -key-id перебираются все ключи
+// Тело, сжатое gzip после шифрования, распаковывается
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ContinueOnError)
+	keyPath := fs.String("key", "./private_key.pem", "RSA private key or directory with private keys")
+	header := fs.String("header", "", "X-Encrypted-Key header value")
+	keyID := fs.String("key-id", "", "X-Key-ID header value")
+	in := fs.String("in", "-", "encrypted body file, - for stdin")
+	out := fs.String("out", "-", "plain body output file, - for stdout")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *header == "" {
+		fmt.Fprintf(os.Stderr, "-header is required\n")
+		fs.Usage()
+		return errUsage
+	}
+
+	keys := envelope.NewKeyRing()
+	if err := keys.Load(*keyPath); err != nil {
+		return err
+	}
+	body, err := readInput(*in)
+	if err != nil {
+		return err
+	}
+	body = gunzip(body)
+
+	plain, err := keys.Open(*keyID, *header, body)
+	if err != nil {
+		return err
+	}
+	return writeOutput(*out, plain)
+}
+
+// gunzip
+// Распаковывает данные, если они сжаты gzip, иначе возвращает как есть
+func gunzip(data []byte) []byte {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return data
+	}
+	defer zr.Close()
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		return data
+	}
+	return plain
+}
+
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/envelope"
+)
+
+func TestRunEncryptDecrypt(t *testing.T) {
+	dir := t.TempDir()
+	keysDir := filepath.Join(dir, "keys")
+	require.NoError(t, os.Mkdir(keysDir, 0o700))
+	privatePath := filepath.Join(keysDir, "private.pem")
+	publicPath := filepath.Join(dir, "public.pem")
+	require.NoError(t, generate(algRSA2048, privatePath, publicPath, false))
+	// второй ключ в каталоге, чтобы ключ выбирался по идентификатору
+	require.NoError(t, generate(algRSA2048, filepath.Join(keysDir, "old.pem"), filepath.Join(dir, "old.pub.pem"), false))
+
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1.5}]`)
+	bodyPath := filepath.Join(dir, "body.json")
+	require.NoError(t, os.WriteFile(bodyPath, body, 0o600))
+
+	encryptedPath := filepath.Join(dir, "body.bin")
+	out, err := captureStdout(t, func() error {
+		return runEncrypt([]string{"-key", publicPath, "-in", bodyPath, "-out", encryptedPath})
+	})
+	require.NoError(t, err)
+	headers := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		name, value, ok := strings.Cut(line, ": ")
+		require.True(t, ok, line)
+		headers[name] = value
+	}
+	require.NotEmpty(t, headers[envelope.KeyHeader])
+
+	publicPEM, err := os.ReadFile(publicPath)
+	require.NoError(t, err)
+	pub, err := envelope.ParsePublicKey(publicPEM)
+	require.NoError(t, err)
+	assert.Equal(t, envelope.KeyID(pub), headers[envelope.KeyIDHeader])
+
+	cipherText, err := os.ReadFile(encryptedPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(cipherText), "Alloc")
+
+	// агент сжимает тело gzip после шифрования
+	var gzipped bytes.Buffer
+	zw := gzip.NewWriter(&gzipped)
+	_, err = zw.Write(cipherText)
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	gzippedPath := filepath.Join(dir, "body.bin.gz")
+	require.NoError(t, os.WriteFile(gzippedPath, gzipped.Bytes(), 0o600))
+
+	tests := []struct {
+		name    string
+		key     string
+		keyID   string
+		in      string
+		header  string
+		wantErr bool
+	}{
+		{name: "key file", key: privatePath, in: encryptedPath, header: headers[envelope.KeyHeader]},
+		{name: "gzipped body", key: privatePath, in: gzippedPath, header: headers[envelope.KeyHeader]},
+		{name: "keys dir with key id", key: keysDir, keyID: headers[envelope.KeyIDHeader], in: gzippedPath, header: headers[envelope.KeyHeader]},
+		{name: "keys dir without key id", key: keysDir, in: encryptedPath, header: headers[envelope.KeyHeader]},
+		{name: "unknown key id", key: keysDir, keyID: "unknown", in: encryptedPath, header: headers[envelope.KeyHeader], wantErr: true},
+		{name: "wrong key", key: filepath.Join(keysDir, "old.pem"), in: encryptedPath, header: headers[envelope.KeyHeader], wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plainPath := filepath.Join(t.TempDir(), "plain.json")
+			args := []string{"-key", tt.key, "-header", tt.header, "-in", tt.in, "-out", plainPath}
+			if tt.keyID != "" {
+				args = append(args, "-key-id", tt.keyID)
+			}
+			err := runDecrypt(args)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			plain, err := os.ReadFile(plainPath)
+			require.NoError(t, err)
+			assert.Equal(t, body, plain)
+		})
+	}
+
+	assert.ErrorIs(t, runDecrypt([]string{"-key", privatePath, "-in", encryptedPath}), errUsage)
+}
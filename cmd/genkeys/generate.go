@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/soltanat/metrics/internal/envelope"
+)
+
+const (
+	algRSA2048 = "rsa2048"
+	algRSA4096 = "rsa4096"
+	algRSA8192 = "rsa8192"
+	algEd25519 = "ed25519"
+)
+
+// rsaBits
+// Размеры ключей RSA по алгоритмам
+var rsaBits = map[string]int{
+	algRSA2048: 2048,
+	algRSA4096: 4096,
+	algRSA8192: 8192,
+}
+
+func algorithms() []string {
+	algs := []string{algEd25519}
+	for alg := range rsaBits {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// runGenerate
+// Подкоманда generate: генерирует пару ключей
+// Ключи RSA предназначены для шифрования тела запросов (PKCS#1), ключи Ed25519 - для подписи (PKCS#8 и PKIX)
+func runGenerate(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	alg := fs.String("alg", algRSA4096, "key algorithm: "+strings.Join(algorithms(), ", "))
+	privatePath := fs.String("private", "./private_key.pem", "private key output path")
+	publicPath := fs.String("public", "./public_key.pem", "public key output path")
+	force := fs.Bool("force", false, "overwrite existing files")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := generate(*alg, *privatePath, *publicPath, *force); err != nil {
+		return err
+	}
+	log.Printf("%s keys generated successfully.", *alg)
+	return nil
+}
+
+// generate
+// Генерирует пару ключей алгоритма alg и записывает их в privatePath и publicPath
+// Существующие файлы перезаписываются только с force
+func generate(alg, privatePath, publicPath string, force bool) error {
+	if !force {
+		if err := checkNotExist(privatePath, publicPath); err != nil {
+			return err
+		}
+	}
+
+	privatePEM, publicPEM, err := generateKeys(alg)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(privatePath, privatePEM, 0o600, force); err != nil {
+		return err
+	}
+	return writeFile(publicPath, publicPEM, 0o644, force)
+}
+
+// generateKeys
+// Возвращает закрытый и открытый ключи алгоритма alg в формате PEM
+func generateKeys(alg string) ([]byte, []byte, error) {
+	if alg == algEd25519 {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		privateDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		publicDER, err := x509.MarshalPKIXPublicKey(publicKey)
+		if err != nil {
+			return nil, nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}),
+			pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), nil
+	}
+
+	bits, ok := rsaBits[alg]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown algorithm %q, expected one of %s", alg, strings.Join(algorithms(), ", "))
+	}
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("key id: %s", envelope.KeyID(&privateKey.PublicKey))
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}),
+		pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&privateKey.PublicKey)}), nil
+}
+
+// checkNotExist
+// Проверяет, что файлов paths нет, чтобы не перезаписать их без -force
+func checkNotExist(paths ...string) error {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists, use -force to overwrite", path)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile
+// Записывает файл, без force отказывается перезаписывать существующий
+func writeFile(path string, data []byte, perm os.FileMode, force bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
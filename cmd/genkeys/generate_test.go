@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/envelope"
+)
+
+// captureStdout
+// Возвращает вывод fn в stdout
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- data
+	}()
+	err = fn()
+	require.NoError(t, w.Close())
+	return string(<-out), err
+}
+
+func TestRunGenerate(t *testing.T) {
+	tests := []struct {
+		name    string
+		alg     string
+		exists  bool
+		force   bool
+		wantErr string
+		check   func(t *testing.T, privatePEM, publicPEM []byte)
+	}{
+		{
+			name: "rsa",
+			alg:  algRSA2048,
+			check: func(t *testing.T, privatePEM, publicPEM []byte) {
+				priv, err := envelope.ParsePrivateKey(privatePEM)
+				require.NoError(t, err)
+				pub, err := envelope.ParsePublicKey(publicPEM)
+				require.NoError(t, err)
+				assert.Equal(t, 2048, pub.N.BitLen())
+				assert.True(t, priv.PublicKey.Equal(pub))
+			},
+		},
+		{
+			name: "ed25519",
+			alg:  algEd25519,
+			check: func(t *testing.T, privatePEM, publicPEM []byte) {
+				block, _ := pem.Decode(privatePEM)
+				require.NotNil(t, block)
+				assert.Equal(t, "PRIVATE KEY", block.Type)
+				priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+				require.NoError(t, err)
+				require.IsType(t, ed25519.PrivateKey{}, priv)
+
+				block, _ = pem.Decode(publicPEM)
+				require.NotNil(t, block)
+				assert.Equal(t, "PUBLIC KEY", block.Type)
+				pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+				require.NoError(t, err)
+				assert.Equal(t, priv.(ed25519.PrivateKey).Public(), pub)
+			},
+		},
+		{
+			name:    "refuse to overwrite",
+			alg:     algEd25519,
+			exists:  true,
+			wantErr: "already exists, use -force to overwrite",
+		},
+		{
+			name:   "overwrite with force",
+			alg:    algEd25519,
+			exists: true,
+			force:  true,
+			check: func(t *testing.T, privatePEM, publicPEM []byte) {
+				assert.NotEqual(t, "old", string(privatePEM))
+				assert.NotEqual(t, "old", string(publicPEM))
+			},
+		},
+		{
+			name:    "unknown algorithm",
+			alg:     "dsa",
+			wantErr: "unknown algorithm",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			privatePath := filepath.Join(dir, "private.pem")
+			publicPath := filepath.Join(dir, "public.pem")
+			if tt.exists {
+				require.NoError(t, os.WriteFile(privatePath, []byte("old"), 0o600))
+				require.NoError(t, os.WriteFile(publicPath, []byte("old"), 0o600))
+			}
+
+			args := []string{"-alg", tt.alg, "-private", privatePath, "-public", publicPath}
+			if tt.force {
+				args = append(args, "-force")
+			}
+			err := runGenerate(args)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				if tt.exists {
+					data, err := os.ReadFile(privatePath)
+					require.NoError(t, err)
+					assert.Equal(t, "old", string(data))
+				}
+				return
+			}
+			require.NoError(t, err)
+
+			privatePEM, err := os.ReadFile(privatePath)
+			require.NoError(t, err)
+			publicPEM, err := os.ReadFile(publicPath)
+			require.NoError(t, err)
+			info, err := os.Stat(privatePath)
+			require.NoError(t, err)
+			if !tt.exists {
+				assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+			}
+			tt.check(t, privatePEM, publicPEM)
+		})
+	}
+}
+
+func TestGenerateTLS(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, generateTLS(dir, "localhost", "agent", time.Hour, false))
+	for _, name := range tlsNames {
+		assert.FileExists(t, filepath.Join(dir, name+".pem"))
+		assert.FileExists(t, filepath.Join(dir, name+"-key.pem"))
+	}
+	caKey, err := os.ReadFile(filepath.Join(dir, "ca-key.pem"))
+	require.NoError(t, err)
+
+	// без -force ключ CA не перезаписывается
+	err = runTLS([]string{"-dir", dir})
+	assert.ErrorContains(t, err, "already exists, use -force to overwrite")
+	data, err := os.ReadFile(filepath.Join(dir, "ca-key.pem"))
+	require.NoError(t, err)
+	assert.Equal(t, caKey, data)
+
+	require.NoError(t, runTLS([]string{"-dir", dir, "-force"}))
+	data, err = os.ReadFile(filepath.Join(dir, "ca-key.pem"))
+	require.NoError(t, err)
+	assert.NotEqual(t, caKey, data)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/soltanat/metrics/internal/envelope"
+)
+
+// runInspect
+// Подкоманда inspect: выводит алгоритм, отпечаток и идентификатор ключа для каждого файла
+// Идентификатор ключа RSA совпадает со значением заголовка X-Key-ID, которое передает агент
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: genkeys inspect key.pem...\n")
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	for _, path := range fs.Args() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		kind, pub, err := parsePEMPublicKey(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fingerprint, err := fingerprint(pub)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		fmt.Printf("%s\n", path)
+		fmt.Printf("  type:        %s\n", kind)
+		fmt.Printf("  algorithm:   %s\n", algorithm(pub))
+		fmt.Printf("  fingerprint: SHA256:%s\n", fingerprint)
+		if rsaKey, ok := pub.(*rsa.PublicKey); ok {
+			fmt.Printf("  key id:      %s\n", envelope.KeyID(rsaKey))
+		}
+	}
+	return nil
+}
+
+// parsePEMPublicKey
+// Возвращает тип PEM блока и открытый ключ из закрытого ключа, открытого ключа или сертификата
+func parsePEMPublicKey(data []byte) (string, crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", nil, fmt.Errorf("no PEM data found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return "", nil, err
+		}
+		return "private key", key.Public(), nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		return "public key", key, err
+	case "EC PRIVATE KEY":
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		if err != nil {
+			return "", nil, err
+		}
+		return "private key", key.Public(), nil
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return "", nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported private key %T", key)
+		}
+		return "private key", signer.Public(), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		return "public key", key, err
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("certificate %q", cert.Subject.CommonName), cert.PublicKey, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// fingerprint
+// Возвращает SHA-256 от открытого ключа в формате PKIX DER в hex
+func fingerprint(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func algorithm(pub crypto.PublicKey) string {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", key.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("%T", pub)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/envelope"
+)
+
+func TestRunInspect(t *testing.T) {
+	dir := t.TempDir()
+	rsaPrivate := filepath.Join(dir, "rsa.pem")
+	rsaPublic := filepath.Join(dir, "rsa.pub.pem")
+	require.NoError(t, generate(algRSA2048, rsaPrivate, rsaPublic, false))
+	edPrivate := filepath.Join(dir, "ed.pem")
+	edPublic := filepath.Join(dir, "ed.pub.pem")
+	require.NoError(t, generate(algEd25519, edPrivate, edPublic, false))
+	require.NoError(t, generateTLS(dir, "localhost", "agent", time.Hour, false))
+	garbage := filepath.Join(dir, "garbage.pem")
+	require.NoError(t, os.WriteFile(garbage, []byte("not a key"), 0o600))
+
+	publicPEM, err := os.ReadFile(rsaPublic)
+	require.NoError(t, err)
+	pub, err := envelope.ParsePublicKey(publicPEM)
+	require.NoError(t, err)
+	keyID := envelope.KeyID(pub)
+
+	tests := []struct {
+		name    string
+		path    string
+		want    []string
+		notWant string
+		wantErr string
+	}{
+		{
+			name: "rsa private key",
+			path: rsaPrivate,
+			want: []string{"type:        private key", "algorithm:   RSA-2048", "key id:      " + keyID},
+		},
+		{
+			name: "rsa public key",
+			path: rsaPublic,
+			want: []string{"type:        public key", "key id:      " + keyID},
+		},
+		{
+			name:    "ed25519 private key",
+			path:    edPrivate,
+			want:    []string{"type:        private key", "algorithm:   Ed25519", "fingerprint: SHA256:"},
+			notWant: "key id:",
+		},
+		{
+			name: "ed25519 public key",
+			path: edPublic,
+			want: []string{"type:        public key", "algorithm:   Ed25519"},
+		},
+		{
+			name: "certificate",
+			path: filepath.Join(dir, "server.pem"),
+			want: []string{`type:        certificate "metrics server"`},
+		},
+		{
+			name:    "not a pem file",
+			path:    garbage,
+			wantErr: "no PEM data found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := captureStdout(t, func() error { return runInspect([]string{tt.path}) })
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			for _, want := range tt.want {
+				assert.Contains(t, out, want)
+			}
+			if tt.notWant != "" {
+				assert.NotContains(t, out, tt.notWant)
+			}
+		})
+	}
+
+	// отпечаток закрытого и открытого ключа одной пары совпадает
+	privateOut, err := captureStdout(t, func() error { return runInspect([]string{edPrivate}) })
+	require.NoError(t, err)
+	publicOut, err := captureStdout(t, func() error { return runInspect([]string{edPublic}) })
+	require.NoError(t, err)
+	assert.Equal(t, fingerprintLine(privateOut), fingerprintLine(publicOut))
+}
+
+func fingerprintLine(out string) string {
+	for _, line := range strings.Split(out, "\n") {
+		if strings.Contains(line, "fingerprint:") {
+			return line
+		}
+	}
+	return ""
+}
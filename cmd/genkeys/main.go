@@ -1,62 +1,108 @@
+// genkeys
+// Утилита управления ключами:
+//
+//	genkeys generate [-alg rsa4096] [-private private_key.pem] [-public public_key.pem] [-force]
+//	genkeys inspect key.pem...
+//	genkeys encrypt -key public_key.pem [-in body.json] -out body.bin
+//	genkeys decrypt -key private_key.pem|keys_dir -header X-Encrypted-Key [-key-id X-Key-ID] [-in body.bin] [-out body.json]
+//	genkeys tls -dir certs [-hosts localhost,127.0.0.1] [-client-cn agent] [-days 365] [-force]
+//
+// Без подкоманды поддерживаются прежние флаги: генерируется пара RSA-8192 в ./private_key.pem и ./public_key.pem,
+// а с флагом -tls-dir выпускаются сертификаты
 package main
 
 import (
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
-func generateRSAKeys() ([]byte, []byte, error) {
-	privateKey, err := rsa.GenerateKey(rand.Reader, 8192)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	privateKeyPEM := &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(privateKey),
-	}
-	privateKeyBytes := pem.EncodeToMemory(privateKeyPEM)
+// errUsage
+// Ошибка разбора аргументов, описание флагов уже выведено
+var errUsage = errors.New("invalid usage")
 
-	publicKey := &privateKey.PublicKey
-	publicKeyBytes := x509.MarshalPKCS1PublicKey(publicKey)
-	publicKeyPEM := &pem.Block{
-		Type:  "RSA PUBLIC KEY",
-		Bytes: publicKeyBytes,
-	}
-	publicKeyBytes = pem.EncodeToMemory(publicKeyPEM)
+// commands
+// Подкоманды утилиты
+var commands = map[string]func(args []string) error{
+	"generate": runGenerate,
+	"inspect":  runInspect,
+	"encrypt":  runEncrypt,
+	"decrypt":  runDecrypt,
+	"tls":      runTLS,
+}
 
-	return privateKeyBytes, publicKeyBytes, nil
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: genkeys <generate|inspect|encrypt|decrypt|tls> [flags]\n")
+	fmt.Fprintf(os.Stderr, "run genkeys <command> -h for command flags\n")
 }
 
 func main() {
-	privateKeyBytes, publicKeyBytes, err := generateRSAKeys()
-	if err != nil {
-		log.Fatal(err)
+	log.SetFlags(0)
+
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		runLegacy(os.Args[1:])
+		return
 	}
 
-	privateKeyFile, err := os.Create("./private_key.pem")
-	if err != nil {
-		log.Fatal(err)
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	err := cmd(os.Args[2:])
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
 	}
-	defer privateKeyFile.Close()
-	_, err = privateKeyFile.Write(privateKeyBytes)
 	if err != nil {
 		log.Fatal(err)
 	}
+}
 
-	publicKeyFile, err := os.Create("./public_key.pem")
-	if err != nil {
-		log.Fatal(err)
+// runLegacy
+// Запуск без подкоманды с прежними флагами
+func runLegacy(args []string) {
+	fs := flag.NewFlagSet("genkeys", flag.ExitOnError)
+	tlsDir := fs.String("tls-dir", "", "directory to write local CA, server and client certificates, RSA keys are generated if empty")
+	tlsHosts := fs.String("tls-hosts", "localhost,127.0.0.1", "comma separated server certificate hosts")
+	tlsClientCN := fs.String("tls-client-cn", "agent", "client certificate common name")
+	tlsDays := fs.Int("tls-days", 365, "certificates validity in days")
+	fs.Usage = func() {
+		usage()
+		fmt.Fprintf(os.Stderr, "\nwithout command:\n")
+		fs.PrintDefaults()
 	}
-	defer publicKeyFile.Close()
-	_, err = publicKeyFile.Write(publicKeyBytes)
+	_ = fs.Parse(args)
+
+	if *tlsDir != "" {
+		err := generateTLS(*tlsDir, *tlsHosts, *tlsClientCN, time.Duration(*tlsDays)*24*time.Hour, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Println("TLS certificates generated successfully.")
+		return
+	}
+
+	err := generate(algRSA8192, "./private_key.pem", "./public_key.pem", false)
 	if err != nil {
 		log.Fatal(err)
 	}
-
 	log.Println("RSA keys generated successfully.")
 }
+
+// parseFlags
+// Разбирает флаги подкоманды, ошибки разбора выводятся флагами и возвращаются как errUsage
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	fs.SetOutput(os.Stderr)
+	err := fs.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return err
+	}
+	if err != nil {
+		return errUsage
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/soltanat/metrics/internal/tlsconfig"
+)
+
+// tlsNames
+// Имена сертификатов, выпускаемых generateTLS
+var tlsNames = []string{"ca", "server", "client"}
+
+// generateTLS
+// Выпускает локальный CA, сертификат сервера и сертификат агента для тестовых установок с TLS и взаимным TLS
+// Файлы ca.pem, ca-key.pem, server.pem, server-key.pem, client.pem, client-key.pem записываются в каталог dir
+// Существующие файлы перезаписываются только с force
+func generateTLS(dir, hosts, clientCN string, validFor time.Duration, force bool) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	if !force {
+		var paths []string
+		for _, name := range tlsNames {
+			paths = append(paths, filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem"))
+		}
+		if err := checkNotExist(paths...); err != nil {
+			return err
+		}
+	}
+
+	ca, err := tlsconfig.NewCA("metrics local CA", validFor)
+	if err != nil {
+		return fmt.Errorf("unable to create CA: %w", err)
+	}
+	server, err := ca.Issue("metrics server", strings.Split(hosts, ","), tlsconfig.UsageServer, validFor)
+	if err != nil {
+		return fmt.Errorf("unable to issue server certificate: %w", err)
+	}
+	client, err := ca.Issue(clientCN, nil, tlsconfig.UsageClient, validFor)
+	if err != nil {
+		return fmt.Errorf("unable to issue client certificate: %w", err)
+	}
+
+	for name, cert := range map[string]*tlsconfig.Certificate{"ca": ca, "server": server, "client": client} {
+		if err := writeCertificate(dir, name, cert, force); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeCertificate(dir, name string, cert *tlsconfig.Certificate, force bool) error {
+	keyPEM, err := cert.KeyPEM()
+	if err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(dir, name+".pem"), cert.CertPEM(), 0o644, force); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, name+"-key.pem"), keyPEM, 0o600, force)
+}
+
+// runTLS
+// Подкоманда tls: выпускает локальный CA, сертификат сервера и сертификат агента (см. generateTLS)
+func runTLS(args []string) error {
+	fs := flag.NewFlagSet("tls", flag.ContinueOnError)
+	dir := fs.String("dir", "./certs", "directory to write local CA, server and client certificates")
+	hosts := fs.String("hosts", "localhost,127.0.0.1", "comma separated server certificate hosts")
+	clientCN := fs.String("client-cn", "agent", "client certificate common name")
+	days := fs.Int("days", 365, "certificates validity in days")
+	force := fs.Bool("force", false, "overwrite existing files")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if err := generateTLS(*dir, *hosts, *clientCN, time.Duration(*days)*24*time.Hour, *force); err != nil {
+		return err
+	}
+	log.Println("TLS certificates generated successfully.")
+	return nil
+}
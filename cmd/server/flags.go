@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/caarlos0/env/v6"
 	"github.com/joho/godotenv"
@@ -19,18 +22,68 @@ var flagPath string
 var flagRestore bool
 var flagDBAddr string
 var flagKey string
+var flagSignatureStrict bool
+var flagSignatureMaxSkew int
 var flagCryptoKey string
+var flagCryptoPolicy string
+var flagCryptoKeys string
 var flagConfig string
+var flagQuantiles string
+var flagRetention string
+var flagRetentionInterval int
+var flagAlertRules string
+var flagAlertWebhook string
+var flagAlertInterval int
+var flagGRPCAddr string
+var flagStatsDAddr string
+var flagStatsDInterval int
+var flagGraphiteAddr string
+var flagGraphiteTemplates string
+var flagOTLPPrefixAttribute string
+var flagTrustedSubnet string
+var flagAuth string
+var flagTLSCert string
+var flagTLSKey string
+var flagTLSClientCA string
+var flagTLSClientAuth string
+var flagTLSAllowedClients string
+var flagAuthKeys string
+var flagAuthBootstrapToken string
 
 type Config struct {
-	Addr      string `env:"ADDRESS" json:"addr"`
-	Interval  int    `env:"STORE_INTERVAL" json:"interval"`
-	Path      string `env:"FILE_STORAGE_PATH" json:"path"`
-	Restore   bool   `env:"RESTORE" json:"restore"`
-	DBAddr    string `env:"DATABASE_DSN" json:"db_addr"`
-	Key       string `env:"KEY" json:"key"`
-	CryptoKey string `env:"CRYPTO_KEY" json:"crypto_key"`
-	Config    string `env:"CONFIG"`
+	Addr                string `env:"ADDRESS" json:"addr"`
+	Interval            int    `env:"STORE_INTERVAL" json:"interval"`
+	Path                string `env:"FILE_STORAGE_PATH" json:"path"`
+	Restore             bool   `env:"RESTORE" json:"restore"`
+	DBAddr              string `env:"DATABASE_DSN" json:"db_addr"`
+	Key                 string `env:"KEY" json:"key"`
+	SignatureStrict     bool   `env:"SIGNATURE_STRICT" json:"signature_strict"`
+	SignatureMaxSkew    int    `env:"SIGNATURE_MAX_SKEW" json:"signature_max_skew"`
+	CryptoKey           string `env:"CRYPTO_KEY" json:"crypto_key"`
+	CryptoPolicy        string `env:"CRYPTO_POLICY" json:"crypto_policy"`
+	CryptoKeys          string `env:"CRYPTO_KEYS_DIR" json:"crypto_keys_dir"`
+	Quantiles           string `env:"QUANTILES" json:"quantiles"`
+	Retention           string `env:"RETENTION" json:"retention"`
+	RetentionInterval   int    `env:"RETENTION_INTERVAL" json:"retention_interval"`
+	AlertRules          string `env:"ALERT_RULES" json:"alert_rules"`
+	AlertWebhook        string `env:"ALERT_WEBHOOK" json:"alert_webhook"`
+	AlertInterval       int    `env:"ALERT_INTERVAL" json:"alert_interval"`
+	GRPCAddr            string `env:"GRPC_ADDRESS" json:"grpc_addr"`
+	StatsDAddr          string `env:"STATSD_ADDRESS" json:"statsd_addr"`
+	StatsDInterval      int    `env:"STATSD_FLUSH_INTERVAL" json:"statsd_flush_interval"`
+	GraphiteAddr        string `env:"GRAPHITE_ADDRESS" json:"graphite_addr"`
+	GraphiteTemplates   string `env:"GRAPHITE_TEMPLATES" json:"graphite_templates"`
+	OTLPPrefixAttribute string `env:"OTLP_PREFIX_ATTRIBUTE" json:"otlp_prefix_attribute"`
+	TrustedSubnet       string `env:"TRUSTED_SUBNET" json:"trusted_subnet"`
+	Auth                string `env:"AUTH" json:"auth"`
+	TLSCert             string `env:"TLS_CERT" json:"tls_cert"`
+	TLSKey              string `env:"TLS_KEY" json:"tls_key"`
+	TLSClientCA         string `env:"TLS_CLIENT_CA" json:"tls_client_ca"`
+	TLSClientAuth       string `env:"TLS_CLIENT_AUTH" json:"tls_client_auth"`
+	TLSAllowedClients   string `env:"TLS_ALLOWED_CLIENTS" json:"tls_allowed_clients"`
+	AuthKeys            string `env:"AUTH_KEYS_FILE" json:"auth_keys_file"`
+	AuthBootstrapToken  string `env:"AUTH_BOOTSTRAP_TOKEN" json:"auth_bootstrap_token"`
+	Config              string `env:"CONFIG"`
 }
 
 func parseFlags() {
@@ -43,10 +96,43 @@ func parseFlags() {
 	flag.BoolVar(&flagRestore, "r", true, "restore metrics from file")
 	flag.StringVar(&flagDBAddr, "d", "", "database dsn")
 	flag.StringVar(&flagKey, "k", "", "key for signature")
-	flag.StringVar(&flagCryptoKey, "crypto-key", "./private_key.pem", "crypto key")
+	flag.BoolVar(&flagSignatureStrict, "signature-strict", false, "reject write requests without signature")
+	flag.IntVar(&flagSignatureMaxSkew, "signature-max-skew", 300, "max allowed signature timestamp skew in seconds")
+	flag.StringVar(&flagCryptoKey, "crypto-key", "./private_key.pem", "crypto key, the default is not used with -crypto-keys-dir")
+	flag.StringVar(&flagCryptoKeys, "crypto-keys-dir", "", "directory with rotated crypto keys (*.pem), reloaded on SIGHUP")
+	flag.StringVar(&flagCryptoPolicy, "crypto-policy", "optional", "write endpoints encryption policy, e.g. strict,/update/=optional; strict also requires tls for grpc writes")
 	flag.StringVar(&flagConfig, "config", "", "config path")
+	flag.StringVar(&flagQuantiles, "quantiles", "0.5,0.9,0.99", "comma separated summary quantiles")
+	flag.StringVar(&flagRetention, "retention", "", "history retention rules, e.g. raw:24h,1m:720h,1h:8760h")
+	flag.IntVar(&flagRetentionInterval, "retention-interval", 60, "history retention interval")
+	flag.StringVar(&flagAlertRules, "alert-rules", "", "alerting rules file path")
+	flag.StringVar(&flagAlertWebhook, "alert-webhook", "", "alerting webhook url")
+	flag.IntVar(&flagAlertInterval, "alert-interval", 15, "alerting rules evaluation interval")
+	flag.StringVar(&flagGRPCAddr, "grpc-addr", "localhost:3200", "address and port metrics grpc server")
+	flag.StringVar(&flagStatsDAddr, "statsd-addr", "", "address and port of statsd udp listener, disabled if empty")
+	flag.IntVar(&flagStatsDInterval, "statsd-flush-interval", 10, "statsd aggregation interval")
+	flag.StringVar(&flagGraphiteAddr, "graphite-addr", "", "address and port of graphite plaintext tcp listener, disabled if empty")
+	flag.StringVar(&flagGraphiteTemplates, "graphite-templates", "", "path to graphite metric name templates file")
+	flag.StringVar(&flagOTLPPrefixAttribute, "otlp-prefix-attribute", "service.name", "otlp resource attribute used as metric name prefix, no prefix if empty")
+	flag.StringVar(&flagTrustedSubnet, "t", "", "trusted subnet in CIDR notation")
+	flag.StringVar(&flagAuth, "auth", "", "api keys storage: file or db, authentication is disabled if empty")
+	flag.StringVar(&flagAuthKeys, "auth-keys", "", "api keys file path, used with -auth=file")
+	flag.StringVar(&flagAuthBootstrapToken, "auth-bootstrap-token", "", "token of admin api key created on start if missing")
+	flag.StringVar(&flagTLSCert, "tls-cert", "", "tls certificate path, plain http and grpc are used if empty")
+	flag.StringVar(&flagTLSKey, "tls-key", "", "tls private key path")
+	flag.StringVar(&flagTLSClientCA, "tls-client-ca", "", "CA certificate path to verify agent certificates")
+	flag.StringVar(&flagTLSClientAuth, "tls-client-auth", "", "agent certificate verification: none, optional or require")
+	flag.StringVar(&flagTLSAllowedClients, "tls-allowed-clients", "", "comma separated allowed agent certificate names, any if empty")
 	flag.Parse()
 
+	// set - параметры, заданные явно флагами или переменными окружения: значения из файла конфигурации
+	// применяются только к остальным, иначе их заменяли бы значения флагов по умолчанию
+	// Путь к ключу считается заданным и после применения файла конфигурации
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
 	var cfg Config
 	if err := godotenv.Load(); err != nil {
 		if !errors.Is(err, os.ErrNotExist) {
@@ -60,15 +146,120 @@ func parseFlags() {
 
 	if cfg.Addr != "" {
 		flagAddr = cfg.Addr
+		set["a"] = true
 	}
 	if cfg.DBAddr != "" {
 		flagDBAddr = cfg.DBAddr
+		set["d"] = true
 	}
 	if cfg.Key != "" {
 		flagKey = cfg.Key
+		set["k"] = true
+	}
+	if cfg.SignatureStrict {
+		flagSignatureStrict = true
+		set["signature-strict"] = true
+	}
+	if cfg.SignatureMaxSkew != 0 {
+		flagSignatureMaxSkew = cfg.SignatureMaxSkew
+		set["signature-max-skew"] = true
 	}
 	if cfg.CryptoKey != "" {
 		flagCryptoKey = cfg.CryptoKey
+		set["crypto-key"] = true
+	}
+	if cfg.CryptoPolicy != "" {
+		flagCryptoPolicy = cfg.CryptoPolicy
+		set["crypto-policy"] = true
+	}
+	if cfg.CryptoKeys != "" {
+		flagCryptoKeys = cfg.CryptoKeys
+		set["crypto-keys-dir"] = true
+	}
+
+	if cfg.Quantiles != "" {
+		flagQuantiles = cfg.Quantiles
+		set["quantiles"] = true
+	}
+	if cfg.Retention != "" {
+		flagRetention = cfg.Retention
+		set["retention"] = true
+	}
+	if cfg.RetentionInterval != 0 {
+		flagRetentionInterval = cfg.RetentionInterval
+		set["retention-interval"] = true
+	}
+	if cfg.AlertRules != "" {
+		flagAlertRules = cfg.AlertRules
+		set["alert-rules"] = true
+	}
+	if cfg.AlertWebhook != "" {
+		flagAlertWebhook = cfg.AlertWebhook
+		set["alert-webhook"] = true
+	}
+	if cfg.AlertInterval != 0 {
+		flagAlertInterval = cfg.AlertInterval
+		set["alert-interval"] = true
+	}
+	if cfg.GRPCAddr != "" {
+		flagGRPCAddr = cfg.GRPCAddr
+		set["grpc-addr"] = true
+	}
+	if cfg.StatsDAddr != "" {
+		flagStatsDAddr = cfg.StatsDAddr
+		set["statsd-addr"] = true
+	}
+	if cfg.StatsDInterval != 0 {
+		flagStatsDInterval = cfg.StatsDInterval
+		set["statsd-flush-interval"] = true
+	}
+	if cfg.GraphiteAddr != "" {
+		flagGraphiteAddr = cfg.GraphiteAddr
+		set["graphite-addr"] = true
+	}
+	if cfg.GraphiteTemplates != "" {
+		flagGraphiteTemplates = cfg.GraphiteTemplates
+		set["graphite-templates"] = true
+	}
+	if cfg.OTLPPrefixAttribute != "" {
+		flagOTLPPrefixAttribute = cfg.OTLPPrefixAttribute
+		set["otlp-prefix-attribute"] = true
+	}
+	if cfg.TrustedSubnet != "" {
+		flagTrustedSubnet = cfg.TrustedSubnet
+		set["t"] = true
+	}
+	if cfg.Auth != "" {
+		flagAuth = cfg.Auth
+		set["auth"] = true
+	}
+	if cfg.AuthKeys != "" {
+		flagAuthKeys = cfg.AuthKeys
+		set["auth-keys"] = true
+	}
+	if cfg.AuthBootstrapToken != "" {
+		flagAuthBootstrapToken = cfg.AuthBootstrapToken
+		set["auth-bootstrap-token"] = true
+	}
+	if cfg.TLSCert != "" {
+		flagTLSCert = cfg.TLSCert
+		set["tls-cert"] = true
+	}
+	if cfg.TLSKey != "" {
+		flagTLSKey = cfg.TLSKey
+		set["tls-key"] = true
+	}
+	if cfg.TLSClientCA != "" {
+		flagTLSClientCA = cfg.TLSClientCA
+		set["tls-client-ca"] = true
+	}
+	if cfg.TLSClientAuth != "" {
+		flagTLSClientAuth = cfg.TLSClientAuth
+		set["tls-client-auth"] = true
+	}
+	if cfg.TLSAllowedClients != "" {
+		flagTLSAllowedClients = cfg.TLSAllowedClients
+		set["tls-allowed-clients"] = true
 	}
 
 	if cfg.Config != "" {
@@ -90,17 +281,120 @@ func parseFlags() {
 			l.Fatal().Err(err)
 		}
 
-		if flagAddr == "" && jsonConfig.Addr != "" {
+		if !set["a"] && jsonConfig.Addr != "" {
 			flagAddr = jsonConfig.Addr
 		}
-		if flagDBAddr == "" && jsonConfig.DBAddr != "" {
+		if !set["d"] && jsonConfig.DBAddr != "" {
 			flagDBAddr = jsonConfig.DBAddr
 		}
-		if flagKey == "" && jsonConfig.Key != "" {
+		if !set["k"] && jsonConfig.Key != "" {
 			flagKey = jsonConfig.Key
 		}
-		if flagCryptoKey == "" && jsonConfig.CryptoKey != "" {
+		if !set["signature-strict"] && jsonConfig.SignatureStrict {
+			flagSignatureStrict = true
+		}
+		if !set["signature-max-skew"] && jsonConfig.SignatureMaxSkew != 0 {
+			flagSignatureMaxSkew = jsonConfig.SignatureMaxSkew
+		}
+		if !set["crypto-key"] && jsonConfig.CryptoKey != "" {
 			flagCryptoKey = jsonConfig.CryptoKey
+			set["crypto-key"] = true
+		}
+		if !set["crypto-policy"] && jsonConfig.CryptoPolicy != "" {
+			flagCryptoPolicy = jsonConfig.CryptoPolicy
+		}
+		if !set["crypto-keys-dir"] && jsonConfig.CryptoKeys != "" {
+			flagCryptoKeys = jsonConfig.CryptoKeys
+		}
+		if !set["quantiles"] && jsonConfig.Quantiles != "" {
+			flagQuantiles = jsonConfig.Quantiles
+		}
+		if !set["retention"] && jsonConfig.Retention != "" {
+			flagRetention = jsonConfig.Retention
+		}
+		if !set["retention-interval"] && jsonConfig.RetentionInterval != 0 {
+			flagRetentionInterval = jsonConfig.RetentionInterval
+		}
+		if !set["alert-rules"] && jsonConfig.AlertRules != "" {
+			flagAlertRules = jsonConfig.AlertRules
+		}
+		if !set["alert-webhook"] && jsonConfig.AlertWebhook != "" {
+			flagAlertWebhook = jsonConfig.AlertWebhook
+		}
+		if !set["alert-interval"] && jsonConfig.AlertInterval != 0 {
+			flagAlertInterval = jsonConfig.AlertInterval
+		}
+		if !set["grpc-addr"] && jsonConfig.GRPCAddr != "" {
+			flagGRPCAddr = jsonConfig.GRPCAddr
+		}
+		if !set["statsd-addr"] && jsonConfig.StatsDAddr != "" {
+			flagStatsDAddr = jsonConfig.StatsDAddr
+		}
+		if !set["statsd-flush-interval"] && jsonConfig.StatsDInterval != 0 {
+			flagStatsDInterval = jsonConfig.StatsDInterval
+		}
+		if !set["graphite-addr"] && jsonConfig.GraphiteAddr != "" {
+			flagGraphiteAddr = jsonConfig.GraphiteAddr
+		}
+		if !set["graphite-templates"] && jsonConfig.GraphiteTemplates != "" {
+			flagGraphiteTemplates = jsonConfig.GraphiteTemplates
+		}
+		if !set["otlp-prefix-attribute"] && jsonConfig.OTLPPrefixAttribute != "" {
+			flagOTLPPrefixAttribute = jsonConfig.OTLPPrefixAttribute
+		}
+		if !set["t"] && jsonConfig.TrustedSubnet != "" {
+			flagTrustedSubnet = jsonConfig.TrustedSubnet
+		}
+		if !set["auth"] && jsonConfig.Auth != "" {
+			flagAuth = jsonConfig.Auth
+		}
+		if !set["auth-keys"] && jsonConfig.AuthKeys != "" {
+			flagAuthKeys = jsonConfig.AuthKeys
+		}
+		if !set["auth-bootstrap-token"] && jsonConfig.AuthBootstrapToken != "" {
+			flagAuthBootstrapToken = jsonConfig.AuthBootstrapToken
+		}
+		if !set["tls-cert"] && jsonConfig.TLSCert != "" {
+			flagTLSCert = jsonConfig.TLSCert
+		}
+		if !set["tls-key"] && jsonConfig.TLSKey != "" {
+			flagTLSKey = jsonConfig.TLSKey
+		}
+		if !set["tls-client-ca"] && jsonConfig.TLSClientCA != "" {
+			flagTLSClientCA = jsonConfig.TLSClientCA
+		}
+		if !set["tls-client-auth"] && jsonConfig.TLSClientAuth != "" {
+			flagTLSClientAuth = jsonConfig.TLSClientAuth
+		}
+		if !set["tls-allowed-clients"] && jsonConfig.TLSAllowedClients != "" {
+			flagTLSAllowedClients = jsonConfig.TLSAllowedClients
+		}
+	}
+
+	// ключ по умолчанию не добавляется к каталогу ключей: его файла может не быть,
+	// а после удаления файла перестала бы работать перезагрузка ключей по SIGHUP
+	if flagCryptoKeys != "" && !set["crypto-key"] {
+		flagCryptoKey = ""
+	}
+}
+
+// parseQuantiles
+// Разбирает список квантилей через запятую, каждый квантиль в интервале [0, 1]
+func parseQuantiles(raw string) ([]float64, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	parts := strings.Split(raw, ",")
+	quantiles := make([]float64, 0, len(parts))
+	for _, p := range parts {
+		q, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantile %q: %w", p, err)
+		}
+		if q < 0 || q > 1 {
+			return nil, fmt.Errorf("quantile %v out of range [0, 1]", q)
 		}
+		quantiles = append(quantiles, q)
 	}
+	return quantiles, nil
 }
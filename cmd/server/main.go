@@ -2,20 +2,37 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 
+	"github.com/soltanat/metrics/internal/alerting"
+	"github.com/soltanat/metrics/internal/auth"
 	"github.com/soltanat/metrics/internal/db"
+	"github.com/soltanat/metrics/internal/envelope"
 	"github.com/soltanat/metrics/internal/filestorage"
+	"github.com/soltanat/metrics/internal/graphite"
+	"github.com/soltanat/metrics/internal/grpcserver"
 	"github.com/soltanat/metrics/internal/handler"
 	"github.com/soltanat/metrics/internal/logger"
+	"github.com/soltanat/metrics/internal/middleware/decrypt"
+	"github.com/soltanat/metrics/internal/middleware/signature"
+	pb "github.com/soltanat/metrics/internal/proto"
+	"github.com/soltanat/metrics/internal/retention"
+	"github.com/soltanat/metrics/internal/statsd"
 	"github.com/soltanat/metrics/internal/storage"
+	"github.com/soltanat/metrics/internal/tlsconfig"
 )
 
 var (
@@ -37,10 +54,13 @@ func main() {
 
 	var s storage.Storage
 	var dbConn *pgxpool.Pool
+	var retainer storage.Retainer
 
 	if flagDBAddr == "" {
 		interval := time.Duration(flagInterval) * time.Second
-		fs, err := filestorage.New(storage.NewMemStorage(), interval, flagPath)
+		memStorage := storage.NewMemStorage()
+		retainer = memStorage
+		fs, err := filestorage.New(memStorage, interval, flagPath)
 		if err != nil {
 			l.Fatal().Err(err).Msg("unable to create file storage")
 		}
@@ -74,36 +94,215 @@ func main() {
 			l.Fatal().Err(err).Msg("unable to connect to database")
 		}
 
-		s = storage.NewPostgresStorage(dbConn)
-		s = storage.NewBackoffPostgresStorage(s)
+		pgStorage := storage.NewPostgresStorage(dbConn)
+		retainer = pgStorage
+		s = storage.NewBackoffPostgresStorage(pgStorage)
 
 		defer dbConn.Close()
 	}
 
-	h := handler.New(s, dbConn)
+	quantiles, err := parseQuantiles(flagQuantiles)
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse quantiles")
+	}
+
+	rules, err := storage.ParseRetentionRules(flagRetention)
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse retention rules")
+	}
+	if len(rules) > 0 {
+		r := retention.New(retainer, rules, time.Duration(flagRetentionInterval)*time.Second)
+		err = r.Start()
+		if err != nil {
+			l.Fatal().Err(err).Msg("unable to start retention")
+		}
+		defer r.Stop()
+	}
+
+	h := handler.New(s, dbConn).WithQuantiles(quantiles).WithOTLPPrefixAttribute(flagOTLPPrefixAttribute)
+
+	keys, err := newKeyStore(dbConn)
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to setup api keys")
+	}
+	if keys != nil {
+		created, err := auth.Bootstrap(ctx, keys, flagAuthBootstrapToken)
+		if err != nil {
+			l.Fatal().Err(err).Msg("unable to create bootstrap api key")
+		}
+		if created {
+			l.Info().Msg("bootstrap admin api key created")
+		}
+		h.WithKeyStore(keys)
+	} else if flagAuthBootstrapToken != "" {
+		l.Warn().Msg("auth is disabled, bootstrap token is ignored")
+	}
 
-	var key []byte
+	if flagAlertRules != "" {
+		rules, err := alerting.LoadRules(flagAlertRules)
+		if err != nil {
+			l.Fatal().Err(err).Msg("unable to load alerting rules")
+		}
+		var notifier alerting.Notifier
+		if flagAlertWebhook != "" {
+			notifier = alerting.NewWebhook(flagAlertWebhook)
+		}
+		alerts := alerting.New(s, rules, notifier, time.Duration(flagAlertInterval)*time.Second)
+		err = alerts.Start()
+		if err != nil {
+			l.Fatal().Err(err).Msg("unable to start alerting")
+		}
+		defer alerts.Stop()
+		h.WithAlerts(alerts)
+	}
+
+	var keyPaths []string
 	if flagCryptoKey != "" {
-		var err error
-		key, err = os.ReadFile(flagCryptoKey)
+		keyPaths = append(keyPaths, flagCryptoKey)
+	}
+	if flagCryptoKeys != "" {
+		keyPaths = append(keyPaths, flagCryptoKeys)
+	}
+	var keyRing *envelope.KeyRing
+	if len(keyPaths) > 0 {
+		keyRing = envelope.NewKeyRing()
+		err := keyRing.Load(keyPaths...)
 		if err != nil {
-			l.Error().Msg("unable to read crypto key")
+			l.Error().Err(err).Msg("unable to read crypto key")
 			return
 		}
+		l.Info().Strs("key_ids", keyRing.IDs()).Msg("crypto keys loaded")
+		go reloadKeys(keyRing, keyPaths)
 	}
 
-	server, err := handler.SetupRoutes(h, flagKey, key)
+	encryptionPolicy, err := decrypt.ParsePolicy(flagCryptoPolicy)
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to parse crypto policy")
+	}
+
+	// один кеш одноразовых значений, чтобы подписанный запрос нельзя было повторить через другой API
+	signatureOpts := signature.Options{
+		Strict:  flagSignatureStrict,
+		MaxSkew: time.Duration(flagSignatureMaxSkew) * time.Second,
+		Nonces:  signature.NewNonceCache(),
+	}
+	routeOpts := []handler.RouteOption{
+		handler.WithEncryptionPolicy(encryptionPolicy),
+		handler.WithSignatureOptions(signatureOpts),
+	}
+	if keyRing != nil {
+		routeOpts = append(routeOpts, handler.WithKeyRing(keyRing))
+	}
+	var trustedSubnet *net.IPNet
+	if flagTrustedSubnet != "" {
+		_, trustedSubnet, err = net.ParseCIDR(flagTrustedSubnet)
+		if err != nil {
+			l.Fatal().Err(err).Msg("unable to parse trusted subnet")
+		}
+		routeOpts = append(routeOpts, handler.WithTrustedSubnet(trustedSubnet))
+	}
+
+	if flagStatsDAddr != "" || flagGraphiteAddr != "" {
+		err = checkPlaintextListeners(encryptionPolicy, signatureOpts, keys)
+		if err != nil {
+			l.Fatal().Err(err).Msg("unable to start statsd and graphite listeners")
+		}
+	}
+	if flagStatsDAddr != "" {
+		statsdServer := statsd.New(flagStatsDAddr, s, time.Duration(flagStatsDInterval)*time.Second).
+			WithTrustedSubnet(trustedSubnet)
+		err = statsdServer.Start()
+		if err != nil {
+			l.Fatal().Err(err).Msg("unable to start statsd listener")
+		}
+		defer statsdServer.Stop()
+	}
+
+	if flagGraphiteAddr != "" {
+		var templates []graphite.Template
+		if flagGraphiteTemplates != "" {
+			templates, err = graphite.LoadTemplates(flagGraphiteTemplates)
+			if err != nil {
+				l.Fatal().Err(err).Msg("unable to load graphite templates")
+			}
+		}
+		graphiteServer := graphite.New(flagGraphiteAddr, s, templates, graphite.DefaultBatchSize).
+			WithTrustedSubnet(trustedSubnet)
+		err = graphiteServer.Start()
+		if err != nil {
+			l.Fatal().Err(err).Msg("unable to start graphite listener")
+		}
+		defer graphiteServer.Stop()
+	}
+
+	tlsConfig, err := setupTLS()
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to setup tls")
+	}
+	var allowedClients []string
+	if flagTLSAllowedClients != "" {
+		allowedClients = strings.Split(flagTLSAllowedClients, ",")
+	}
+	verifyClients := tlsConfig != nil && tlsConfig.ClientAuth != tls.NoClientCert
+	if verifyClients {
+		routeOpts = append(routeOpts, handler.WithClientCert(allowedClients))
+	}
+
+	server, err := handler.SetupRoutes(h, flagKey, nil, routeOpts...)
 	if err != nil {
 		l.Fatal().Err(err).Msg("unable to setup routes")
 	}
 
 	go func() {
-		err := server.Start(flagAddr)
+		var err error
+		if tlsConfig != nil {
+			server.TLSServer.Addr = flagAddr
+			server.TLSServer.TLSConfig = tlsConfig
+			err = server.StartServer(server.TLSServer)
+		} else {
+			err = server.Start(flagAddr)
+		}
 		if err != nil {
 			l.Error().Err(err).Msg("unable to start server")
 		}
 	}()
 
+	var grpcOpts []grpc.ServerOption
+	var grpcInterceptors []grpc.UnaryServerInterceptor
+	var grpcStreamInterceptors []grpc.StreamServerInterceptor
+	if tlsConfig != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if verifyClients {
+		grpcInterceptors = append(grpcInterceptors, grpcserver.ClientCertInterceptor(allowedClients))
+		grpcStreamInterceptors = append(grpcStreamInterceptors, grpcserver.ClientCertStreamInterceptor(allowedClients))
+	}
+	// в gRPC нет шифрования тела запроса, при строгой политике метрики принимаются только по TLS
+	if encryptionPolicy.Strict() {
+		if tlsConfig == nil {
+			l.Warn().Msg("crypto policy is strict and tls is not configured, grpc writes are refused")
+		}
+		grpcInterceptors = append(grpcInterceptors, grpcserver.TLSRequiredInterceptor())
+		grpcStreamInterceptors = append(grpcStreamInterceptors, grpcserver.TLSRequiredStreamInterceptor())
+	}
+
+	grpcServer, err := setupGRPC(s, quantiles, trustedSubnet, keys, signatureOpts, grpcOpts, grpcInterceptors, grpcStreamInterceptors)
+	if err != nil {
+		l.Fatal().Err(err).Msg("unable to setup grpc server")
+	}
+
+	go func() {
+		listen, err := net.Listen("tcp", flagGRPCAddr)
+		if err != nil {
+			l.Error().Err(err).Msg("unable to listen grpc address")
+			return
+		}
+		err = grpcServer.Serve(listen)
+		if err != nil {
+			l.Error().Err(err).Msg("unable to start grpc server")
+		}
+	}()
+
 	go func() {
 		err := http.ListenAndServe(flagPprofAddr, nil)
 		if err != nil {
@@ -117,6 +316,118 @@ func main() {
 	if err != nil {
 		l.Error().Err(err).Msg("unable to close server")
 	}
+	grpcServer.GracefulStop()
+}
+
+// setupGRPC
+// Создает gRPC сервер с аутентификацией по API ключам, проверкой доверенной подсети и подписи запросов
+// signatureOpts - настройки проверки подписи, общие с HTTP API
+// opts, interceptors, streamInterceptors - дополнительные опции сервера и перехватчики, выполняемые первыми
+func setupGRPC(
+	s storage.Storage,
+	quantiles []float64,
+	trustedSubnet *net.IPNet,
+	keys auth.KeyStore,
+	signatureOpts signature.Options,
+	opts []grpc.ServerOption,
+	interceptors []grpc.UnaryServerInterceptor,
+	streamInterceptors []grpc.StreamServerInterceptor,
+) (*grpc.Server, error) {
+	if keys != nil {
+		interceptors = append(interceptors, grpcserver.AuthInterceptor(keys))
+		streamInterceptors = append(streamInterceptors, grpcserver.AuthStreamInterceptor(keys))
+	}
+	if trustedSubnet != nil {
+		interceptors = append(interceptors, grpcserver.TrustedSubnetInterceptor(trustedSubnet))
+		streamInterceptors = append(streamInterceptors, grpcserver.TrustedSubnetStreamInterceptor(trustedSubnet))
+	}
+	if flagKey != "" {
+		interceptors = append(interceptors, grpcserver.SignatureInterceptor(flagKey, signatureOpts))
+		streamInterceptors = append(streamInterceptors, grpcserver.SignatureStreamInterceptor(flagKey, signatureOpts))
+	} else if signatureOpts.Strict {
+		return nil, fmt.Errorf("strict signature mode requires key")
+	}
+
+	server := grpc.NewServer(append(opts,
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	)...)
+	pb.RegisterMetricsServer(server, grpcserver.New(s, quantiles))
+	return server, nil
+}
+
+// checkPlaintextListeners
+// Проверяет, что StatsD и Graphite можно запустить: они принимают метрики без аутентификации, подписи и шифрования,
+// поэтому несовместимы со строгой политикой шифрования, строгой проверкой подписи и API ключами
+// Доверенная подсеть проверяется по адресу отправителя
+func checkPlaintextListeners(policy decrypt.Policy, signatureOpts signature.Options, keys auth.KeyStore) error {
+	switch {
+	case policy.Strict():
+		return fmt.Errorf("crypto policy is strict, statsd and graphite do not support encryption")
+	case signatureOpts.Strict:
+		return fmt.Errorf("signature mode is strict, statsd and graphite do not support signatures")
+	case keys != nil:
+		return fmt.Errorf("auth is enabled, statsd and graphite do not support api keys")
+	}
+	return nil
+}
+
+// setupTLS
+// Создает конфигурацию TLS сервера по флагам -tls-*, возвращает nil, если сертификат не задан
+func setupTLS() (*tls.Config, error) {
+	if flagTLSCert == "" {
+		if flagTLSKey != "" || flagTLSClientCA != "" {
+			return nil, fmt.Errorf("tls certificate is required")
+		}
+		return nil, nil
+	}
+	clientAuth, err := tlsconfig.ParseClientAuth(flagTLSClientAuth)
+	if err != nil {
+		return nil, err
+	}
+	if flagTLSClientAuth == "" && flagTLSClientCA != "" {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tlsconfig.Server(flagTLSCert, flagTLSKey, flagTLSClientCA, clientAuth)
+}
+
+// newKeyStore
+// Создает хранилище API ключей по флагу -auth: file - JSON файл -auth-keys, db - таблица в базе данных
+// Возвращает nil, если аутентификация отключена
+func newKeyStore(dbConn *pgxpool.Pool) (auth.KeyStore, error) {
+	switch flagAuth {
+	case "":
+		return nil, nil
+	case "file":
+		if flagAuthKeys == "" {
+			return nil, fmt.Errorf("api keys file is required for file auth")
+		}
+		return auth.NewFileKeyStore(flagAuthKeys)
+	case "db":
+		if dbConn == nil {
+			return nil, fmt.Errorf("database dsn is required for db auth")
+		}
+		return auth.NewPostgresKeyStore(dbConn), nil
+	default:
+		return nil, fmt.Errorf("unknown auth %q, expected file or db", flagAuth)
+	}
+}
+
+// reloadKeys
+// Перечитывает ключи расшифровки из paths при получении SIGHUP
+// Если ключи прочитать не удалось, продолжают использоваться загруженные ранее
+func reloadKeys(keyRing *envelope.KeyRing, paths []string) {
+	l := logger.Get()
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	for range ch {
+		err := keyRing.Load(paths...)
+		if err != nil {
+			l.Error().Err(err).Msg("unable to reload crypto keys")
+			continue
+		}
+		l.Info().Strs("key_ids", keyRing.IDs()).Msg("crypto keys reloaded")
+	}
 }
 
 func gracefulShutdown() {
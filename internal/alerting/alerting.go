@@ -0,0 +1,222 @@
+package alerting
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/soltanat/metrics/internal/logger"
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+// State
+// Состояние оповещения
+type State string
+
+const (
+	// StatePending условие выполняется, но меньше For
+	StatePending State = "pending"
+	// StateFiring условие выполняется дольше For
+	StateFiring State = "firing"
+	// StateResolved условие перестало выполняться после срабатывания
+	StateResolved State = "resolved"
+)
+
+// Alert
+// Оповещение по серии метрики, подходящей под правило
+type Alert struct {
+	Rule       string       `json:"rule"`
+	Name       string       `json:"name"`
+	Type       string       `json:"type"`
+	Labels     model.Labels `json:"labels,omitempty"`
+	State      State        `json:"state"`
+	Value      float64      `json:"value"`
+	ActiveAt   time.Time    `json:"active_at"`
+	FiredAt    *time.Time   `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time   `json:"resolved_at,omitempty"`
+	// notified состояние, уведомление о котором доставлено
+	notified State
+}
+
+// Notifier
+// Отправляет уведомления о сработавших и разрешенных оповещениях
+type Notifier interface {
+	Notify(alerts []Alert) error
+}
+
+// Manager
+// Периодически проверяет правила по значениям хранилища и хранит состояние оповещений
+type Manager struct {
+	storage  storage.Storage
+	rules    []Rule
+	notifier Notifier
+	interval time.Duration
+	alerts   map[string]*Alert
+	mu       *sync.RWMutex
+	stopCh   chan struct{}
+	closeCh  chan struct{}
+}
+
+// New
+// Инициализирует Manager
+// notifier - может быть nil, тогда уведомления не отправляются
+// interval - периодичность проверки правил
+func New(s storage.Storage, rules []Rule, notifier Notifier, interval time.Duration) *Manager {
+	return &Manager{
+		storage:  s,
+		rules:    rules,
+		notifier: notifier,
+		interval: interval,
+		alerts:   make(map[string]*Alert),
+		mu:       &sync.RWMutex{},
+		stopCh:   make(chan struct{}),
+		closeCh:  make(chan struct{}),
+	}
+}
+
+// Start
+// Запускает периодическую проверку правил
+func (m *Manager) Start() error {
+	if m.interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	go func() {
+		l := logger.Get()
+
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Eval(time.Now()); err != nil {
+					l.Error().Err(err).Msg("alerting error")
+				}
+			case <-m.stopCh:
+				m.closeCh <- struct{}{}
+				l.Info().Msg("alerting stopped")
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop
+// Останавливает проверку правил
+func (m *Manager) Stop() {
+	m.stopCh <- struct{}{}
+	<-m.closeCh
+}
+
+// Eval
+// Проверяет правила на момент времени now и отправляет уведомления об изменении состояния
+// Оповещение переходит в firing и resolved с уведомлением, в pending - без уведомления
+// Если уведомление не доставлено, оно отправляется повторно при следующей проверке
+// Разрешенное оповещение хранится до следующего срабатывания условия
+func (m *Manager) Eval(now time.Time) error {
+	metrics, err := m.storage.GetList()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	active := make(map[string]struct{})
+	for i := range m.rules {
+		rule := &m.rules[i]
+		for j := range metrics {
+			metric := &metrics[j]
+			if !rule.matches(metric) {
+				continue
+			}
+			value := rule.value(metric)
+			if !operators[rule.Op](value, rule.Threshold) {
+				continue
+			}
+
+			key := rule.Expr + metric.Key()
+			active[key] = struct{}{}
+			alert, ok := m.alerts[key]
+			if !ok || alert.State == StateResolved {
+				alert = &Alert{
+					Rule:     rule.Expr,
+					Name:     metric.Name,
+					Type:     metric.Type.String(),
+					Labels:   metric.Labels,
+					State:    StatePending,
+					ActiveAt: now,
+				}
+				m.alerts[key] = alert
+			}
+			alert.Value = value
+			if alert.State == StatePending && now.Sub(alert.ActiveAt) >= rule.For {
+				firedAt := now
+				alert.State = StateFiring
+				alert.FiredAt = &firedAt
+			}
+		}
+	}
+
+	for key, alert := range m.alerts {
+		if _, ok := active[key]; ok {
+			continue
+		}
+		switch alert.State {
+		case StatePending:
+			delete(m.alerts, key)
+		case StateFiring:
+			resolvedAt := now
+			alert.State = StateResolved
+			alert.ResolvedAt = &resolvedAt
+		}
+	}
+
+	notify := make([]Alert, 0)
+	unnotified := make(map[*Alert]State)
+	for _, alert := range m.alerts {
+		if alert.State != StatePending && alert.State != alert.notified {
+			notify = append(notify, *alert)
+			unnotified[alert] = alert.State
+		}
+	}
+	m.mu.Unlock()
+
+	if len(notify) == 0 || m.notifier == nil {
+		return nil
+	}
+	sortAlerts(notify)
+	if err := m.notifier.Notify(notify); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	for alert, state := range unnotified {
+		alert.notified = state
+	}
+	m.mu.Unlock()
+	return nil
+}
+
+// Alerts
+// Возвращает текущие оповещения, отсортированные по правилу, имени и меткам
+func (m *Manager) Alerts() []Alert {
+	m.mu.RLock()
+	alerts := make([]Alert, 0, len(m.alerts))
+	for _, a := range m.alerts {
+		alerts = append(alerts, *a)
+	}
+	m.mu.RUnlock()
+	sortAlerts(alerts)
+	return alerts
+}
+
+func sortAlerts(alerts []Alert) {
+	sort.Slice(alerts, func(i, j int) bool {
+		if alerts[i].Rule != alerts[j].Rule {
+			return alerts[i].Rule < alerts[j].Rule
+		}
+		return model.SeriesKey(alerts[i].Name, alerts[i].Labels) < model.SeriesKey(alerts[j].Name, alerts[j].Labels)
+	})
+}
@@ -0,0 +1,219 @@
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+func TestParseRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Rule
+		wantErr bool
+	}{
+		{
+			name: "gauge with for",
+			raw:  "gauge FreeMemory < 1e9 for 2m",
+			want: Rule{
+				Expr:      "gauge FreeMemory < 1e9 for 2m",
+				Type:      model.MetricTypeGauge,
+				Name:      "FreeMemory",
+				Op:        "<",
+				Threshold: 1e9,
+				For:       2 * time.Minute,
+			},
+		},
+		{
+			name: "counter with labels",
+			raw:  `counter PollCount{host="a"}>=100`,
+			want: Rule{
+				Expr:      `counter PollCount{host="a"}>=100`,
+				Type:      model.MetricTypeCounter,
+				Name:      "PollCount",
+				Matchers:  model.Labels{"host": "a"},
+				Op:        ">=",
+				Threshold: 100,
+			},
+		},
+		{
+			name:    "unsupported type",
+			raw:     "histogram latency > 1",
+			wantErr: true,
+		},
+		{
+			name:    "unknown type",
+			raw:     "meter FreeMemory < 1",
+			wantErr: true,
+		},
+		{
+			name:    "missing operator",
+			raw:     "gauge FreeMemory 1e9",
+			wantErr: true,
+		},
+		{
+			name:    "invalid threshold",
+			raw:     "gauge FreeMemory < low",
+			wantErr: true,
+		},
+		{
+			name:    "invalid duration",
+			raw:     "gauge FreeMemory < 1 for soon",
+			wantErr: true,
+		},
+		{
+			name:    "range selector",
+			raw:     "gauge FreeMemory[5m] < 1",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRule(tt.raw)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidRule)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestReadRules(t *testing.T) {
+	rules, err := ReadRules(strings.NewReader("# memory\ngauge FreeMemory < 1e9 for 2m\n\ncounter PollCount > 10\n"))
+	assert.NoError(t, err)
+	assert.Len(t, rules, 2)
+
+	_, err = ReadRules(strings.NewReader("gauge FreeMemory < 1e9\ngauge FreeMemory\n"))
+	assert.ErrorContains(t, err, "line 2")
+}
+
+type notifierFunc func(alerts []Alert) error
+
+func (f notifierFunc) Notify(alerts []Alert) error {
+	return f(alerts)
+}
+
+func TestManager_Eval(t *testing.T) {
+	rule, err := ParseRule("gauge FreeMemory < 100 for 2m")
+	require.NoError(t, err)
+
+	low := model.NewGauge("FreeMemory", 50)
+	low.Labels = model.Labels{"host": "a"}
+	high := model.NewGauge("FreeMemory", 500)
+	high.Labels = model.Labels{"host": "a"}
+
+	var notified [][]Alert
+	notifier := notifierFunc(func(alerts []Alert) error {
+		notified = append(notified, alerts)
+		return nil
+	})
+
+	start := time.Unix(1700000000, 0)
+	steps := []struct {
+		name      string
+		at        time.Time
+		metrics   []model.Metric
+		wantState []State
+		wantSent  int
+	}{
+		{name: "pending", at: start, metrics: []model.Metric{*low}, wantState: []State{StatePending}},
+		{name: "still pending", at: start.Add(time.Minute), metrics: []model.Metric{*low}, wantState: []State{StatePending}},
+		{name: "firing", at: start.Add(2 * time.Minute), metrics: []model.Metric{*low}, wantState: []State{StateFiring}, wantSent: 1},
+		{name: "still firing", at: start.Add(3 * time.Minute), metrics: []model.Metric{*low}, wantState: []State{StateFiring}, wantSent: 1},
+		{name: "resolved", at: start.Add(4 * time.Minute), metrics: []model.Metric{*high}, wantState: []State{StateResolved}, wantSent: 2},
+		{name: "pending again", at: start.Add(5 * time.Minute), metrics: []model.Metric{*low}, wantState: []State{StatePending}, wantSent: 2},
+		{name: "pending dropped", at: start.Add(6 * time.Minute), metrics: []model.Metric{*high}, wantState: []State{}, wantSent: 2},
+	}
+
+	s := &storage.MockStorage{}
+	m := New(s, []Rule{rule}, notifier, time.Minute)
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			s.ExpectedCalls = nil
+			s.On("GetList").Return(step.metrics, nil)
+
+			assert.NoError(t, m.Eval(step.at))
+
+			states := make([]State, 0)
+			for _, a := range m.Alerts() {
+				states = append(states, a.State)
+			}
+			assert.Equal(t, step.wantState, states)
+			assert.Len(t, notified, step.wantSent)
+		})
+	}
+
+	require.Len(t, notified, 2)
+	assert.Equal(t, StateFiring, notified[0][0].State)
+	assert.Equal(t, start, notified[0][0].ActiveAt)
+	assert.Equal(t, model.Labels{"host": "a"}, notified[0][0].Labels)
+	assert.Equal(t, StateResolved, notified[1][0].State)
+	assert.Equal(t, start.Add(4*time.Minute), *notified[1][0].ResolvedAt)
+}
+
+func TestManager_Eval_NotifyRetry(t *testing.T) {
+	rule, err := ParseRule("gauge FreeMemory < 100")
+	require.NoError(t, err)
+
+	var calls int
+	var notified [][]Alert
+	notifier := notifierFunc(func(alerts []Alert) error {
+		calls++
+		if calls == 1 {
+			return errors.New("webhook is down")
+		}
+		notified = append(notified, alerts)
+		return nil
+	})
+
+	s := &storage.MockStorage{}
+	s.On("GetList").Return([]model.Metric{*model.NewGauge("FreeMemory", 50)}, nil)
+	m := New(s, []Rule{rule}, notifier, time.Minute)
+
+	start := time.Unix(1700000000, 0)
+	assert.Error(t, m.Eval(start))
+	assert.Empty(t, notified)
+
+	// недоставленное уведомление отправляется при следующей проверке, и только один раз
+	assert.NoError(t, m.Eval(start.Add(time.Minute)))
+	assert.NoError(t, m.Eval(start.Add(2*time.Minute)))
+	require.Len(t, notified, 1)
+	require.Len(t, notified[0], 1)
+	assert.Equal(t, StateFiring, notified[0][0].State)
+	assert.Equal(t, start, *notified[0][0].FiredAt)
+	assert.Equal(t, 2, calls)
+}
+
+func TestWebhook_Notify(t *testing.T) {
+	var got WebhookMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		if got.Alerts[0].State == StateResolved {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	w := NewWebhook(srv.URL)
+	alert := Alert{Rule: "gauge FreeMemory < 1", Name: "FreeMemory", Type: "gauge", State: StateFiring, Value: 0.5}
+	assert.NoError(t, w.Notify([]Alert{alert}))
+	assert.Equal(t, "FreeMemory", got.Alerts[0].Name)
+
+	alert.State = StateResolved
+	assert.Error(t, w.Notify([]Alert{alert}))
+}
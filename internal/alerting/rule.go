@@ -0,0 +1,154 @@
+// Package alerting
+// Правила оповещений над значениями метрик и отправка уведомлений
+package alerting
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/query"
+)
+
+// ErrInvalidRule
+// Ошибка разбора правила оповещения
+var ErrInvalidRule = errors.New("invalid alerting rule")
+
+// Rule
+// Правило оповещения: условие над последним значением метрики
+// Оповещение срабатывает, если условие выполняется дольше For
+type Rule struct {
+	Expr      string
+	Type      model.MetricType
+	Name      string
+	Matchers  model.Labels
+	Op        string
+	Threshold float64
+	For       time.Duration
+}
+
+// operators
+// Операторы сравнения значения метрики с порогом
+var operators = map[string]func(v, threshold float64) bool{
+	"<":  func(v, threshold float64) bool { return v < threshold },
+	"<=": func(v, threshold float64) bool { return v <= threshold },
+	">":  func(v, threshold float64) bool { return v > threshold },
+	">=": func(v, threshold float64) bool { return v >= threshold },
+	"==": func(v, threshold float64) bool { return v == threshold },
+	"!=": func(v, threshold float64) bool { return v != threshold },
+}
+
+var ruleRegexp = regexp.MustCompile(`^(\S+)\s+(.+?)\s*(<=|>=|==|!=|<|>)\s*(\S+)(?:\s+for\s+(\S+))?$`)
+
+// ParseRule
+// Разбирает правило в формате "<type> <metric> <op> <threshold> [for <duration>]",
+// например gauge FreeMemory{host="a"} < 1e9 for 2m
+// Поддерживаются метрики gauge и counter и операторы < <= > >= == !=
+func ParseRule(raw string) (Rule, error) {
+	raw = strings.TrimSpace(raw)
+	parts := ruleRegexp.FindStringSubmatch(raw)
+	if parts == nil {
+		return Rule{}, fmt.Errorf("%w %q: expected <type> <metric> <op> <threshold> [for <duration>]", ErrInvalidRule, raw)
+	}
+
+	metricType, err := model.ParseMetricType(parts[1])
+	if err != nil {
+		return Rule{}, fmt.Errorf("%w %q: %s", ErrInvalidRule, raw, err)
+	}
+	if metricType != model.MetricTypeGauge && metricType != model.MetricTypeCounter {
+		return Rule{}, fmt.Errorf("%w %q: only gauge and counter are supported", ErrInvalidRule, raw)
+	}
+
+	expr, err := query.Parse(parts[2])
+	if err != nil {
+		return Rule{}, fmt.Errorf("%w %q: %s", ErrInvalidRule, raw, err)
+	}
+	selector, ok := expr.(*query.Selector)
+	if !ok || selector.Range != 0 {
+		return Rule{}, fmt.Errorf("%w %q: expected metric name with optional labels", ErrInvalidRule, raw)
+	}
+
+	threshold, err := strconv.ParseFloat(parts[4], 64)
+	if err != nil {
+		return Rule{}, fmt.Errorf("%w %q: invalid threshold: %s", ErrInvalidRule, raw, err)
+	}
+
+	rule := Rule{
+		Expr:      raw,
+		Type:      metricType,
+		Name:      selector.Name,
+		Matchers:  selector.Matchers,
+		Op:        parts[3],
+		Threshold: threshold,
+	}
+	if parts[5] != "" {
+		rule.For, err = time.ParseDuration(parts[5])
+		if err != nil || rule.For < 0 {
+			return Rule{}, fmt.Errorf("%w %q: invalid duration %q", ErrInvalidRule, raw, parts[5])
+		}
+	}
+	return rule, nil
+}
+
+// ReadRules
+// Читает правила по одному на строку, пустые строки и строки, начинающиеся с #, пропускаются
+func ReadRules(r io.Reader) ([]Rule, error) {
+	rules := make([]Rule, 0)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		rule, err := ParseRule(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// LoadRules
+// Загружает правила из файла
+func LoadRules(path string) ([]Rule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadRules(f)
+}
+
+// matches
+// Проверяет, что метрика подходит под тип, имя и метки правила
+func (r *Rule) matches(m *model.Metric) bool {
+	if m.Type != r.Type || m.Name != r.Name {
+		return false
+	}
+	for k, v := range r.Matchers {
+		if m.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// value
+// Значение метрики, с которым сравнивается порог
+func (r *Rule) value(m *model.Metric) float64 {
+	if m.Type == model.MetricTypeCounter {
+		return float64(m.Counter)
+	}
+	return m.Gauge
+}
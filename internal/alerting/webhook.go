@@ -0,0 +1,62 @@
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout
+// Таймаут отправки уведомления
+const webhookTimeout = 10 * time.Second
+
+// WebhookMessage
+// Тело уведомления, отправляемого на webhook
+type WebhookMessage struct {
+	Alerts []Alert `json:"alerts"`
+}
+
+// Webhook
+// Отправляет уведомления POST запросом с JSON телом WebhookMessage
+type Webhook struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhook
+// Инициализирует Webhook
+// url - адрес, на который отправляются уведомления
+func NewWebhook(url string) *Webhook {
+	return &Webhook{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+// Notify
+// Отправляет уведомление, ответ со статусом вне 2xx считается ошибкой
+func (w *Webhook) Notify(alerts []Alert) error {
+	body, err := json.Marshal(WebhookMessage{Alerts: alerts})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Package auth
+// Аутентификация запросов по именованным API ключам с областями доступа
+//
+// Агент передает токен в заголовке Authorization: Bearer <token>, сервер хранит только sha256 хеш токена,
+// поэтому скомпрометированный ключ отзывается без смены остальных ключей.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrKeyNotFound ключ с таким токеном или именем не найден
+	ErrKeyNotFound = errors.New("api key not found")
+	// ErrKeyExists ключ с таким именем или токеном уже существует
+	ErrKeyExists = errors.New("api key already exists")
+	// ErrInvalidKey некорректное имя или области доступа ключа
+	ErrInvalidKey = errors.New("invalid api key")
+	// ErrForbidden у ключа нет нужной области доступа
+	ErrForbidden = errors.New("api key scope is not allowed")
+)
+
+// Scope
+// Область доступа API ключа
+type Scope string
+
+const (
+	// ScopeRead чтение метрик, истории, запросов и оповещений
+	ScopeRead Scope = "read"
+	// ScopeWrite запись метрик
+	ScopeWrite Scope = "write"
+	// ScopeAdmin управление ключами, включает read и write
+	ScopeAdmin Scope = "admin"
+)
+
+// ParseScope
+// Разбирает область доступа: read, write или admin
+func ParseScope(raw string) (Scope, error) {
+	switch s := Scope(strings.TrimSpace(raw)); s {
+	case ScopeRead, ScopeWrite, ScopeAdmin:
+		return s, nil
+	default:
+		return "", fmt.Errorf("%w: unknown scope %q, expected read, write or admin", ErrInvalidKey, raw)
+	}
+}
+
+// APIKey
+// Именованный API ключ
+type APIKey struct {
+	Name      string     `json:"name"`                 // имя ключа, например имя агента
+	TokenHash string     `json:"token_hash"`           // sha256 хеш токена в hex
+	Scopes    []Scope    `json:"scopes"`               // области доступа
+	CreatedAt time.Time  `json:"created_at"`           // время создания
+	RevokedAt *time.Time `json:"revoked_at,omitempty"` // время отзыва, отозванный ключ не проходит аутентификацию
+}
+
+// Allows
+// Возвращает true, если ключ не отозван и дает доступ к области scope
+// Область admin дает доступ ко всем областям
+func (k *APIKey) Allows(scope Scope) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	for _, s := range k.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate
+// Проверяет имя, хеш токена и области доступа ключа
+func (k *APIKey) Validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("%w: empty name", ErrInvalidKey)
+	}
+	if b, err := hex.DecodeString(k.TokenHash); err != nil || len(b) != sha256.Size {
+		return fmt.Errorf("%w: token hash must be hex encoded sha256", ErrInvalidKey)
+	}
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("%w: no scopes", ErrInvalidKey)
+	}
+	for _, s := range k.Scopes {
+		if _, err := ParseScope(string(s)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// KeyStore
+// Хранилище API ключей
+type KeyStore interface {
+	// Lookup возвращает ключ по хешу токена, ErrKeyNotFound если ключа нет
+	Lookup(ctx context.Context, tokenHash string) (*APIKey, error)
+	// List возвращает все ключи, включая отозванные
+	List(ctx context.Context) ([]APIKey, error)
+	// Create сохраняет новый ключ, ErrKeyExists если ключ с таким именем или токеном уже есть
+	Create(ctx context.Context, key APIKey) error
+	// Revoke отзывает ключ по имени, ErrKeyNotFound если ключа нет
+	Revoke(ctx context.Context, name string) error
+}
+
+// HashToken
+// Возвращает sha256 хеш токена в hex, в таком виде токен хранится в KeyStore
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// GenerateToken
+// Генерирует случайный токен
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Authenticate
+// Находит ключ по токену и проверяет доступ к области scope
+// Возвращает ErrKeyNotFound для неизвестного или отозванного токена и ErrForbidden, если у ключа нет области scope
+func Authenticate(ctx context.Context, store KeyStore, token string, scope Scope) (*APIKey, error) {
+	if token == "" {
+		return nil, ErrKeyNotFound
+	}
+	key, err := store.Lookup(ctx, HashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, ErrKeyNotFound
+	}
+	if !key.Allows(scope) {
+		return nil, ErrForbidden
+	}
+	return key, nil
+}
+
+// Bootstrap
+// Создает ключ с областью admin для токена token, если ключа с таким токеном еще нет,
+// чтобы в пустом хранилище можно было создать остальные ключи через API
+// Ключ называется bootstrap-<первые 8 символов хеша токена>, поэтому смена токена создает новый ключ,
+// а прежний остается до явного отзыва. Отозванный ключ не восстанавливается
+// Возвращает true, если ключ создан
+func Bootstrap(ctx context.Context, store KeyStore, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+	hash := HashToken(token)
+	_, err := store.Lookup(ctx, hash)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, ErrKeyNotFound) {
+		return false, err
+	}
+	key := APIKey{Name: "bootstrap-" + hash[:8], TokenHash: hash, Scopes: []Scope{ScopeAdmin}}
+	if err := store.Create(ctx, key); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// BearerToken
+// Возвращает токен из значения заголовка Authorization вида Bearer <token>
+func BearerToken(header string) string {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStore
+// Создает FileKeyStore во временном каталоге, имя каждого ключа совпадает с его токеном
+func newStore(t *testing.T, keys map[string][]Scope) *FileKeyStore {
+	s, err := NewFileKeyStore(filepath.Join(t.TempDir(), "keys.json"))
+	require.NoError(t, err)
+	for token, scopes := range keys {
+		require.NoError(t, s.Create(context.Background(), APIKey{Name: token, TokenHash: HashToken(token), Scopes: scopes}))
+	}
+	return s
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := newStore(t, map[string][]Scope{
+		"agent":   {ScopeWrite},
+		"grafana": {ScopeRead},
+		"root":    {ScopeAdmin},
+		"revoked": {ScopeWrite},
+	})
+	require.NoError(t, s.Revoke(context.Background(), "revoked"))
+
+	tests := []struct {
+		name    string
+		token   string
+		scope   Scope
+		wantErr error
+	}{
+		{name: "write key writes", token: "agent", scope: ScopeWrite},
+		{name: "write key reads", token: "agent", scope: ScopeRead, wantErr: ErrForbidden},
+		{name: "read key reads", token: "grafana", scope: ScopeRead},
+		{name: "admin key writes", token: "root", scope: ScopeWrite},
+		{name: "admin key manages keys", token: "root", scope: ScopeAdmin},
+		{name: "write key manages keys", token: "agent", scope: ScopeAdmin, wantErr: ErrForbidden},
+		{name: "revoked key", token: "revoked", scope: ScopeWrite, wantErr: ErrKeyNotFound},
+		{name: "unknown token", token: "unknown", scope: ScopeRead, wantErr: ErrKeyNotFound},
+		{name: "empty token", token: "", scope: ScopeRead, wantErr: ErrKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := Authenticate(context.Background(), s, tt.token, tt.scope)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.token, key.Name)
+		})
+	}
+}
+
+func TestBootstrap(t *testing.T) {
+	ctx := context.Background()
+	s := newStore(t, map[string][]Scope{"revoked": {ScopeAdmin}})
+	require.NoError(t, s.Revoke(ctx, "revoked"))
+
+	tests := []struct {
+		name        string
+		token       string
+		wantCreated bool
+		wantAdmin   bool
+	}{
+		{name: "empty token", token: ""},
+		{name: "new token", token: "root", wantCreated: true, wantAdmin: true},
+		{name: "existing token", token: "root", wantAdmin: true},
+		{name: "revoked token", token: "revoked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created, err := Bootstrap(ctx, s, tt.token)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantCreated, created)
+
+			_, err = Authenticate(ctx, s, tt.token, ScopeAdmin)
+			if tt.wantAdmin {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrKeyNotFound)
+			}
+		})
+	}
+}
+
+func TestFileKeyStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "keys.json")
+
+	s, err := NewFileKeyStore(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Create(ctx, APIKey{Name: "agent-1", TokenHash: HashToken("t1"), Scopes: []Scope{ScopeWrite}}))
+	require.NoError(t, s.Create(ctx, APIKey{Name: "agent-2", TokenHash: HashToken("t2"), Scopes: []Scope{ScopeWrite}}))
+
+	assert.ErrorIs(t, s.Create(ctx, APIKey{Name: "agent-1", TokenHash: HashToken("t3"), Scopes: []Scope{ScopeWrite}}), ErrKeyExists)
+	assert.ErrorIs(t, s.Create(ctx, APIKey{Name: "agent-3", TokenHash: HashToken("t3"), Scopes: []Scope{"owner"}}), ErrInvalidKey)
+	assert.ErrorIs(t, s.Create(ctx, APIKey{Name: "agent-3", TokenHash: "t3", Scopes: []Scope{ScopeWrite}}), ErrInvalidKey)
+	assert.ErrorIs(t, s.Revoke(ctx, "agent-3"), ErrKeyNotFound)
+
+	require.NoError(t, s.Revoke(ctx, "agent-1"))
+
+	// отзыв сохраняется в файле, второй ключ продолжает работать
+	reloaded, err := NewFileKeyStore(path)
+	require.NoError(t, err)
+	keys, err := reloaded.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.NotNil(t, keys[0].RevokedAt)
+	assert.Nil(t, keys[1].RevokedAt)
+
+	_, err = Authenticate(ctx, reloaded, "t1", ScopeWrite)
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+	_, err = Authenticate(ctx, reloaded, "t2", ScopeWrite)
+	assert.NoError(t, err)
+}
+
+func TestNewFileKeyStore_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[{"name":"agent","token_hash":"abc","scopes":["write"]}]`), 0o600))
+
+	_, err := NewFileKeyStore(path)
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestMiddleware(t *testing.T) {
+	s := newStore(t, map[string][]Scope{"agent": {ScopeWrite}})
+
+	e := echo.New()
+	e.POST("/update/", func(c echo.Context) error {
+		key, ok := FromContext(c)
+		require.True(t, ok)
+		return c.String(http.StatusOK, key.Name)
+	}, Middleware(s, ScopeWrite))
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, Middleware(s, ScopeRead))
+
+	tests := []struct {
+		name          string
+		method        string
+		path          string
+		authorization string
+		wantCode      int
+	}{
+		{name: "valid token", method: http.MethodPost, path: "/update/", authorization: "Bearer agent", wantCode: http.StatusOK},
+		{name: "lowercase scheme", method: http.MethodPost, path: "/update/", authorization: "bearer agent", wantCode: http.StatusOK},
+		{name: "missing header", method: http.MethodPost, path: "/update/", wantCode: http.StatusUnauthorized},
+		{name: "basic auth", method: http.MethodPost, path: "/update/", authorization: "Basic YWdlbnQ6", wantCode: http.StatusUnauthorized},
+		{name: "unknown token", method: http.MethodPost, path: "/update/", authorization: "Bearer other", wantCode: http.StatusUnauthorized},
+		{name: "missing scope", method: http.MethodGet, path: "/", authorization: "Bearer agent", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.authorization != "" {
+				req.Header.Set(echo.HeaderAuthorization, tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+			if tt.wantCode == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", rec.Header().Get(echo.HeaderWWWAuthenticate))
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileKeyStore
+// Хранилище API ключей в JSON файле со списком APIKey
+// Файл читается при создании и перезаписывается при создании и отзыве ключей
+// Для первоначальной настройки ключ можно добавить в файл вручную, token_hash - sha256 токена в hex
+type FileKeyStore struct {
+	mu   sync.RWMutex
+	path string
+	keys []APIKey
+}
+
+// NewFileKeyStore
+// Создает FileKeyStore и загружает ключи из файла path, отсутствующий файл считается пустым списком
+func NewFileKeyStore(path string) (*FileKeyStore, error) {
+	s := &FileKeyStore{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.keys); err != nil {
+		return nil, fmt.Errorf("unable to parse api keys file: %w", err)
+	}
+
+	names := make(map[string]struct{}, len(s.keys))
+	for i := range s.keys {
+		if err := s.keys[i].Validate(); err != nil {
+			return nil, fmt.Errorf("api key %d: %w", i, err)
+		}
+		if _, ok := names[s.keys[i].Name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrKeyExists, s.keys[i].Name)
+		}
+		names[s.keys[i].Name] = struct{}{}
+	}
+	return s, nil
+}
+
+func (s *FileKeyStore) Lookup(_ context.Context, tokenHash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.TokenHash == tokenHash {
+			return &k, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (s *FileKeyStore) List(_ context.Context) ([]APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]APIKey, len(s.keys))
+	copy(keys, s.keys)
+	return keys, nil
+}
+
+func (s *FileKeyStore) Create(_ context.Context, key APIKey) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now().UTC()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.keys {
+		if k.Name == key.Name || k.TokenHash == key.TokenHash {
+			return ErrKeyExists
+		}
+	}
+	keys := append(s.keys[:len(s.keys):len(s.keys)], key)
+	if err := s.save(keys); err != nil {
+		return err
+	}
+	s.keys = keys
+	return nil
+}
+
+func (s *FileKeyStore) Revoke(_ context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]APIKey, len(s.keys))
+	copy(keys, s.keys)
+	for i := range keys {
+		if keys[i].Name != name {
+			continue
+		}
+		if keys[i].RevokedAt == nil {
+			now := time.Now().UTC()
+			keys[i].RevokedAt = &now
+		}
+		if err := s.save(keys); err != nil {
+			return err
+		}
+		s.keys = keys
+		return nil
+	}
+	return ErrKeyNotFound
+}
+
+// save
+// Записывает ключи во временный файл и переименовывает его, чтобы файл не оставался частично записанным
+func (s *FileKeyStore) save(keys []APIKey) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contextKey ключ echo.Context, под которым сохраняется аутентифицированный ключ
+const contextKey = "api_key"
+
+// Middleware
+// Реализует мидлвэр, который аутентифицирует запрос по токену из заголовка Authorization: Bearer <token>
+// и проверяет доступ ключа к области scope
+// Запрос без токена, с неизвестным или отозванным токеном отклоняется со статусом 401, без нужной области - 403
+func Middleware(store KeyStore, scope Scope) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			token := BearerToken(c.Request().Header.Get(echo.HeaderAuthorization))
+			key, err := Authenticate(c.Request().Context(), store, token, scope)
+			switch {
+			case errors.Is(err, ErrKeyNotFound):
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+				return echo.NewHTTPError(http.StatusUnauthorized, "invalid api key")
+			case errors.Is(err, ErrForbidden):
+				return echo.NewHTTPError(http.StatusForbidden, "api key scope is not allowed")
+			case err != nil:
+				return echo.ErrInternalServerError
+			}
+			c.Set(contextKey, key)
+			return next(c)
+		}
+	}
+}
+
+// FromContext
+// Возвращает ключ, аутентифицированный Middleware
+func FromContext(c echo.Context) (*APIKey, bool) {
+	key, ok := c.Get(contextKey).(*APIKey)
+	return key, ok
+}
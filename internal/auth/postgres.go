@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// uniqueViolation код ошибки PostgreSQL при нарушении уникальности
+const uniqueViolation = "23505"
+
+// PostgresKeyStore
+// Хранилище API ключей в таблице metrics.api_keys
+type PostgresKeyStore struct {
+	conn *pgxpool.Pool
+}
+
+func NewPostgresKeyStore(conn *pgxpool.Pool) *PostgresKeyStore {
+	return &PostgresKeyStore{conn: conn}
+}
+
+func (s *PostgresKeyStore) Lookup(ctx context.Context, tokenHash string) (*APIKey, error) {
+	row := s.conn.QueryRow(ctx,
+		`SELECT name, token_hash, scopes, created_at, revoked_at FROM metrics.api_keys WHERE token_hash = $1`,
+		tokenHash,
+	)
+	key, err := scanKey(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (s *PostgresKeyStore) List(ctx context.Context) ([]APIKey, error) {
+	rows, err := s.conn.Query(ctx,
+		`SELECT name, token_hash, scopes, created_at, revoked_at FROM metrics.api_keys ORDER BY name`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *PostgresKeyStore) Create(ctx context.Context, key APIKey) error {
+	if err := key.Validate(); err != nil {
+		return err
+	}
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now().UTC()
+	}
+	scopes := make([]string, len(key.Scopes))
+	for i, scope := range key.Scopes {
+		scopes[i] = string(scope)
+	}
+	_, err := s.conn.Exec(ctx,
+		`INSERT INTO metrics.api_keys (name, token_hash, scopes, created_at) VALUES ($1, $2, $3, $4)`,
+		key.Name, key.TokenHash, scopes, key.CreatedAt,
+	)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return ErrKeyExists
+	}
+	return err
+}
+
+func (s *PostgresKeyStore) Revoke(ctx context.Context, name string) error {
+	tag, err := s.conn.Exec(ctx,
+		`UPDATE metrics.api_keys SET revoked_at = COALESCE(revoked_at, current_timestamp) WHERE name = $1`,
+		name,
+	)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func scanKey(row pgx.Row) (*APIKey, error) {
+	var key APIKey
+	var scopes []string
+	if err := row.Scan(&key.Name, &key.TokenHash, &scopes, &key.CreatedAt, &key.RevokedAt); err != nil {
+		return nil, err
+	}
+	key.Scopes = make([]Scope, len(scopes))
+	for i, scope := range scopes {
+		key.Scopes[i] = Scope(scope)
+	}
+	return &key, nil
+}
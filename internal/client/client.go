@@ -22,6 +22,7 @@ const (
 )
 
 var errValidationName = fmt.Errorf("min name len 1")
+var errUnsupportedType = fmt.Errorf("metric type is not supported by url api")
 
 type errHTTP struct {
 	Err error
@@ -31,6 +32,10 @@ func (e errHTTP) Error() string {
 	return e.Err.Error()
 }
 
+func (e errHTTP) Unwrap() error {
+	return e.Err
+}
+
 type errUnexpectedResponse struct {
 	StatusCode int
 	Message    []byte
@@ -74,6 +79,8 @@ func (c *Client) Send(m *model.Metric) error {
 		reqURL, _ = url.JoinPath(
 			c.address, counterEndpointPrefix, m.Name, m.ValueAsString(),
 		)
+	default:
+		return errUnsupportedType
 	}
 
 	return c.makeRequest(reqURL, "text/plain", http.NoBody)
@@ -89,8 +96,9 @@ func (c *Client) Update(m *model.Metric) error {
 	reqURL, _ := url.JoinPath(c.address, updateEndpointPrefix)
 
 	bodyMessage := handler.Metrics{
-		ID:    m.Name,
-		MType: m.Type.String(),
+		ID:     m.Name,
+		MType:  m.Type.String(),
+		Labels: m.Labels,
 	}
 
 	switch m.Type {
@@ -98,6 +106,10 @@ func (c *Client) Update(m *model.Metric) error {
 		bodyMessage.Value = &m.Gauge
 	case model.MetricTypeCounter:
 		bodyMessage.Delta = &m.Counter
+	case model.MetricTypeHistogram:
+		bodyMessage.Histogram = m.Histogram
+	case model.MetricTypeSummary:
+		bodyMessage.Observations = m.Observations
 	}
 
 	body := new(bytes.Buffer)
@@ -119,14 +131,19 @@ func (c *Client) Updates(metrics []model.Metric) error {
 	for i := 0; i < len(metrics); i++ {
 		m := &metrics[i]
 		bodyMetric := handler.Metrics{
-			ID:    m.Name,
-			MType: m.Type.String(),
+			ID:     m.Name,
+			MType:  m.Type.String(),
+			Labels: m.Labels,
 		}
 		switch m.Type {
 		case model.MetricTypeGauge:
 			bodyMetric.Value = &m.Gauge
 		case model.MetricTypeCounter:
 			bodyMetric.Delta = &m.Counter
+		case model.MetricTypeHistogram:
+			bodyMetric.Histogram = m.Histogram
+		case model.MetricTypeSummary:
+			bodyMetric.Observations = m.Observations
 		}
 		bodyMessage = append(bodyMessage, bodyMetric)
 	}
@@ -148,7 +165,7 @@ func (c *Client) makeRequest(url string, contentType string, body io.Reader) err
 	req.Header.Set("Content-Type", contentType)
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return errHTTP{Err: fmt.Errorf("request error: %v", err)}
+		return errHTTP{Err: fmt.Errorf("request error: %w", err)}
 	}
 	if resp.StatusCode != http.StatusOK {
 		body, err := io.ReadAll(resp.Body)
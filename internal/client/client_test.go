@@ -1,6 +1,12 @@
 package client
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io"
 	"net/http"
@@ -8,8 +14,13 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	"github.com/soltanat/metrics/internal/handler"
+	"github.com/soltanat/metrics/internal/middleware/decrypt"
+	"github.com/soltanat/metrics/internal/middleware/signature"
 	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/storage"
 )
 
 const (
@@ -181,6 +192,17 @@ func TestUpdate(t *testing.T) {
 			expectedErr:  nil,
 			expectedBody: `{"id":"metric2","type":"counter","delta":10}` + "\n",
 		},
+		{
+			name: "Valid Summary Metric",
+			m: func() *model.Metric {
+				m := model.NewSummary("metric3")
+				m.Observe(0.5)
+				m.Observe(2)
+				return m
+			}(),
+			expectedErr:  nil,
+			expectedBody: `{"id":"metric3","type":"summary","observations":[0.5,2]}` + "\n",
+		},
 		{
 			name: "Invalid Metric (Empty Name)",
 			m: &model.Metric{
@@ -224,3 +246,212 @@ func TestUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdates_Histogram(t *testing.T) {
+	m := model.NewHistogram("latency", []float64{0.5})
+	m.Histogram.Observe(0.1)
+	m.Histogram.Observe(1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		reqBody, err := io.ReadAll(req.Body)
+		assert.NoError(t, err)
+		assert.Equal(t, updatesEndpointPrefix, req.URL.Path)
+		assert.JSONEq(t,
+			`[{"id":"latency","type":"histogram","histogram":{"buckets":[0.5],"counts":[1,1],"sum":1.1,"count":2}}]`,
+			string(reqBody),
+		)
+	}))
+	defer server.Close()
+
+	c := New(server.URL, http.DefaultTransport)
+	assert.NoError(t, c.Updates([]model.Metric{*m}))
+	assert.ErrorIs(t, c.Send(m), errUnsupportedType)
+}
+
+func TestUpdates_Summary(t *testing.T) {
+	m := model.NewSummary("latency")
+	m.Observe(0.1)
+	m.Observe(1)
+	m.Labels = model.Labels{"host": "a"}
+
+	s := storage.NewMemStorage()
+	h := handler.New(s, nil)
+	r, err := handler.SetupRoutes(h, "", []byte(""))
+	require.NoError(t, err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	c := New(server.URL, http.DefaultTransport)
+	require.NoError(t, c.Updates([]model.Metric{*m}))
+
+	stored, err := s.GetSummary("latency", model.Labels{"host": "a"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stored.Summary.Count)
+	assert.InDelta(t, 1.1, stored.Summary.Sum, 1e-9)
+}
+
+func TestClient_StrictEncryption(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)})
+
+	s := storage.NewMemStorage()
+	r, err := handler.SetupRoutes(
+		handler.New(s, nil), "", privatePEM,
+		handler.WithEncryptionPolicy(decrypt.Policy{Default: decrypt.ModeStrict}),
+	)
+	require.NoError(t, err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	transport, err := NewRSAEncryptionTransport(&GzipTransport{Transport: http.DefaultTransport}, publicPEM)
+	require.NoError(t, err)
+	c := New(server.URL, transport)
+
+	require.NoError(t, c.Send(model.NewGauge("send", 1.5)))
+	require.NoError(t, c.Update(model.NewCounter("update", 2)))
+	require.NoError(t, c.Updates([]model.Metric{*model.NewGauge("updates", 3)}))
+
+	gauge, err := s.GetGauge("send", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, gauge.Gauge)
+	counter, err := s.GetCounter("update", nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), counter.Counter)
+	gauge, err = s.GetGauge("updates", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, gauge.Gauge)
+
+	// без шифрования запись отклоняется
+	plain := New(server.URL, http.DefaultTransport)
+	assert.Error(t, plain.Send(model.NewGauge("plain", 1)))
+	assert.Error(t, plain.Update(model.NewGauge("plain", 1)))
+}
+
+func TestSignatureTransport_Response(t *testing.T) {
+	const key = "secret"
+	gzipBody := func(b []byte) []byte {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		_, _ = gw.Write(b)
+		_ = gw.Close()
+		return buf.Bytes()
+	}
+
+	tests := []struct {
+		name    string
+		respond func(rw http.ResponseWriter, nonce string)
+		wantErr bool
+	}{
+		{
+			name: "signed response",
+			respond: func(rw http.ResponseWriter, nonce string) {
+				rw.Header().Set(signature.HeaderSignature, signature.SignResponse(key, nonce, http.StatusOK, []byte(`{"ok":true}`)))
+				_, _ = rw.Write([]byte(`{"ok":true}`))
+			},
+		},
+		{
+			name: "signed gzip response",
+			respond: func(rw http.ResponseWriter, nonce string) {
+				rw.Header().Set(signature.HeaderSignature, signature.SignResponse(key, nonce, http.StatusOK, []byte(`{"ok":true}`)))
+				rw.Header().Set("Content-Encoding", "gzip")
+				_, _ = rw.Write(gzipBody([]byte(`{"ok":true}`)))
+			},
+		},
+		{
+			name: "signed empty response",
+			respond: func(rw http.ResponseWriter, nonce string) {
+				rw.Header().Set(signature.HeaderSignature, signature.SignResponse(key, nonce, http.StatusOK, nil))
+			},
+		},
+		{
+			name: "signed empty gzip response",
+			respond: func(rw http.ResponseWriter, nonce string) {
+				rw.Header().Set(signature.HeaderSignature, signature.SignResponse(key, nonce, http.StatusOK, nil))
+				rw.Header().Set("Content-Encoding", "gzip")
+				_, _ = rw.Write(gzipBody(nil))
+			},
+		},
+		{
+			name: "missing signature",
+			respond: func(rw http.ResponseWriter, nonce string) {
+				_, _ = rw.Write([]byte(`{"ok":true}`))
+			},
+			wantErr: true,
+		},
+		{
+			name: "forged body",
+			respond: func(rw http.ResponseWriter, nonce string) {
+				rw.Header().Set(signature.HeaderSignature, signature.SignResponse(key, nonce, http.StatusOK, []byte(`{"ok":false}`)))
+				_, _ = rw.Write([]byte(`{"ok":true}`))
+			},
+			wantErr: true,
+		},
+		{
+			name: "replayed response",
+			respond: func(rw http.ResponseWriter, nonce string) {
+				rw.Header().Set(signature.HeaderSignature, signature.SignResponse(key, "previous", http.StatusOK, nil))
+			},
+			wantErr: true,
+		},
+		{
+			name: "changed status",
+			respond: func(rw http.ResponseWriter, nonce string) {
+				rw.Header().Set(signature.HeaderSignature, signature.SignResponse(key, nonce, http.StatusInternalServerError, nil))
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+				tt.respond(rw, req.Header.Get(signature.HeaderNonce))
+			}))
+			defer server.Close()
+
+			httpClient := &http.Client{Transport: &SignatureTransport{Transport: http.DefaultTransport, Key: key}}
+			req, err := http.NewRequest(http.MethodPost, server.URL, bytes.NewReader([]byte(`[]`)))
+			require.NoError(t, err)
+			// с явным Accept-Encoding http.Transport не распаковывает ответ сам
+			req.Header.Set("Accept-Encoding", "gzip")
+
+			resp, err := httpClient.Do(req)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrResponseSignature)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			_, err = io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+			assert.Empty(t, resp.Header.Get("Content-Encoding"))
+		})
+	}
+}
+
+func TestClient_SignedResponses(t *testing.T) {
+	const key = "secret"
+	r, err := handler.SetupRoutes(handler.New(storage.NewMemStorage(), nil), key, nil)
+	require.NoError(t, err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	transport := &SignatureTransport{Transport: &GzipTransport{Transport: http.DefaultTransport}, Key: key}
+	c := New(server.URL, transport)
+
+	assert.NoError(t, c.Send(model.NewGauge("send", 1)))
+	assert.NoError(t, c.Update(model.NewCounter("update", 1)))
+	assert.NoError(t, c.Updates([]model.Metric{*model.NewGauge("updates", 1)}))
+
+	// ошибка сервера тоже подписана и возвращается как ответ с неожиданным статусом
+	latency := model.NewHistogram("latency", []float64{0.5})
+	require.NoError(t, c.Updates([]model.Metric{*latency}))
+	latency = model.NewHistogram("latency", []float64{1})
+	err = c.Updates([]model.Metric{*latency})
+	var unexpected errUnexpectedResponse
+	require.ErrorAs(t, err, &unexpected)
+	assert.Equal(t, http.StatusBadRequest, unexpected.StatusCode)
+	assert.ErrorIs(t, New(server.URL, &SignatureTransport{Transport: http.DefaultTransport, Key: "other"}).
+		Send(model.NewGauge("send", 1)), ErrResponseSignature)
+}
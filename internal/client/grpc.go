@@ -0,0 +1,223 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/soltanat/metrics/internal/middleware/signature"
+	"github.com/soltanat/metrics/internal/model"
+	pb "github.com/soltanat/metrics/internal/proto"
+)
+
+// GRPCClient
+// Клиент для отправки метрик по gRPC
+type GRPCClient struct {
+	conn   *grpc.ClientConn
+	client pb.MetricsClient
+}
+
+// NewGRPC
+// Создает gRPC клиент
+// address - адрес gRPC сервера
+// opts - дополнительные опции соединения, например интерсепторы
+// По умолчанию соединение без шифрования, TLS включается опцией grpc.WithTransportCredentials
+func NewGRPC(address string, opts ...grpc.DialOption) (*GRPCClient, error) {
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	conn, err := grpc.Dial(address, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCClient{conn: conn, client: pb.NewMetricsClient(conn)}, nil
+}
+
+// Update
+// Отправляет метрику
+func (c *GRPCClient) Update(metric *model.Metric) error {
+	if len(metric.Name) == 0 {
+		return errValidationName
+	}
+	_, err := c.client.Update(context.Background(), &pb.UpdateRequest{Metric: pb.FromModel(metric, nil)})
+	return err
+}
+
+// Updates
+// Отправляет метрики одним запросом
+func (c *GRPCClient) Updates(metrics []model.Metric) error {
+	req := &pb.UpdateBatchRequest{Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for i := range metrics {
+		req.Metrics = append(req.Metrics, pb.FromModel(&metrics[i], nil))
+	}
+	_, err := c.client.UpdateBatch(context.Background(), req)
+	return err
+}
+
+// Push
+// Открывает поток отправки пакетов метрик
+func (c *GRPCClient) Push(ctx context.Context) (*PushStream, error) {
+	stream, err := c.client.Push(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &PushStream{stream: stream}, nil
+}
+
+// Close
+// Закрывает соединение
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// PushStream
+// Поток отправки пакетов метрик
+type PushStream struct {
+	stream pb.Metrics_PushClient
+}
+
+// Send
+// Отправляет пакет метрик
+// io.EOF означает, что сервер завершил поток, подтверждения можно получить через Close
+func (s *PushStream) Send(batchID uint64, metrics []model.Metric) error {
+	req := &pb.PushRequest{BatchId: batchID, Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for i := range metrics {
+		req.Metrics = append(req.Metrics, pb.FromModel(&metrics[i], nil))
+	}
+	return s.stream.Send(req)
+}
+
+// Close
+// Закрывает поток и возвращает идентификаторы сохраненных и отклоненных сервером пакетов
+// Если сервер завершил поток с ошибкой, вместе с ошибкой возвращаются пакеты, обработанные до нее
+func (s *PushStream) Close() (committed, rejected []uint64, err error) {
+	resp, err := s.stream.CloseAndRecv()
+	if err != nil {
+		trailer := s.stream.Trailer()
+		return pb.ParseBatchIDs(trailer.Get(pb.PushCommittedTrailer)), pb.ParseBatchIDs(trailer.Get(pb.PushRejectedTrailer)), err
+	}
+	return resp.GetCommitted(), resp.GetRejected(), nil
+}
+
+// SignatureInterceptor
+// Подписывает запрос так же, как HTTP API: подпись (см. signature.Sign) детерминированно сериализованного
+// сообщения, время подписи и одноразовое значение передаются в метаданных hashsha256,
+// x-signature-timestamp и x-signature-nonce
+func SignatureInterceptor(key string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		msg, ok := req.(proto.Message)
+		if !ok {
+			return fmt.Errorf("unexpected request type %T", req)
+		}
+		data, err := pb.SigningBytes(msg)
+		if err != nil {
+			return err
+		}
+		timestamp, nonce, err := signingParams()
+		if err != nil {
+			return err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			pb.SignatureHeader, signature.Sign(key, timestamp, nonce, data),
+			pb.SignatureTimestampHeader, timestamp,
+			pb.SignatureNonceHeader, nonce,
+		)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// SignatureStreamInterceptor
+// Подписывает поток: при открытии в метаданных передается подпись полного имени метода,
+// пакеты PushRequest подписываются в поле hash с одноразовым значением пакета (см. pb.StreamNonce)
+func SignatureStreamInterceptor(key string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		timestamp, nonce, err := signingParams()
+		if err != nil {
+			return nil, err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx,
+			pb.SignatureHeader, signature.Sign(key, timestamp, nonce, []byte(method)),
+			pb.SignatureTimestampHeader, timestamp,
+			pb.SignatureNonceHeader, nonce,
+		)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return &signatureClientStream{ClientStream: stream, key: key, timestamp: timestamp, nonce: nonce}, nil
+	}
+}
+
+// signatureClientStream
+// Реализация grpc.ClientStream с подписью отправляемых пакетов
+type signatureClientStream struct {
+	grpc.ClientStream
+	key       string
+	timestamp string
+	nonce     string
+	// seq номер последнего отправленного пакета
+	seq uint64
+}
+
+func (s *signatureClientStream) SendMsg(m any) error {
+	if req, ok := m.(*pb.PushRequest); ok {
+		s.seq++
+		req.Hash = ""
+		data, err := pb.SigningBytes(req)
+		if err != nil {
+			return err
+		}
+		req.Hash = signature.Sign(s.key, s.timestamp, pb.StreamNonce(s.nonce, s.seq), data)
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+// RealIPInterceptor
+// Добавляет адрес агента в метаданные x-real-ip для проверки доверенной подсети на сервере
+func RealIPInterceptor(ip net.IP) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-real-ip", ip.String())
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// RealIPStreamInterceptor
+// Добавляет адрес агента в метаданные x-real-ip потоков
+func RealIPStreamInterceptor(ip net.IP) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-real-ip", ip.String())
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// BearerInterceptor
+// Добавляет API токен агента в метаданные authorization
+func BearerInterceptor(token string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// BearerStreamInterceptor
+// Добавляет API токен агента в метаданные authorization потоков
+func BearerStreamInterceptor(token string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// OutboundIP
+// Возвращает локальный адрес, с которого устанавливается соединение с address
+func OutboundIP(address string) (net.IP, error) {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
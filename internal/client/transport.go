@@ -3,17 +3,21 @@ package client
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/x509"
-	"encoding/pem"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/soltanat/metrics/internal/envelope"
 	"github.com/soltanat/metrics/internal/logger"
+	"github.com/soltanat/metrics/internal/middleware/signature"
 )
 
 // GzipTransport
@@ -67,67 +71,187 @@ func (t *LoggingTransport) RoundTrip(req *http.Request) (*http.Response, error)
 }
 
 // SignatureTransport
-// Транспорт для http клиента с подписью запроса
+// Транспорт для http клиента с подписью запроса и проверкой подписи ответа
+// Подпись - HMAC-SHA256 от времени подписи, случайного одноразового значения и тела запроса,
+// поэтому повторно отправленный перехваченный запрос отклоняется сервером
+// Ответ без подписи или с неверной подписью (см. signature.SignResponse) считается ошибкой ErrResponseSignature
 type SignatureTransport struct {
 	Transport http.RoundTripper
 	Key       string
 }
 
+// ErrResponseSignature
+// Ошибка проверки подписи ответа сервера
+var ErrResponseSignature = errors.New("invalid response signature")
+
 func (t *SignatureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	body := req.Body
-	defer body.Close()
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		err = req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	timestamp, nonceHex, err := signingParams()
+	if err != nil {
+		return nil, err
+	}
 
-	buf := new(bytes.Buffer)
-	teeReader := io.TeeReader(body, buf)
+	req.Header.Set(signature.HeaderTimestamp, timestamp)
+	req.Header.Set(signature.HeaderNonce, nonceHex)
+	req.Header.Set(signature.HeaderSignature, signature.Sign(t.Key, timestamp, nonceHex, body))
 
-	hash := sha256.New()
-	_, err := io.Copy(hash, teeReader)
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	resp, err := t.Transport.RoundTrip(req)
 	if err != nil {
 		return nil, err
 	}
+	if err := t.verify(resp, nonceHex); err != nil {
+		l := logger.Get()
+		l.Error().Err(err).Str("url", req.URL.String()).Int("status", resp.StatusCode).Msg("response signature verification failed")
+		return nil, err
+	}
+	return resp, nil
+}
+
+// signingParams
+// Возвращает время подписи (unix timestamp в секундах) и случайное одноразовое значение в hex
+func signingParams() (string, string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", err
+	}
+	return strconv.FormatInt(time.Now().Unix(), 10), hex.EncodeToString(nonce), nil
+}
+
+// verify
+// Проверяет подпись ответа и заменяет его тело прочитанным, сжатое gzip тело распаковывается,
+// так как сервер подписывает несжатое тело
+func (t *SignatureTransport) verify(resp *http.Response, nonce string) error {
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(resp.Body)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w: %v", ErrResponseSignature, err)
+		}
+		if gr != nil {
+			reader = gr
+		}
+	}
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = int64(len(body))
+		resp.Uncompressed = true
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	got := resp.Header.Get(signature.HeaderSignature)
+	if got == "" {
+		return fmt.Errorf("%w: missing %s header, status %d", ErrResponseSignature, signature.HeaderSignature, resp.StatusCode)
+	}
+	want := signature.SignResponse(t.Key, nonce, resp.StatusCode, body)
+	if !hmac.Equal([]byte(got), []byte(want)) {
+		return fmt.Errorf("%w: status %d", ErrResponseSignature, resp.StatusCode)
+	}
+	return nil
+}
 
-	hash.Write([]byte(t.Key))
-	req.Header.Set("HashSHA256", fmt.Sprintf("%x", hash.Sum(nil)))
+// RealIPTransport
+// Транспорт для http клиента, передающий адрес агента в заголовке X-Real-IP
+type RealIPTransport struct {
+	Transport http.RoundTripper
+	IP        net.IP
+}
 
-	req.Body = io.NopCloser(buf)
+func (t *RealIPTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("X-Real-IP", t.IP.String())
+	return t.Transport.RoundTrip(req)
+}
 
+// BearerTransport
+// Транспорт для http клиента, передающий API токен агента в заголовке Authorization
+type BearerTransport struct {
+	Transport http.RoundTripper
+	Token     string
+}
+
+func (t *BearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+t.Token)
 	return t.Transport.RoundTrip(req)
 }
 
+// RSAEncryptionTransport
+// Транспорт для http клиента с гибридным шифрованием тела запроса:
+// тело шифруется AES-GCM сеансовым ключом, ключ шифруется RSA-OAEP и передается в заголовке X-Encrypted-Key
+// Идентификатор открытого ключа передается в заголовке X-Key-ID, чтобы сервер выбрал соответствующий закрытый ключ
 type RSAEncryptionTransport struct {
 	Transport http.RoundTripper
 	Key       *rsa.PublicKey
+	KeyID     string
 }
 
 func NewRSAEncryptionTransport(transport http.RoundTripper, key []byte) (*RSAEncryptionTransport, error) {
-	block, _ := pem.Decode(key)
-	if block == nil || block.Type != "RSA PUBLIC KEY" {
-		return nil, fmt.Errorf("invalid block type")
-	}
-
-	pubKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	pubKey, err := envelope.ParsePublicKey(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %v", err)
+		return nil, err
 	}
 
 	return &RSAEncryptionTransport{
 		Transport: transport,
 		Key:       pubKey,
+		KeyID:     envelope.KeyID(pubKey),
 	}, nil
 }
 
+// RoundTrip
+// Шифрует тело запросов записи, в том числе пустое тело (например, у Send),
+// чтобы они проходили политику строгого шифрования на сервере. Запросы GET и HEAD передаются как есть
 func (t *RSAEncryptionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead {
+		return t.Transport.RoundTrip(req)
+	}
+
+	if req.Body == nil {
+		return t.seal(req, nil)
+	}
 	bodyBytes, err := io.ReadAll(req.Body)
 	if err != nil {
 		return nil, err
 	}
+	err = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
 
-	cipherText, err := rsa.EncryptPKCS1v15(rand.Reader, t.Key, bodyBytes)
+	return t.seal(req, bodyBytes)
+}
+
+func (t *RSAEncryptionTransport) seal(req *http.Request, bodyBytes []byte) (*http.Response, error) {
+	encryptedKey, cipherText, err := envelope.Seal(t.Key, bodyBytes)
 	if err != nil {
 		return nil, err
 	}
 
 	req.Body = io.NopCloser(bytes.NewBuffer(cipherText))
+	req.ContentLength = int64(len(cipherText))
+	req.Header.Set(envelope.KeyHeader, encryptedKey)
+	if t.KeyID != "" {
+		req.Header.Set(envelope.KeyIDHeader, t.KeyID)
+	}
 
 	return t.Transport.RoundTrip(req)
 }
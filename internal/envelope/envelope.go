@@ -0,0 +1,115 @@
+// Package envelope
+// Гибридное шифрование тела запроса: тело шифруется AES-GCM случайным сеансовым ключом,
+// сеансовый ключ шифруется RSA-OAEP открытым ключом сервера и передается в заголовке
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// KeyHeader
+// Заголовок с зашифрованным RSA-OAEP сеансовым ключом в base64
+const KeyHeader = "X-Encrypted-Key"
+
+// sessionKeySize
+// Размер сеансового ключа AES-256
+const sessionKeySize = 32
+
+// ErrInvalidEnvelope
+// Ошибка расшифровки: поврежденные данные, неверный ключ или отсутствующий заголовок
+var ErrInvalidEnvelope = errors.New("invalid envelope")
+
+// ParsePublicKey
+// Разбирает открытый ключ RSA в формате PEM (RSA PUBLIC KEY)
+func ParsePublicKey(key []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil || block.Type != "RSA PUBLIC KEY" {
+		return nil, fmt.Errorf("invalid block type")
+	}
+	pubKey, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	return pubKey, nil
+}
+
+// ParsePrivateKey
+// Разбирает закрытый ключ RSA в формате PEM (RSA PRIVATE KEY)
+func ParsePrivateKey(key []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, fmt.Errorf("invalid block type")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// Seal
+// Шифрует данные случайным сеансовым ключом
+// Возвращает значение заголовка KeyHeader и шифротекст в виде nonce || AES-GCM(data)
+func Seal(pub *rsa.PublicKey, data []byte) (string, []byte, error) {
+	sessionKey := make([]byte, sessionKeySize)
+	if _, err := rand.Read(sessionKey); err != nil {
+		return "", nil, err
+	}
+
+	gcm, err := newGCM(sessionKey)
+	if err != nil {
+		return "", nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	cipherText := gcm.Seal(nonce, nonce, data, nil)
+
+	encryptedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, sessionKey, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return base64.StdEncoding.EncodeToString(encryptedKey), cipherText, nil
+}
+
+// Open
+// Расшифровывает данные, зашифрованные Seal
+// key - значение заголовка KeyHeader
+func Open(priv *rsa.PrivateKey, key string, cipherText []byte) ([]byte, error) {
+	encryptedKey, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(encryptedKey) == 0 {
+		return nil, fmt.Errorf("%w: invalid key header", ErrInvalidEnvelope)
+	}
+	sessionKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, encryptedKey, nil)
+	if err != nil || len(sessionKey) != sessionKeySize {
+		return nil, fmt.Errorf("%w: unable to decrypt session key", ErrInvalidEnvelope)
+	}
+
+	gcm, err := newGCM(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(cipherText) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: body is too short", ErrInvalidEnvelope)
+	}
+	nonce, sealed := cipherText[:gcm.NonceSize()], cipherText[gcm.NonceSize():]
+	data, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to decrypt body", ErrInvalidEnvelope)
+	}
+	return data, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,97 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func TestSealOpen(t *testing.T) {
+	key := generateKey(t)
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "empty", size: 0},
+		{name: "small", size: 100},
+		{name: "larger than modulus", size: 4096},
+		{name: "several megabytes", size: 8 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := make([]byte, tt.size)
+			_, err := rand.Read(data)
+			require.NoError(t, err)
+
+			header, cipherText, err := Seal(&key.PublicKey, data)
+			require.NoError(t, err)
+			assert.NotEmpty(t, header)
+			assert.Len(t, cipherText, tt.size+12+16)
+
+			got, err := Open(key, header, cipherText)
+			require.NoError(t, err)
+			assert.Equal(t, len(data), len(got))
+			assert.True(t, bytes.Equal(data, got))
+		})
+	}
+}
+
+func TestOpen_Invalid(t *testing.T) {
+	key := generateKey(t)
+	header, cipherText, err := Seal(&key.PublicKey, []byte(`[{"id":"PollCount","type":"counter","delta":1}]`))
+	require.NoError(t, err)
+
+	tampered := append([]byte(nil), cipherText...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	tests := []struct {
+		name       string
+		key        *rsa.PrivateKey
+		header     string
+		cipherText []byte
+	}{
+		{name: "other key", key: generateKey(t), header: header, cipherText: cipherText},
+		{name: "missing header", key: key, header: "", cipherText: cipherText},
+		{name: "invalid header", key: key, header: "not base64", cipherText: cipherText},
+		{name: "tampered body", key: key, header: header, cipherText: tampered},
+		{name: "short body", key: key, header: header, cipherText: cipherText[:4]},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Open(tt.key, tt.header, tt.cipherText)
+			assert.ErrorIs(t, err, ErrInvalidEnvelope)
+		})
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	key := generateKey(t)
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)})
+
+	priv, err := ParsePrivateKey(privatePEM)
+	require.NoError(t, err)
+	assert.True(t, key.Equal(priv))
+
+	pub, err := ParsePublicKey(publicPEM)
+	require.NoError(t, err)
+	assert.True(t, key.PublicKey.Equal(pub))
+
+	_, err = ParsePublicKey(privatePEM)
+	assert.Error(t, err)
+	_, err = ParsePrivateKey([]byte("garbage"))
+	assert.Error(t, err)
+}
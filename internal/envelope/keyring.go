@@ -0,0 +1,160 @@
+package envelope
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// KeyIDHeader
+// Заголовок с идентификатором открытого ключа, которым зашифрован сеансовый ключ (см. KeyID)
+const KeyIDHeader = "X-Key-ID"
+
+// ErrUnknownKey
+// Ошибка расшифровки: закрытый ключ с переданным идентификатором не найден
+var ErrUnknownKey = errors.New("unknown key id")
+
+// KeyID
+// Возвращает идентификатор ключа: первые 8 байт SHA-256 от открытого ключа в формате PKCS#1 DER в hex
+// Идентификатор совпадает для открытого и соответствующего ему закрытого ключа
+func KeyID(pub *rsa.PublicKey) string {
+	sum := sha256.Sum256(x509.MarshalPKCS1PublicKey(pub))
+	return hex.EncodeToString(sum[:8])
+}
+
+// KeyRing
+// Набор закрытых ключей сервера, выбираемых по идентификатору
+// Позволяет менять ключи без остановки сервера: новый ключ добавляется в набор, агенты переводятся на
+// соответствующий ему открытый ключ, после чего старый ключ удаляется. Безопасен для конкурентного использования
+type KeyRing struct {
+	mu   sync.RWMutex
+	keys map[string]*rsa.PrivateKey
+}
+
+// NewKeyRing
+// Создает KeyRing с ключами keys
+func NewKeyRing(keys ...*rsa.PrivateKey) *KeyRing {
+	r := &KeyRing{}
+	r.Set(keys...)
+	return r
+}
+
+// Set
+// Заменяет ключи набора
+func (r *KeyRing) Set(keys ...*rsa.PrivateKey) {
+	m := make(map[string]*rsa.PrivateKey, len(keys))
+	for _, key := range keys {
+		m[KeyID(&key.PublicKey)] = key
+	}
+	r.mu.Lock()
+	r.keys = m
+	r.mu.Unlock()
+}
+
+// Load
+// Заменяет ключи набора ключами из файлов paths
+// Путь может указывать на файл закрытого ключа в формате PEM или на каталог, из которого загружаются
+// закрытые ключи RSA из файлов *.pem (остальные файлы, например открытые ключи, пропускаются)
+// Если хотя бы один ключ не удалось прочитать, набор не меняется
+func (r *KeyRing) Load(paths ...string) error {
+	var keys []*rsa.PrivateKey
+	for _, path := range paths {
+		files, dir, err := keyFiles(path)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("unable to read key %s: %w", file, err)
+			}
+			if block, _ := pem.Decode(data); dir && (block == nil || block.Type != "RSA PRIVATE KEY") {
+				continue
+			}
+			key, err := ParsePrivateKey(data)
+			if err != nil {
+				return fmt.Errorf("unable to parse key %s: %w", file, err)
+			}
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no private keys found in %v", paths)
+	}
+	r.Set(keys...)
+	return nil
+}
+
+// IDs
+// Возвращает отсортированные идентификаторы ключей набора
+func (r *KeyRing) IDs() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := make([]string, 0, len(r.keys))
+	for id := range r.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Len
+// Возвращает количество ключей набора
+func (r *KeyRing) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.keys)
+}
+
+// Open
+// Расшифровывает данные, зашифрованные Seal, ключом с идентификатором id
+// Если id пустой (агент не передал идентификатор), перебираются все ключи набора
+func (r *KeyRing) Open(id, key string, cipherText []byte) ([]byte, error) {
+	r.mu.RLock()
+	keys := r.keys
+	r.mu.RUnlock()
+
+	if id != "" {
+		priv, ok := keys[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownKey, id)
+		}
+		return Open(priv, key, cipherText)
+	}
+
+	err := fmt.Errorf("%w: key ring is empty", ErrInvalidEnvelope)
+	for _, priv := range keys {
+		var data []byte
+		data, err = Open(priv, key, cipherText)
+		if err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+// keyFiles
+// Возвращает файлы ключей по пути и признак того, что путь указывает на каталог
+func keyFiles(path string) ([]string, bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to read key %s: %w", path, err)
+	}
+	if !info.IsDir() {
+		return []string{path}, false, nil
+	}
+	files, err := filepath.Glob(filepath.Join(path, "*.pem"))
+	if err != nil {
+		return nil, true, err
+	}
+	sort.Strings(files)
+	return files, true, nil
+}
@@ -0,0 +1,231 @@
+// Package graphite
+// Прием метрик по текстовому протоколу Graphite через TCP: строки "path value timestamp"
+package graphite
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/soltanat/metrics/internal/logger"
+	"github.com/soltanat/metrics/internal/middleware/subnet"
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+const (
+	// DefaultBatchSize
+	// Количество метрик, сохраняемых одним вызовом StoreBatch
+	DefaultBatchSize = 1000
+	// flushInterval
+	// Максимальное время ожидания неполного пакета перед сохранением
+	flushInterval = time.Second
+)
+
+// ParseLine
+// Разбирает строку "path value [timestamp]", метка времени проверяется, но не используется
+func ParseLine(line string) (string, float64, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 2 && len(fields) != 3 {
+		return "", 0, fmt.Errorf("invalid line %q: expected path, value and timestamp", line)
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return "", 0, fmt.Errorf("invalid line %q: invalid value %q", line, fields[1])
+	}
+	if len(fields) == 3 {
+		if _, err := strconv.ParseFloat(fields[2], 64); err != nil {
+			return "", 0, fmt.Errorf("invalid line %q: invalid timestamp %q", line, fields[2])
+		}
+	}
+	return fields[0], value, nil
+}
+
+// Server
+// TCP сервер Graphite: принимает строки, преобразует пути в имена метрик по шаблонам и сохраняет значения как gauge
+// Метрики всех соединений сохраняются пакетами по batchSize, неполный пакет сохраняется не позже чем через секунду
+type Server struct {
+	addr      string
+	storage   storage.Storage
+	templates []Template
+	batchSize int
+	trusted   *net.IPNet
+	listener  net.Listener
+	metrics   chan model.Metric
+	conns     map[net.Conn]struct{}
+	closed    bool
+	mu        sync.Mutex
+	wg        sync.WaitGroup
+	writeDone chan struct{}
+}
+
+// New
+// Инициализирует Server
+// addr - адрес TCP, templates - шаблоны имен метрик, batchSize - размер пакета, DefaultBatchSize если не больше 0
+func New(addr string, s storage.Storage, templates []Template, batchSize int) *Server {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &Server{
+		addr:      addr,
+		storage:   s,
+		templates: templates,
+		batchSize: batchSize,
+		metrics:   make(chan model.Metric, batchSize),
+		conns:     make(map[net.Conn]struct{}),
+		writeDone: make(chan struct{}),
+	}
+}
+
+// WithTrustedSubnet
+// Принимать соединения только с адресов из доверенной подсети
+func (s *Server) WithTrustedSubnet(trusted *net.IPNet) *Server {
+	s.trusted = trusted
+	return s
+}
+
+// Addr
+// Возвращает адрес, на котором запущен сервер
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Start
+// Начинает прием соединений
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.listener = listener
+
+	go s.write()
+	s.wg.Add(1)
+	go s.accept()
+	return nil
+}
+
+// Stop
+// Закрывает соединения и сохраняет принятые значения
+func (s *Server) Stop() {
+	_ = s.listener.Close()
+	s.mu.Lock()
+	s.closed = true
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+
+	close(s.metrics)
+	<-s.writeDone
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	l := logger.Get()
+
+	for {
+		conn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			l.Error().Err(err).Msg("unable to accept graphite connection")
+			continue
+		}
+		if !subnet.Contains(s.trusted, conn.RemoteAddr()) {
+			l.Warn().Str("remote", conn.RemoteAddr().String()).Msg("graphite connection from untrusted address")
+			_ = conn.Close()
+			continue
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			_ = conn.Close()
+			return
+		}
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.handle(conn)
+	}
+}
+
+// handle
+// Читает строки соединения, некорректные строки пропускаются
+func (s *Server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+	l := logger.Get()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		path, value, err := ParseLine(line)
+		if err != nil {
+			l.Error().Err(err).Str("remote", conn.RemoteAddr().String()).Msg("unable to parse graphite line")
+			continue
+		}
+		s.metrics <- *model.NewGauge(MetricName(s.templates, path), value)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		l.Error().Err(err).Str("remote", conn.RemoteAddr().String()).Msg("unable to read graphite connection")
+	}
+}
+
+// write
+// Сохраняет принятые метрики пакетами
+func (s *Server) write() {
+	defer close(s.writeDone)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]model.Metric, 0, s.batchSize)
+	for {
+		select {
+		case m, ok := <-s.metrics:
+			if !ok {
+				s.store(batch)
+				return
+			}
+			batch = append(batch, m)
+			if len(batch) >= s.batchSize {
+				s.store(batch)
+				batch = make([]model.Metric, 0, s.batchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				s.store(batch)
+				batch = make([]model.Metric, 0, s.batchSize)
+			}
+		}
+	}
+}
+
+func (s *Server) store(batch []model.Metric) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := s.storage.StoreBatch(batch); err != nil {
+		l := logger.Get()
+		l.Error().Err(err).Int("metrics", len(batch)).Msg("unable to store graphite metrics")
+	}
+}
@@ -0,0 +1,117 @@
+package graphite
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name      string
+		line      string
+		wantPath  string
+		wantValue float64
+		wantErr   bool
+	}{
+		{name: "with timestamp", line: "servers.web1.load 0.75 1700000000", wantPath: "servers.web1.load", wantValue: 0.75},
+		{name: "without timestamp", line: "servers.web1.load 2", wantPath: "servers.web1.load", wantValue: 2},
+		{name: "float timestamp", line: "servers.web1.load 2 1700000000.5", wantPath: "servers.web1.load", wantValue: 2},
+		{name: "missing value", line: "servers.web1.load", wantErr: true},
+		{name: "invalid value", line: "servers.web1.load abc 1700000000", wantErr: true},
+		{name: "not finite", line: "servers.web1.load nan 1700000000", wantErr: true},
+		{name: "invalid timestamp", line: "servers.web1.load 1 now", wantErr: true},
+		{name: "extra fields", line: "servers.web1.load 1 1700000000 x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, value, err := ParseLine(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantPath, path)
+			assert.Equal(t, tt.wantValue, value)
+		})
+	}
+}
+
+func TestServer(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]model.Metric
+	s := &storage.MockStorage{}
+	s.On("StoreBatch", mock.Anything).Run(func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, args.Get(0).([]model.Metric))
+	}).Return(nil)
+
+	template, err := ParseTemplate("servers.<host>.cpu.<core> cpu_<host>_<core>")
+	require.NoError(t, err)
+	server := New("127.0.0.1:0", s, []Template{template}, 3)
+	require.NoError(t, server.Start())
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	for i := 0; i < 4; i++ {
+		_, err = fmt.Fprintf(conn, "servers.web1.cpu.%d %d 1700000000\n", i, i)
+		require.NoError(t, err)
+	}
+	_, err = fmt.Fprintf(conn, "broken line\nservers.web1.load 0.5 1700000000\n")
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	// полный пакет сохраняется сразу, неполный - по таймеру
+	stored := func() []model.Metric {
+		mu.Lock()
+		defer mu.Unlock()
+		var stored []model.Metric
+		for _, batch := range batches {
+			assert.LessOrEqual(t, len(batch), 3)
+			stored = append(stored, batch...)
+		}
+		return stored
+	}
+	require.Eventually(t, func() bool { return len(stored()) == 5 }, 3*time.Second, 10*time.Millisecond)
+	server.Stop()
+
+	assert.Equal(t, []model.Metric{
+		*model.NewGauge("cpu_web1_0", 0),
+		*model.NewGauge("cpu_web1_1", 1),
+		*model.NewGauge("cpu_web1_2", 2),
+		*model.NewGauge("cpu_web1_3", 3),
+		*model.NewGauge("servers.web1.load", 0.5),
+	}, stored())
+}
+
+func TestServer_TrustedSubnet(t *testing.T) {
+	s := &storage.MockStorage{}
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	server := New("127.0.0.1:0", s, nil, 1).WithTrustedSubnet(trusted)
+	require.NoError(t, server.Start())
+
+	conn, err := net.Dial("tcp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, _ = fmt.Fprintf(conn, "servers.web1.load 0.5 1700000000\n")
+
+	// соединение с адреса вне доверенной подсети закрывается сервером
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Error(t, err)
+	server.Stop()
+
+	s.AssertNotCalled(t, "StoreBatch", mock.Anything)
+}
@@ -0,0 +1,188 @@
+package graphite
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidTemplate
+// Ошибка разбора шаблона
+var ErrInvalidTemplate = errors.New("invalid template")
+
+// Template
+// Шаблон преобразования пути Graphite в имя метрики: "pattern name"
+// pattern - сегменты пути через точку: литерал, * или именованный сегмент <name>
+// name - имя метрики, в котором $N заменяется на N-й совпавший шаблонный сегмент (* или <name>),
+// а <name> - на именованный сегмент
+// Например "servers.<host>.cpu.<core> cpu_<host>_<core>" или "servers.*.cpu.* cpu_$1_$2"
+// преобразуют servers.web1.cpu.0 в cpu_web1_0
+type Template struct {
+	Expr     string
+	segments []string
+	name     string
+}
+
+// ParseTemplate
+// Разбирает шаблон "pattern name"
+func ParseTemplate(raw string) (Template, error) {
+	fields := strings.Fields(raw)
+	if len(fields) != 2 {
+		return Template{}, fmt.Errorf("%w %q: expected pattern and name", ErrInvalidTemplate, raw)
+	}
+	t := Template{Expr: raw, segments: strings.Split(fields[0], "."), name: fields[1]}
+
+	wildcards := 0
+	names := make(map[string]struct{})
+	for _, segment := range t.segments {
+		switch {
+		case segment == "":
+			return Template{}, fmt.Errorf("%w %q: empty path segment", ErrInvalidTemplate, raw)
+		case segment == "*":
+			wildcards++
+		case isNamed(segment):
+			wildcards++
+			names[segment] = struct{}{}
+		}
+	}
+
+	// все подстановки имени должны ссылаться на сегменты шаблона
+	for _, ref := range references(t.name) {
+		if strings.HasPrefix(ref, "$") {
+			n, _ := strconv.Atoi(ref[1:])
+			if n < 1 || n > wildcards {
+				return Template{}, fmt.Errorf("%w %q: %s does not match a wildcard", ErrInvalidTemplate, raw, ref)
+			}
+			continue
+		}
+		if _, ok := names[ref]; !ok {
+			return Template{}, fmt.Errorf("%w %q: %s is not defined in pattern", ErrInvalidTemplate, raw, ref)
+		}
+	}
+	return t, nil
+}
+
+// Apply
+// Возвращает имя метрики для пути, false - если путь не подходит под шаблон
+func (t *Template) Apply(path string) (string, bool) {
+	parts := strings.Split(path, ".")
+	if len(parts) != len(t.segments) {
+		return "", false
+	}
+
+	var matched []string
+	named := make(map[string]string)
+	for i, segment := range t.segments {
+		switch {
+		case segment == "*":
+			matched = append(matched, parts[i])
+		case isNamed(segment):
+			matched = append(matched, parts[i])
+			named[segment] = parts[i]
+		case segment != parts[i]:
+			return "", false
+		}
+	}
+
+	name := expand(t.name, func(ref string) string {
+		if strings.HasPrefix(ref, "$") {
+			n, _ := strconv.Atoi(ref[1:])
+			return matched[n-1]
+		}
+		return named[ref]
+	})
+	return name, true
+}
+
+// isNamed
+// Проверяет, что сегмент шаблона именованный: <name>
+func isNamed(segment string) bool {
+	return len(segment) > 2 && strings.HasPrefix(segment, "<") && strings.HasSuffix(segment, ">")
+}
+
+// references
+// Возвращает подстановки $N и <name> в имени метрики в порядке следования
+func references(name string) []string {
+	var refs []string
+	expand(name, func(ref string) string {
+		refs = append(refs, ref)
+		return ref
+	})
+	return refs
+}
+
+// expand
+// Заменяет подстановки $N и <name> в имени метрики значениями fn
+func expand(name string, fn func(ref string) string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(name); i++ {
+		switch name[i] {
+		case '$':
+			j := i + 1
+			for j < len(name) && name[j] >= '0' && name[j] <= '9' {
+				j++
+			}
+			if j > i+1 {
+				b.WriteString(fn(name[i:j]))
+				i = j - 1
+				continue
+			}
+		case '<':
+			if j := strings.IndexByte(name[i:], '>'); j > 1 {
+				b.WriteString(fn(name[i : i+j+1]))
+				i += j
+				continue
+			}
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+// ReadTemplates
+// Читает шаблоны по одному на строку, пустые строки и строки, начинающиеся с #, пропускаются
+func ReadTemplates(r io.Reader) ([]Template, error) {
+	templates := make([]Template, 0)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		template, err := ParseTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		templates = append(templates, template)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+// LoadTemplates
+// Загружает шаблоны из файла
+func LoadTemplates(path string) ([]Template, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ReadTemplates(f)
+}
+
+// MetricName
+// Возвращает имя метрики по первому подходящему шаблону, если ни один не подошел - путь без изменений
+func MetricName(templates []Template, path string) string {
+	for i := range templates {
+		if name, ok := templates[i].Apply(path); ok {
+			return name
+		}
+	}
+	return path
+}
@@ -0,0 +1,70 @@
+package graphite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate_Apply(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		path     string
+		want     string
+		wantOK   bool
+	}{
+		{name: "named segments", template: "servers.<host>.cpu.<core> cpu_<host>_<core>", path: "servers.web1.cpu.0", want: "cpu_web1_0", wantOK: true},
+		{name: "positional wildcards", template: "servers.*.cpu.* cpu_$1_$2", path: "servers.web1.cpu.0", want: "cpu_web1_0", wantOK: true},
+		{name: "reordered and repeated", template: "servers.<host>.<metric> <metric>.$1.<host>", path: "servers.db.load", want: "load.db.db", wantOK: true},
+		{name: "shortened path", template: "collectd.*.memory.memory-used memory_used", path: "collectd.web1.memory.memory-used", want: "memory_used", wantOK: true},
+		{name: "literal mismatch", template: "servers.*.cpu.* cpu_$1_$2", path: "servers.web1.mem.0", wantOK: false},
+		{name: "length mismatch", template: "servers.*.cpu.* cpu_$1_$2", path: "servers.web1.cpu.0.idle", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := ParseTemplate(tt.template)
+			require.NoError(t, err)
+
+			got, ok := template.Apply(tt.path)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseTemplate_Invalid(t *testing.T) {
+	for _, raw := range []string{
+		"servers.*.cpu.*",
+		"servers.*.cpu.* cpu $1",
+		"servers..cpu cpu",
+		"servers.*.cpu cpu_$2",
+		"servers.*.cpu cpu_$0",
+		"servers.<host>.cpu cpu_<core>",
+	} {
+		t.Run(raw, func(t *testing.T) {
+			_, err := ParseTemplate(raw)
+			assert.ErrorIs(t, err, ErrInvalidTemplate)
+		})
+	}
+}
+
+func TestReadTemplates(t *testing.T) {
+	templates, err := ReadTemplates(strings.NewReader(`
+# cpu per core
+servers.<host>.cpu.<core> cpu_<host>_<core>
+
+servers.*.* $2
+`))
+	require.NoError(t, err)
+	require.Len(t, templates, 2)
+
+	assert.Equal(t, "cpu_web1_0", MetricName(templates, "servers.web1.cpu.0"))
+	assert.Equal(t, "load", MetricName(templates, "servers.web1.load"))
+	assert.Equal(t, "other.metric.path", MetricName(templates, "other.metric.path"))
+
+	_, err = ReadTemplates(strings.NewReader("servers.*.cpu.* cpu_$1_$2\nbroken"))
+	assert.ErrorContains(t, err, "line 2")
+}
@@ -0,0 +1,78 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/soltanat/metrics/internal/auth"
+	pb "github.com/soltanat/metrics/internal/proto"
+)
+
+// methodScopes
+// Области доступа, необходимые для вызова методов сервиса Metrics
+var methodScopes = map[string]auth.Scope{
+	pb.Metrics_Update_FullMethodName:      auth.ScopeWrite,
+	pb.Metrics_UpdateBatch_FullMethodName: auth.ScopeWrite,
+	pb.Metrics_Push_FullMethodName:        auth.ScopeWrite,
+	pb.Metrics_Value_FullMethodName:       auth.ScopeRead,
+	pb.Metrics_List_FullMethodName:        auth.ScopeRead,
+}
+
+// isWriteMethod
+// Проверяет, что метод сервиса Metrics сохраняет метрики
+func isWriteMethod(method string) bool {
+	return methodScopes[method] == auth.ScopeWrite
+}
+
+// AuthInterceptor
+// Аутентифицирует запросы по токену из метаданных authorization вида Bearer <token>
+// Методы записи требуют область write, методы чтения - read, остальные методы - admin
+func AuthInterceptor(store auth.KeyStore) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := authenticate(ctx, store, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// AuthStreamInterceptor
+// Аутентифицирует потоки по токену из метаданных authorization
+func AuthStreamInterceptor(store auth.KeyStore) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := authenticate(ss.Context(), store, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func authenticate(ctx context.Context, store auth.KeyStore, method string) error {
+	scope, ok := methodScopes[method]
+	if !ok {
+		scope = auth.ScopeAdmin
+	}
+
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = auth.BearerToken(values[0])
+		}
+	}
+
+	_, err := auth.Authenticate(ctx, store, token, scope)
+	switch {
+	case errors.Is(err, auth.ErrKeyNotFound):
+		return status.Error(codes.Unauthenticated, "invalid api key")
+	case errors.Is(err, auth.ErrForbidden):
+		return status.Error(codes.PermissionDenied, "api key scope is not allowed")
+	case err != nil:
+		return status.Error(codes.Internal, "unable to authenticate")
+	}
+	return nil
+}
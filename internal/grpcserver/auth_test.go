@@ -0,0 +1,67 @@
+package grpcserver
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/soltanat/metrics/internal/auth"
+	"github.com/soltanat/metrics/internal/client"
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+func TestAuthInterceptor(t *testing.T) {
+	keys, err := auth.NewFileKeyStore(filepath.Join(t.TempDir(), "keys.json"))
+	require.NoError(t, err)
+	for token, scope := range map[string]auth.Scope{"agent": auth.ScopeWrite, "grafana": auth.ScopeRead} {
+		require.NoError(t, keys.Create(context.Background(), auth.APIKey{
+			Name: token, TokenHash: auth.HashToken(token), Scopes: []auth.Scope{scope},
+		}))
+	}
+
+	s := &storage.MockStorage{}
+	s.On("StoreBatch", mock.Anything).Return(nil)
+	dialer := startServer(t, s, AuthInterceptor(keys), AuthStreamInterceptor(keys))
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode codes.Code
+	}{
+		{name: "write key", token: "agent", wantCode: codes.OK},
+		{name: "read key", token: "grafana", wantCode: codes.PermissionDenied},
+		{name: "unknown key", token: "other", wantCode: codes.Unauthenticated},
+		{name: "without key", wantCode: codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []grpc.DialOption{dialer}
+			if tt.token != "" {
+				opts = append(opts,
+					grpc.WithUnaryInterceptor(client.BearerInterceptor(tt.token)),
+					grpc.WithStreamInterceptor(client.BearerStreamInterceptor(tt.token)),
+				)
+			}
+			cli, err := client.NewGRPC("bufnet", opts...)
+			require.NoError(t, err)
+			defer cli.Close()
+
+			err = cli.Updates([]model.Metric{*model.NewGauge("Alloc", 1)})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+
+			stream, err := cli.Push(context.Background())
+			require.NoError(t, err)
+			_ = stream.Send(1, []model.Metric{*model.NewGauge("Alloc", 1)})
+			_, _, err = stream.Close()
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
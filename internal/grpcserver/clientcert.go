@@ -0,0 +1,102 @@
+package grpcserver
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/soltanat/metrics/internal/tlsconfig"
+)
+
+// ClientCertInterceptor
+// Пропускает запросы методов записи только с проверенным сертификатом клиента, методы чтения не проверяются,
+// как и в HTTP API (см. clientcert.ClientCertMiddleware)
+// allowed - разрешенные имена клиентов, если пустой - разрешен любой сертификат, выпущенный CA
+func ClientCertInterceptor(allowed []string) grpc.UnaryServerInterceptor {
+	check := clientCertChecker(allowed)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if isWriteMethod(info.FullMethod) {
+			if err := check(ctx); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ClientCertStreamInterceptor
+// Пропускает потоки методов записи только с проверенным сертификатом клиента
+func ClientCertStreamInterceptor(allowed []string) grpc.StreamServerInterceptor {
+	check := clientCertChecker(allowed)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isWriteMethod(info.FullMethod) {
+			if err := check(ss.Context()); err != nil {
+				return err
+			}
+		}
+		return handler(srv, ss)
+	}
+}
+
+func clientCertChecker(allowed []string) func(ctx context.Context) error {
+	names := make(map[string]struct{}, len(allowed))
+	for _, name := range allowed {
+		names[name] = struct{}{}
+	}
+	return func(ctx context.Context) error {
+		p, ok := peer.FromContext(ctx)
+		if !ok {
+			return status.Error(codes.PermissionDenied, "client certificate is required")
+		}
+		info, ok := p.AuthInfo.(credentials.TLSInfo)
+		if !ok {
+			return status.Error(codes.PermissionDenied, "client certificate is required")
+		}
+		identity, ok := tlsconfig.Identity(&info.State)
+		if !ok {
+			return status.Error(codes.PermissionDenied, "client certificate is required")
+		}
+		if _, ok := names[identity]; len(names) > 0 && !ok {
+			return status.Error(codes.PermissionDenied, "client certificate is not allowed")
+		}
+		return nil
+	}
+}
+
+// TLSRequiredInterceptor
+// Пропускает запросы методов записи только по соединениям с TLS, методы чтения не проверяются
+// Используется, когда политика шифрования требует защищенной передачи метрик
+func TLSRequiredInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if isWriteMethod(info.FullMethod) && !isTLS(ctx) {
+			return nil, status.Error(codes.FailedPrecondition, "tls is required")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// TLSRequiredStreamInterceptor
+// Пропускает потоки методов записи только по соединениям с TLS
+func TLSRequiredStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if isWriteMethod(info.FullMethod) && !isTLS(ss.Context()) {
+			return status.Error(codes.FailedPrecondition, "tls is required")
+		}
+		return handler(srv, ss)
+	}
+}
+
+// isTLS
+// Проверяет, что запрос принят по соединению с TLS
+func isTLS(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	_, ok = p.AuthInfo.(credentials.TLSInfo)
+	return ok
+}
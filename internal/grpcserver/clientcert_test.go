@@ -0,0 +1,182 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/soltanat/metrics/internal/client"
+	"github.com/soltanat/metrics/internal/model"
+	pb "github.com/soltanat/metrics/internal/proto"
+	"github.com/soltanat/metrics/internal/storage"
+	"github.com/soltanat/metrics/internal/tlsconfig"
+)
+
+func keyPair(t *testing.T, c *tlsconfig.Certificate) tls.Certificate {
+	keyPEM, err := c.KeyPEM()
+	require.NoError(t, err)
+	pair, err := tls.X509KeyPair(c.CertPEM(), keyPEM)
+	require.NoError(t, err)
+	return pair
+}
+
+func TestClientCertInterceptor(t *testing.T) {
+	ca, err := tlsconfig.NewCA("test CA", time.Hour)
+	require.NoError(t, err)
+	serverCert, err := ca.Issue("server", []string{"bufnet"}, tlsconfig.UsageServer, time.Hour)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+
+	s := &storage.MockStorage{}
+	s.On("StoreBatch", mock.Anything).Return(nil)
+	s.On("GetList").Return([]model.Metric{}, nil)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(&tls.Config{
+			Certificates: []tls.Certificate{keyPair(t, serverCert)},
+			ClientCAs:    pool,
+			ClientAuth:   tls.VerifyClientCertIfGiven,
+		})),
+		grpc.UnaryInterceptor(ClientCertInterceptor([]string{"agent-1"})),
+		grpc.StreamInterceptor(ClientCertStreamInterceptor([]string{"agent-1"})),
+	)
+	pb.RegisterMetricsServer(server, New(s, nil))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+	dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	})
+
+	tests := []struct {
+		name     string
+		clientCN string
+		call     func(cli *client.GRPCClient, conn pb.MetricsClient) error
+		wantCode codes.Code
+	}{
+		{name: "allowed agent", clientCN: "agent-1", call: updates, wantCode: codes.OK},
+		{name: "other agent", clientCN: "agent-2", call: updates, wantCode: codes.PermissionDenied},
+		{name: "without certificate", call: updates, wantCode: codes.PermissionDenied},
+		{name: "push without certificate", call: push, wantCode: codes.PermissionDenied},
+		{name: "push by allowed agent", clientCN: "agent-1", call: push, wantCode: codes.OK},
+		{name: "read without certificate", call: list, wantCode: codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &tls.Config{RootCAs: pool, ServerName: "bufnet"}
+			if tt.clientCN != "" {
+				c, err := ca.Issue(tt.clientCN, nil, tlsconfig.UsageClient, time.Hour)
+				require.NoError(t, err)
+				cfg.Certificates = []tls.Certificate{keyPair(t, c)}
+			}
+			creds := grpc.WithTransportCredentials(credentials.NewTLS(cfg))
+			cli, err := client.NewGRPC("bufnet", dialer, creds)
+			require.NoError(t, err)
+			defer cli.Close()
+			conn, err := grpc.Dial("bufnet", dialer, creds)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			err = tt.call(cli, pb.NewMetricsClient(conn))
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestTLSRequiredInterceptor(t *testing.T) {
+	ca, err := tlsconfig.NewCA("test CA", time.Hour)
+	require.NoError(t, err)
+	serverCert, err := ca.Issue("server", []string{"bufnet"}, tlsconfig.UsageServer, time.Hour)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+
+	s := &storage.MockStorage{}
+	s.On("StoreBatch", mock.Anything).Return(nil)
+	s.On("GetList").Return([]model.Metric{}, nil)
+
+	tests := []struct {
+		name     string
+		tls      bool
+		wantCode codes.Code
+	}{
+		{name: "tls", tls: true, wantCode: codes.OK},
+		{name: "plaintext", wantCode: codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []grpc.ServerOption{grpc.UnaryInterceptor(TLSRequiredInterceptor())}
+			creds := insecure.NewCredentials()
+			if tt.tls {
+				opts = append(opts, grpc.Creds(credentials.NewTLS(&tls.Config{
+					Certificates: []tls.Certificate{keyPair(t, serverCert)},
+				})))
+				creds = credentials.NewTLS(&tls.Config{RootCAs: pool, ServerName: "bufnet"})
+			}
+			listener := bufconn.Listen(1024 * 1024)
+			server := grpc.NewServer(opts...)
+			pb.RegisterMetricsServer(server, New(s, nil))
+			go func() {
+				_ = server.Serve(listener)
+			}()
+			defer server.Stop()
+			dialer := grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			})
+
+			conn, err := grpc.Dial("bufnet", dialer, grpc.WithTransportCredentials(creds))
+			require.NoError(t, err)
+			defer conn.Close()
+			cli := pb.NewMetricsClient(conn)
+
+			_, err = cli.UpdateBatch(context.Background(), &pb.UpdateBatchRequest{
+				Metrics: []*pb.Metric{{Id: "Alloc", Type: pb.MType_GAUGE, Value: 1}},
+			})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+
+			// методы чтения доступны и без TLS
+			_, err = cli.List(context.Background(), &pb.ListRequest{})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func updates(cli *client.GRPCClient, _ pb.MetricsClient) error {
+	return cli.Updates([]model.Metric{*model.NewGauge("Alloc", 1)})
+}
+
+func push(cli *client.GRPCClient, _ pb.MetricsClient) error {
+	stream, err := cli.Push(context.Background())
+	if err != nil {
+		return err
+	}
+	// io.EOF - сервер завершил поток, статус возвращает Close
+	if err := stream.Send(1, []model.Metric{*model.NewGauge("Alloc", 1)}); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	_, _, err = stream.Close()
+	return err
+}
+
+func list(_ *client.GRPCClient, conn pb.MetricsClient) error {
+	_, err := conn.List(context.Background(), &pb.ListRequest{})
+	return err
+}
@@ -0,0 +1,182 @@
+package grpcserver
+
+import (
+	"context"
+	"crypto/hmac"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/soltanat/metrics/internal/middleware/signature"
+	pb "github.com/soltanat/metrics/internal/proto"
+)
+
+// SignatureInterceptor
+// Проверяет подпись запроса так же, как HTTP API (см. signature.SignatureMiddleware): HMAC-SHA256 от времени подписи,
+// одноразового значения и детерминированно сериализованного сообщения в метаданных hashsha256,
+// x-signature-timestamp и x-signature-nonce
+// В режиме opts.Strict запросы методов записи без подписи отклоняются, без него пропускаются без проверки
+// Подпись ответа (см. signature.SignResponse со статусом codes.OK) добавляется в заголовок hashsha256
+func SignatureInterceptor(key string, opts signature.Options) grpc.UnaryServerInterceptor {
+	verifier := signature.NewVerifier(key, opts)
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		sign := metadataValue(md, pb.SignatureHeader)
+		nonce := ""
+		if sign != "" {
+			msg, ok := req.(proto.Message)
+			if !ok {
+				return nil, status.Error(codes.Internal, "unexpected request type")
+			}
+			data, err := pb.SigningBytes(msg)
+			if err != nil {
+				return nil, status.Error(codes.Internal, "unable to marshal request")
+			}
+			nonce = metadataValue(md, pb.SignatureNonceHeader)
+			if err := verifier.Verify(sign, metadataValue(md, pb.SignatureTimestampHeader), nonce, data); err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+		} else if opts.Strict && isWriteMethod(info.FullMethod) {
+			return nil, status.Error(codes.InvalidArgument, "signature is required")
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if msg, ok := resp.(proto.Message); ok {
+			data, err := pb.SigningBytes(msg)
+			if err != nil {
+				return nil, status.Error(codes.Internal, "unable to marshal response")
+			}
+			_ = grpc.SetHeader(ctx, metadata.Pairs(pb.SignatureHeader, signature.SignResponse(key, nonce, int(codes.OK), data)))
+		}
+		return resp, nil
+	}
+}
+
+// SignatureStreamInterceptor
+// Проверяет подпись потока и его пакетов
+// При открытии потока в метаданных передаются время подписи, одноразовое значение и подпись полного имени метода,
+// каждый пакет PushRequest подписывается в поле hash с одноразовым значением пакета (см. pb.StreamNonce)
+// В подписанном потоке пакеты без подписи отклоняются, в режиме opts.Strict отклоняются потоки методов записи без подписи
+func SignatureStreamInterceptor(key string, opts signature.Options) grpc.StreamServerInterceptor {
+	verifier := signature.NewVerifier(key, opts)
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		sign := metadataValue(md, pb.SignatureHeader)
+		if sign == "" {
+			if opts.Strict && isWriteMethod(info.FullMethod) {
+				return status.Error(codes.InvalidArgument, "signature is required")
+			}
+			return handler(srv, ss)
+		}
+
+		timestamp := metadataValue(md, pb.SignatureTimestampHeader)
+		nonce := metadataValue(md, pb.SignatureNonceHeader)
+		if err := verifier.Verify(sign, timestamp, nonce, []byte(info.FullMethod)); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		return handler(srv, &signatureServerStream{ServerStream: ss, key: key, timestamp: timestamp, nonce: nonce})
+	}
+}
+
+// signatureServerStream
+// Реализация grpc.ServerStream с проверкой подписи принятых пакетов
+type signatureServerStream struct {
+	grpc.ServerStream
+	key       string
+	timestamp string
+	nonce     string
+	// seq номер последнего принятого пакета
+	seq uint64
+}
+
+func (s *signatureServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	req, ok := m.(*pb.PushRequest)
+	if !ok {
+		return nil
+	}
+	s.seq++
+	hash := req.GetHash()
+	if hash == "" {
+		return status.Error(codes.InvalidArgument, "signature is required")
+	}
+	req.Hash = ""
+	data, err := pb.SigningBytes(req)
+	if err != nil {
+		return status.Error(codes.Internal, "unable to marshal request")
+	}
+	sign := signature.Sign(s.key, s.timestamp, pb.StreamNonce(s.nonce, s.seq), data)
+	if !hmac.Equal([]byte(hash), []byte(sign)) {
+		return status.Error(codes.InvalidArgument, "invalid signature")
+	}
+	return nil
+}
+
+// metadataValue
+// Возвращает первое значение ключа метаданных или пустую строку
+func metadataValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// TrustedSubnetInterceptor
+// Пропускает запросы методов записи только с адресов из доверенной подсети, методы чтения не проверяются
+// Адрес берется из метаданных x-real-ip, а если они не переданы - из адреса соединения
+func TrustedSubnetInterceptor(subnet *net.IPNet) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !isWriteMethod(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ip := clientIP(ctx)
+		if ip == nil || !subnet.Contains(ip) {
+			return nil, status.Error(codes.PermissionDenied, "address is not in trusted subnet")
+		}
+		return handler(ctx, req)
+	}
+}
+
+// TrustedSubnetStreamInterceptor
+// Пропускает потоки методов записи только с адресов из доверенной подсети
+func TrustedSubnetStreamInterceptor(subnet *net.IPNet) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !isWriteMethod(info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ip := clientIP(ss.Context())
+		if ip == nil || !subnet.Contains(ip) {
+			return status.Error(codes.PermissionDenied, "address is not in trusted subnet")
+		}
+		return handler(srv, ss)
+	}
+}
+
+// clientIP
+// Возвращает адрес клиента из метаданных x-real-ip или из адреса соединения
+func clientIP(ctx context.Context) net.IP {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-real-ip"); len(values) > 0 {
+			return net.ParseIP(values[0])
+		}
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,167 @@
+// Package grpcserver
+// gRPC сервис Metrics поверх storage.Storage
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/soltanat/metrics/internal/logger"
+	"github.com/soltanat/metrics/internal/model"
+	pb "github.com/soltanat/metrics/internal/proto"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+// MetricsServer
+// Реализует gRPC сервис Metrics
+type MetricsServer struct {
+	pb.UnimplementedMetricsServer
+	storage   storage.Storage
+	quantiles []float64
+	logger    zerolog.Logger
+}
+
+// New
+// Инициализирует MetricsServer
+// quantiles - квантили summary, возвращаемые в Value и List
+func New(s storage.Storage, quantiles []float64) *MetricsServer {
+	return &MetricsServer{storage: s, quantiles: quantiles, logger: logger.Get()}
+}
+
+// Update сохраняет метрику
+func (s *MetricsServer) Update(_ context.Context, req *pb.UpdateRequest) (*pb.UpdateResponse, error) {
+	if req.GetMetric() == nil {
+		return nil, status.Error(codes.InvalidArgument, "metric is required")
+	}
+	metric, err := req.GetMetric().ToModel()
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.storage.Store(metric); err != nil {
+		s.logger.Error().Err(err).Msg("Error storing metric")
+		return nil, storeError(err)
+	}
+	return &pb.UpdateResponse{}, nil
+}
+
+// UpdateBatch сохраняет метрики
+func (s *MetricsServer) UpdateBatch(_ context.Context, req *pb.UpdateBatchRequest) (*pb.UpdateBatchResponse, error) {
+	metrics := make([]model.Metric, 0, len(req.GetMetrics()))
+	for _, m := range req.GetMetrics() {
+		metric, err := m.ToModel()
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		metrics = append(metrics, *metric)
+	}
+	if err := s.storage.StoreBatch(metrics); err != nil {
+		s.logger.Error().Err(err).Msg("Error storing metrics")
+		return nil, storeError(err)
+	}
+	return &pb.UpdateBatchResponse{}, nil
+}
+
+// Value возвращает значение метрики
+// Без меток возвращается единственная серия с таким именем (см. storage.Get)
+func (s *MetricsServer) Value(_ context.Context, req *pb.ValueRequest) (*pb.ValueResponse, error) {
+	metricType, err := pb.ModelType(req.GetType())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var labels model.Labels
+	if len(req.GetLabels()) > 0 {
+		labels = req.GetLabels()
+	}
+	metric, err := storage.Get(s.storage, metricType, req.GetId(), labels)
+	if err != nil {
+		if errors.Is(err, model.ErrMetricNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, model.ErrAmbiguousMetric) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	return &pb.ValueResponse{Metric: pb.FromModel(metric, s.quantiles)}, nil
+}
+
+// List возвращает все метрики
+func (s *MetricsServer) List(_ context.Context, _ *pb.ListRequest) (*pb.ListResponse, error) {
+	metrics, err := s.storage.GetList()
+	if err != nil {
+		return nil, status.Error(codes.Internal, "internal error")
+	}
+	resp := &pb.ListResponse{Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for i := range metrics {
+		resp.Metrics = append(resp.Metrics, pb.FromModel(&metrics[i], s.quantiles))
+	}
+	return resp, nil
+}
+
+// Push сохраняет пакеты метрик из потока по мере поступления
+// Пакет с некорректными метриками отклоняется, остальные пакеты потока продолжают обрабатываться
+// При ошибке хранилища поток завершается со статусом Unavailable, подтверждения уже сохраненных
+// и отклоненных пакетов передаются в trailer (pb.PushCommittedTrailer, pb.PushRejectedTrailer),
+// клиент повторяет отправку остальных
+// При ошибке чтения потока обработка прекращается, клиент получает подтверждения уже сохраненных пакетов
+func (s *MetricsServer) Push(stream pb.Metrics_PushServer) error {
+	resp := &pb.PushResponse{}
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			s.logger.Error().Err(err).Msg("Error receiving batch")
+			if sendErr := stream.SendAndClose(resp); sendErr != nil {
+				return err
+			}
+			return nil
+		}
+
+		metrics := make([]model.Metric, 0, len(req.GetMetrics()))
+		for _, m := range req.GetMetrics() {
+			metric, err := m.ToModel()
+			if err != nil {
+				s.logger.Error().Err(err).Uint64("batch_id", req.GetBatchId()).Msg("Invalid metric in batch")
+				metrics = nil
+				break
+			}
+			metrics = append(metrics, *metric)
+		}
+		if metrics == nil {
+			resp.Rejected = append(resp.Rejected, req.GetBatchId())
+			continue
+		}
+
+		if err := s.storage.StoreBatch(metrics); err != nil {
+			s.logger.Error().Err(err).Uint64("batch_id", req.GetBatchId()).Msg("Error storing batch")
+			if status.Code(storeError(err)) == codes.InvalidArgument {
+				resp.Rejected = append(resp.Rejected, req.GetBatchId())
+				continue
+			}
+			stream.SetTrailer(metadata.Pairs(
+				pb.PushCommittedTrailer, pb.FormatBatchIDs(resp.GetCommitted()),
+				pb.PushRejectedTrailer, pb.FormatBatchIDs(resp.GetRejected()),
+			))
+			return status.Error(codes.Unavailable, "unable to store batch")
+		}
+		resp.Committed = append(resp.Committed, req.GetBatchId())
+	}
+}
+
+// storeError возвращает gRPC ошибку для ошибки сохранения метрики
+func storeError(err error) error {
+	if errors.Is(err, model.ErrHistogramBucketsMismatch) || errors.Is(err, model.ErrInvalidHistogram) ||
+		errors.Is(err, model.ErrSummaryAccuracyMismatch) || errors.Is(err, model.ErrInvalidSummary) {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, "internal error")
+}
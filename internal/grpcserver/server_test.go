@@ -0,0 +1,357 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/soltanat/metrics/internal/client"
+	"github.com/soltanat/metrics/internal/middleware/signature"
+	"github.com/soltanat/metrics/internal/model"
+	pb "github.com/soltanat/metrics/internal/proto"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+// startServer
+// Запускает сервер на bufconn и возвращает опцию соединения с ним
+func startServer(t *testing.T, s storage.Storage, interceptor grpc.UnaryServerInterceptor, streamInterceptors ...grpc.StreamServerInterceptor) grpc.DialOption {
+	var opts []grpc.ServerOption
+	if interceptor != nil {
+		opts = append(opts, grpc.UnaryInterceptor(interceptor))
+	}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(append(opts, grpc.ChainStreamInterceptor(streamInterceptors...))...)
+	pb.RegisterMetricsServer(server, New(s, []float64{0.5}))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	})
+}
+
+func dial(t *testing.T, dialer grpc.DialOption, opts ...grpc.DialOption) pb.MetricsClient {
+	opts = append(opts, dialer, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial("bufnet", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return pb.NewMetricsClient(conn)
+}
+
+func TestMetricsServer_Update(t *testing.T) {
+	tests := []struct {
+		name     string
+		metric   *pb.Metric
+		on       func(s *storage.MockStorage)
+		wantCode codes.Code
+	}{
+		{
+			name:   "gauge with labels",
+			metric: &pb.Metric{Id: "Alloc", Type: pb.MType_GAUGE, Value: 1.5, Labels: map[string]string{"host": "a"}},
+			on: func(s *storage.MockStorage) {
+				m := model.NewGauge("Alloc", 1.5)
+				m.Labels = model.Labels{"host": "a"}
+				s.On("Store", m).Return(nil)
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name:   "counter",
+			metric: &pb.Metric{Id: "PollCount", Type: pb.MType_COUNTER, Delta: 3},
+			on: func(s *storage.MockStorage) {
+				s.On("Store", model.NewCounter("PollCount", 3)).Return(nil)
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "missing metric",
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "unspecified type",
+			metric:   &pb.Metric{Id: "Alloc"},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "invalid histogram",
+			metric:   &pb.Metric{Id: "latency", Type: pb.MType_HISTOGRAM, Histogram: &pb.Histogram{Buckets: []float64{1}}},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:   "buckets mismatch",
+			metric: &pb.Metric{Id: "latency", Type: pb.MType_HISTOGRAM, Histogram: &pb.Histogram{Buckets: []float64{1}, Counts: []int64{1, 0}, Sum: 0.5, Count: 1}},
+			on: func(s *storage.MockStorage) {
+				s.On("Store", mock.Anything).Return(model.ErrHistogramBucketsMismatch)
+			},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &storage.MockStorage{}
+			if tt.on != nil {
+				tt.on(s)
+			}
+			cli := dial(t, startServer(t, s, nil))
+
+			_, err := cli.Update(context.Background(), &pb.UpdateRequest{Metric: tt.metric})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			s.AssertExpectations(t)
+		})
+	}
+}
+
+func TestMetricsServer_Value(t *testing.T) {
+	s := &storage.MockStorage{}
+	gauge := model.NewGauge("Alloc", 2)
+	gauge.Labels = model.Labels{"host": "a"}
+	s.On("GetGauge", "Alloc", model.Labels{"host": "a"}).Return(gauge, nil)
+	s.On("GetCounter", "PollCount", model.Labels(nil)).Return(nil, model.ErrMetricNotFound)
+	summary := model.NewSummary("latency")
+	summary.Summary.Observe(2)
+	s.On("GetSummary", "latency", model.Labels(nil)).Return(summary, nil)
+	s.On("GetList").Return([]model.Metric{*gauge}, nil)
+
+	cli := dial(t, startServer(t, s, nil))
+
+	resp, err := cli.Value(context.Background(), &pb.ValueRequest{Id: "Alloc", Type: pb.MType_GAUGE, Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, resp.GetMetric().GetValue())
+	assert.Equal(t, map[string]string{"host": "a"}, resp.GetMetric().GetLabels())
+
+	_, err = cli.Value(context.Background(), &pb.ValueRequest{Id: "PollCount", Type: pb.MType_COUNTER})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	resp, err = cli.Value(context.Background(), &pb.ValueRequest{Id: "latency", Type: pb.MType_SUMMARY})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), resp.GetMetric().GetSummary().GetCount())
+	assert.InDelta(t, 2, resp.GetMetric().GetSummary().GetQuantiles()["0.5"], 0.05)
+
+	list, err := cli.List(context.Background(), &pb.ListRequest{})
+	require.NoError(t, err)
+	require.Len(t, list.GetMetrics(), 1)
+	assert.Equal(t, "Alloc", list.GetMetrics()[0].GetId())
+}
+
+// signedContext
+// Возвращает контекст с подписью сообщения msg в метаданных
+func signedContext(t *testing.T, key string, signedAt time.Time, nonce string, msg proto.Message) context.Context {
+	data, err := pb.SigningBytes(msg)
+	require.NoError(t, err)
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	return metadata.AppendToOutgoingContext(context.Background(),
+		pb.SignatureHeader, signature.Sign(key, timestamp, nonce, data),
+		pb.SignatureTimestampHeader, timestamp,
+		pb.SignatureNonceHeader, nonce,
+	)
+}
+
+func TestSignatureInterceptor(t *testing.T) {
+	s := &storage.MockStorage{}
+	s.On("StoreBatch", mock.Anything).Return(nil)
+	s.On("GetList").Return([]model.Metric{}, nil)
+	opts := signature.Options{Strict: true, MaxSkew: time.Minute}
+	cli := dial(t, startServer(t, s, SignatureInterceptor("secret", opts)))
+
+	req := &pb.UpdateBatchRequest{Metrics: []*pb.Metric{{Id: "PollCount", Type: pb.MType_COUNTER, Delta: 1}}}
+	tests := []struct {
+		name     string
+		ctx      func() context.Context
+		wantCode codes.Code
+	}{
+		{
+			name:     "valid signature",
+			ctx:      func() context.Context { return signedContext(t, "secret", time.Now(), "n1", req) },
+			wantCode: codes.OK,
+		},
+		{
+			name:     "replayed nonce",
+			ctx:      func() context.Context { return signedContext(t, "secret", time.Now(), "n1", req) },
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "wrong key",
+			ctx:      func() context.Context { return signedContext(t, "wrong", time.Now(), "n2", req) },
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name: "modified message",
+			ctx: func() context.Context {
+				return signedContext(t, "secret", time.Now(), "n3", &pb.UpdateBatchRequest{})
+			},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "stale timestamp",
+			ctx:      func() context.Context { return signedContext(t, "secret", time.Now().Add(-2*time.Minute), "n4", req) },
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "without signature in strict mode",
+			ctx:      context.Background,
+			wantCode: codes.InvalidArgument,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := cli.UpdateBatch(tt.ctx(), req)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+	s.AssertNumberOfCalls(t, "StoreBatch", 1)
+
+	// методы чтения доступны без подписи, ответ подписывается
+	var header metadata.MD
+	resp, err := cli.List(context.Background(), &pb.ListRequest{}, grpc.Header(&header))
+	require.NoError(t, err)
+	data, err := pb.SigningBytes(resp)
+	require.NoError(t, err)
+	assert.Equal(t, []string{signature.SignResponse("secret", "", int(codes.OK), data)}, header.Get(pb.SignatureHeader))
+
+	// клиентский интерсептор подписывает запросы той же схемой
+	signed, err := client.NewGRPC("bufnet", startServer(t, s, SignatureInterceptor("secret", opts)),
+		grpc.WithUnaryInterceptor(client.SignatureInterceptor("secret")))
+	require.NoError(t, err)
+	defer signed.Close()
+	assert.NoError(t, signed.Updates([]model.Metric{*model.NewCounter("PollCount", 1)}))
+	assert.NoError(t, signed.Updates([]model.Metric{*model.NewCounter("PollCount", 1)}))
+}
+
+func TestTrustedSubnetInterceptor(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	s := &storage.MockStorage{}
+	s.On("StoreBatch", mock.Anything).Return(nil)
+	dialer := startServer(t, s, TrustedSubnetInterceptor(subnet))
+
+	tests := []struct {
+		name     string
+		ip       string
+		wantCode codes.Code
+	}{
+		{name: "trusted", ip: "10.1.2.3", wantCode: codes.OK},
+		{name: "untrusted", ip: "192.168.1.1", wantCode: codes.PermissionDenied},
+		{name: "without x-real-ip", wantCode: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []grpc.DialOption
+			if tt.ip != "" {
+				opts = append(opts, grpc.WithUnaryInterceptor(client.RealIPInterceptor(net.ParseIP(tt.ip))))
+			}
+			cli, err := client.NewGRPC("bufnet", append(opts, dialer)...)
+			require.NoError(t, err)
+			defer cli.Close()
+
+			err = cli.Updates([]model.Metric{*model.NewGauge("Alloc", 1)})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+
+	// методы чтения доступны с любых адресов, как и в HTTP API
+	s.On("GetList").Return([]model.Metric{}, nil)
+	cli := dial(t, dialer, grpc.WithUnaryInterceptor(client.RealIPInterceptor(net.ParseIP("192.168.1.1"))))
+	_, err = cli.List(context.Background(), &pb.ListRequest{})
+	assert.NoError(t, err)
+}
+
+func TestMetricsServer_Push(t *testing.T) {
+	s := &storage.MockStorage{}
+	s.On("StoreBatch", []model.Metric{*model.NewCounter("PollCount", 1)}).Return(nil).Once()
+	s.On("StoreBatch", []model.Metric{*model.NewGauge("Alloc", 1)}).Return(errors.New("db is down")).Once()
+
+	cli, err := client.NewGRPC("bufnet", startServer(t, s, nil))
+	require.NoError(t, err)
+	defer cli.Close()
+
+	stream, err := cli.Push(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(1, []model.Metric{*model.NewCounter("PollCount", 1)}))
+	require.NoError(t, stream.Send(2, []model.Metric{{Type: model.MetricTypeHistogram, Name: "latency"}}))
+	require.NoError(t, stream.Send(3, []model.Metric{*model.NewGauge("Alloc", 1)}))
+
+	// после ошибки хранилища сервер завершает поток
+	assert.Eventually(t, func() bool {
+		return stream.Send(4, []model.Metric{*model.NewGauge("Alloc", 2)}) != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// поток завершается с ошибкой, подтверждения пакетов до ошибки передаются в trailer
+	committed, rejected, err := stream.Close()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+	assert.Equal(t, []uint64{1}, committed)
+	assert.Equal(t, []uint64{2}, rejected)
+	s.AssertExpectations(t)
+}
+
+func TestSignatureStreamInterceptor(t *testing.T) {
+	s := &storage.MockStorage{}
+	s.On("StoreBatch", mock.Anything).Return(nil)
+	dialer := startServer(t, s, nil, SignatureStreamInterceptor("secret", signature.Options{Strict: true}))
+
+	tests := []struct {
+		name          string
+		key           string
+		wantCommitted []uint64
+		wantCode      codes.Code
+	}{
+		{name: "valid signature", key: "secret", wantCommitted: []uint64{1, 2}},
+		{name: "invalid signature", key: "wrong", wantCode: codes.InvalidArgument},
+		{name: "without signature in strict mode", wantCode: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []grpc.DialOption
+			if tt.key != "" {
+				opts = append(opts, grpc.WithStreamInterceptor(client.SignatureStreamInterceptor(tt.key)))
+			}
+			cli, err := client.NewGRPC("bufnet", append(opts, dialer)...)
+			require.NoError(t, err)
+			defer cli.Close()
+
+			stream, err := cli.Push(context.Background())
+			require.NoError(t, err)
+			_ = stream.Send(1, []model.Metric{*model.NewCounter("PollCount", 1)})
+			_ = stream.Send(2, []model.Metric{*model.NewCounter("PollCount", 1)})
+			committed, _, err := stream.Close()
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			assert.Equal(t, tt.wantCommitted, committed)
+		})
+	}
+	s.AssertNumberOfCalls(t, "StoreBatch", 2)
+
+	// пакет, подписанный для другой позиции в потоке, не принимается
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	ctx := metadata.AppendToOutgoingContext(context.Background(),
+		pb.SignatureHeader, signature.Sign("secret", timestamp, "n1", []byte(pb.Metrics_Push_FullMethodName)),
+		pb.SignatureTimestampHeader, timestamp,
+		pb.SignatureNonceHeader, "n1",
+	)
+	stream, err := dial(t, dialer).Push(ctx)
+	require.NoError(t, err)
+	req := &pb.PushRequest{BatchId: 1, Metrics: []*pb.Metric{{Id: "PollCount", Type: pb.MType_COUNTER, Delta: 1}}}
+	data, err := pb.SigningBytes(req)
+	require.NoError(t, err)
+	req.Hash = signature.Sign("secret", timestamp, pb.StreamNonce("n1", 2), data)
+	require.NoError(t, stream.Send(req))
+	resp, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Empty(t, resp.GetCommitted())
+	s.AssertNumberOfCalls(t, "StoreBatch", 2)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"errors"
+	"math"
 	"net/http"
 	"strconv"
 
@@ -10,19 +11,65 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog"
 
+	"github.com/soltanat/metrics/internal/alerting"
+	"github.com/soltanat/metrics/internal/auth"
 	"github.com/soltanat/metrics/internal/logger"
 	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/otlp"
 	"github.com/soltanat/metrics/internal/storage"
 )
 
+// DefaultQuantiles квантили summary, возвращаемые по умолчанию
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
 type Handlers struct {
-	storage storage.Storage
-	dbConn  db.Conn
-	logger  zerolog.Logger
+	storage   storage.Storage
+	dbConn    db.Conn
+	logger    zerolog.Logger
+	quantiles []float64
+	alerts    AlertSource
+	keys      auth.KeyStore
+	otlp      *otlp.Converter
+}
+
+// AlertSource источник текущих оповещений
+type AlertSource interface {
+	Alerts() []alerting.Alert
 }
 
 func New(s storage.Storage, dbConn db.Conn) *Handlers {
-	return &Handlers{storage: s, dbConn: dbConn, logger: logger.Get()}
+	return &Handlers{
+		storage:   s,
+		dbConn:    dbConn,
+		logger:    logger.Get(),
+		quantiles: DefaultQuantiles,
+		otlp:      otlp.NewConverter(otlp.DefaultPrefixAttribute),
+	}
+}
+
+// WithQuantiles задает квантили summary, возвращаемые в /value/ и /metrics/
+func (h *Handlers) WithQuantiles(quantiles []float64) *Handlers {
+	h.quantiles = quantiles
+	return h
+}
+
+// WithAlerts задает источник оповещений, возвращаемых в /api/v1/alerts/
+func (h *Handlers) WithAlerts(alerts AlertSource) *Handlers {
+	h.alerts = alerts
+	return h
+}
+
+// WithKeyStore включает аутентификацию запросов по API ключам из keys и маршруты управления ключами /api/v1/keys/
+func (h *Handlers) WithKeyStore(keys auth.KeyStore) *Handlers {
+	h.keys = keys
+	return h
+}
+
+// WithOTLPPrefixAttribute задает атрибут ресурса OTLP, значение которого становится префиксом имени метрики в /v1/metrics/
+// Пустое значение отключает префикс
+func (h *Handlers) WithOTLPPrefixAttribute(attribute string) *Handlers {
+	h.otlp = otlp.NewConverter(attribute)
+	return h
 }
 
 // GetList возвращает все метрики
@@ -40,9 +87,23 @@ func (h *Handlers) GetList(c echo.Context) error {
 	return nil
 }
 
+// Prometheus возвращает все метрики в текстовом формате Prometheus
+func (h *Handlers) Prometheus(c echo.Context) error {
+	metrics, err := h.storage.GetList()
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, prometheusContentType)
+	c.Response().WriteHeader(http.StatusOK)
+	return writePrometheus(c.Response(), metrics, h.quantiles)
+}
+
 // Get возвращает метрику
 // metricType - тип метрики
 // metricName - имя метрики
+// Параметры запроса задают метки метрики, без них возвращается единственная серия с таким именем (см. storage.Get),
+// а если серий несколько - статус 409
 func (h *Handlers) Get(c echo.Context) error {
 	l := logger.Get()
 
@@ -55,20 +116,17 @@ func (h *Handlers) Get(c echo.Context) error {
 		return echo.ErrBadRequest
 	}
 
-	var metric *model.Metric
-
-	switch metricType {
-	case model.MetricTypeGauge:
-		metric, err = h.storage.GetGauge(name)
-	case model.MetricTypeCounter:
-		metric, err = h.storage.GetCounter(name)
+	var labels model.Labels
+	for key, values := range c.QueryParams() {
+		if labels == nil {
+			labels = make(model.Labels)
+		}
+		labels[key] = values[0]
 	}
 
+	metric, err := storage.Get(h.storage, metricType, name, labels)
 	if err != nil {
-		if errors.Is(err, model.ErrMetricNotFound) {
-			return echo.ErrNotFound
-		}
-		return echo.ErrInternalServerError
+		return lookupError(err)
 	}
 	_, _ = c.Response().Write([]byte(metric.ValueAsString()))
 
@@ -108,6 +166,8 @@ func (h *Handlers) Store(c echo.Context) error {
 			return echo.ErrBadRequest
 		}
 		metric = model.NewCounter(name, value)
+	default:
+		return echo.ErrBadRequest
 	}
 
 	err = h.storage.Store(metric)
@@ -135,7 +195,7 @@ func (h *Handlers) StoreMetrics(c echo.Context) error {
 
 	if err := h.storage.Store(metric); err != nil {
 		h.logger.Error().Msgf("Error storing metric: %s", err)
-		return echo.ErrInternalServerError
+		return storeError(err)
 	}
 
 	h.logger.Info().Msg("Metrics stored successfully")
@@ -163,7 +223,7 @@ func (h *Handlers) StoreMetricsBatch(c echo.Context) error {
 
 	if err := h.storage.StoreBatch(metricsToStore); err != nil {
 		h.logger.Error().Msgf("Error storing metric: %s", err)
-		return echo.ErrInternalServerError
+		return storeError(err)
 	}
 
 	h.logger.Info().Msg("Metrics stored successfully")
@@ -194,14 +254,78 @@ func (h *Handlers) update(input Metrics) (*model.Metric, error) {
 			return nil, echo.ErrBadRequest
 		}
 		metric = model.NewCounter(input.ID, *input.Delta)
+	case model.MetricTypeHistogram:
+		if input.Histogram == nil {
+			h.logger.Error().Msg("Missing histogram for histogram metric")
+			return nil, echo.ErrBadRequest
+		}
+		if err := input.Histogram.Validate(); err != nil {
+			h.logger.Error().Err(err).Msg("Invalid histogram")
+			return nil, echo.ErrBadRequest
+		}
+		metric = &model.Metric{
+			Type:      model.MetricTypeHistogram,
+			Name:      input.ID,
+			Histogram: input.Histogram,
+		}
+	case model.MetricTypeSummary:
+		if len(input.Observations) == 0 {
+			h.logger.Error().Msg("Missing observations for summary metric")
+			return nil, echo.ErrBadRequest
+		}
+		metric = model.NewSummary(input.ID)
+		for _, v := range input.Observations {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				h.logger.Error().Msg("Invalid observation for summary metric")
+				return nil, echo.ErrBadRequest
+			}
+			metric.Summary.Observe(v)
+		}
 	default:
 		h.logger.Error().Msg("Unknown metric type")
 		return nil, echo.ErrBadRequest
 	}
 
+	if len(input.Labels) > 0 {
+		metric.Labels = input.Labels
+	}
+
 	return metric, nil
 }
 
+// storeError возвращает http ошибку для ошибки сохранения метрики
+func storeError(err error) error {
+	if errors.Is(err, model.ErrHistogramBucketsMismatch) || errors.Is(err, model.ErrInvalidHistogram) ||
+		errors.Is(err, model.ErrSummaryAccuracyMismatch) || errors.Is(err, model.ErrInvalidSummary) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return echo.ErrInternalServerError
+}
+
+// lookupError возвращает ошибку HTTP для ошибки поиска метрики
+func lookupError(err error) error {
+	switch {
+	case errors.Is(err, model.ErrMetricNotFound):
+		return echo.ErrNotFound
+	case errors.Is(err, model.ErrAmbiguousMetric):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	return echo.ErrInternalServerError
+}
+
+// summaryValue возвращает значение summary с оценками настроенных квантилей
+func (h *Handlers) summaryValue(s *model.Summary) *SummaryValue {
+	v := &SummaryValue{
+		Count:     s.Count,
+		Sum:       s.Sum,
+		Quantiles: make(map[string]float64, len(h.quantiles)),
+	}
+	for _, q := range h.quantiles {
+		v.Quantiles[strconv.FormatFloat(q, 'f', -1, 64)] = s.Quantile(q)
+	}
+	return v
+}
+
 // Value возвращает значение метрики
 func (h *Handlers) Value(c echo.Context) error {
 	var m Metrics
@@ -214,23 +338,9 @@ func (h *Handlers) Value(c echo.Context) error {
 		return echo.ErrBadRequest
 	}
 
-	var metric *model.Metric
-	metricMap := map[model.MetricType]func(string) (*model.Metric, error){
-		model.MetricTypeGauge:   h.storage.GetGauge,
-		model.MetricTypeCounter: h.storage.GetCounter,
-	}
-
-	metricFunc, ok := metricMap[metricType]
-	if !ok {
-		return echo.ErrBadRequest
-	}
-
-	metric, err = metricFunc(m.ID)
+	metric, err := storage.Get(h.storage, metricType, m.ID, m.Labels)
 	if err != nil {
-		if errors.Is(err, model.ErrMetricNotFound) {
-			return echo.ErrNotFound
-		}
-		return echo.ErrInternalServerError
+		return lookupError(err)
 	}
 
 	switch metricType {
@@ -238,11 +348,25 @@ func (h *Handlers) Value(c echo.Context) error {
 		m.Value = &metric.Gauge
 	case model.MetricTypeCounter:
 		m.Delta = &metric.Counter
+	case model.MetricTypeHistogram:
+		m.Histogram = metric.Histogram
+	case model.MetricTypeSummary:
+		m.Summary = h.summaryValue(metric.Summary)
 	}
 
 	return c.JSON(http.StatusOK, m)
 }
 
+// Alerts возвращает текущие оповещения
+// Если оповещения не настроены, возвращает пустой список
+func (h *Handlers) Alerts(c echo.Context) error {
+	alerts := make([]alerting.Alert, 0)
+	if h.alerts != nil {
+		alerts = h.alerts.Alerts()
+	}
+	return c.JSON(http.StatusOK, Alerts{Alerts: alerts})
+}
+
 // Ping проверяет соединение с базой данных
 // Если соединение установлено возвращает 200
 // Если соединение не установлено возвращает 503
@@ -1,15 +1,26 @@
 package handler
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/stretchr/testify/require"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/golang/snappy"
 
+	"github.com/soltanat/metrics/internal/alerting"
+	"github.com/soltanat/metrics/internal/auth"
 	"github.com/soltanat/metrics/internal/db"
 	"github.com/soltanat/metrics/internal/db/mock"
 
@@ -19,6 +30,7 @@ import (
 	"github.com/soltanat/metrics/internal/logger"
 	"github.com/soltanat/metrics/internal/model"
 	"github.com/soltanat/metrics/internal/storage"
+	"github.com/soltanat/metrics/internal/tlsconfig"
 )
 
 func TestHandlers_Get(t *testing.T) {
@@ -29,6 +41,7 @@ func TestHandlers_Get(t *testing.T) {
 	tests := []struct {
 		name           string
 		path           string
+		query          string
 		mockedFields   mockedFields
 		wantResponse   string
 		wantStatusCode int
@@ -41,7 +54,7 @@ func TestHandlers_Get(t *testing.T) {
 			wantResponse:   "1",
 			wantStatusCode: http.StatusOK,
 			on: func(fields *mockedFields) {
-				fields.storage.On("GetCounter", "counter1").Return(
+				fields.storage.On("GetCounter", "counter1", model.Labels(nil)).Return(
 					model.NewCounter("counter1", 1), nil,
 				)
 			},
@@ -53,11 +66,51 @@ func TestHandlers_Get(t *testing.T) {
 			wantResponse:   "1.1",
 			wantStatusCode: http.StatusOK,
 			on: func(fields *mockedFields) {
-				fields.storage.On("GetGauge", "gauge1").Return(
+				fields.storage.On("GetGauge", "gauge1", model.Labels(nil)).Return(
 					model.NewGauge("gauge1", 1.1), nil,
 				)
 			},
 		},
+		{
+			name:           "labeled gauge by name",
+			path:           "/value/gauge/gauge1",
+			mockedFields:   mockedFields{storage: &storage.MockStorage{}, db: &mock.MockConn{}},
+			wantResponse:   "2.5",
+			wantStatusCode: http.StatusOK,
+			on: func(fields *mockedFields) {
+				m := model.NewGauge("gauge1", 2.5)
+				m.Labels = model.Labels{"host": "a"}
+				fields.storage.On("GetGauge", "gauge1", model.Labels(nil)).Return(nil, model.ErrMetricNotFound)
+				fields.storage.On("GetList").Return([]model.Metric{*model.NewCounter("gauge1", 1), *m}, nil)
+			},
+		},
+		{
+			name:           "ambiguous gauge",
+			path:           "/value/gauge/gauge1",
+			mockedFields:   mockedFields{storage: &storage.MockStorage{}, db: &mock.MockConn{}},
+			wantStatusCode: http.StatusConflict,
+			on: func(fields *mockedFields) {
+				a := model.NewGauge("gauge1", 1)
+				a.Labels = model.Labels{"host": "a"}
+				b := model.NewGauge("gauge1", 2)
+				b.Labels = model.Labels{"host": "b"}
+				fields.storage.On("GetGauge", "gauge1", model.Labels(nil)).Return(nil, model.ErrMetricNotFound)
+				fields.storage.On("GetList").Return([]model.Metric{*a, *b}, nil)
+			},
+		},
+		{
+			name:           "gauge with query labels",
+			path:           "/value/gauge/gauge1",
+			query:          "host=b",
+			mockedFields:   mockedFields{storage: &storage.MockStorage{}, db: &mock.MockConn{}},
+			wantResponse:   "2",
+			wantStatusCode: http.StatusOK,
+			on: func(fields *mockedFields) {
+				m := model.NewGauge("gauge1", 2)
+				m.Labels = model.Labels{"host": "b"}
+				fields.storage.On("GetGauge", "gauge1", model.Labels{"host": "b"}).Return(m, nil)
+			},
+		},
 		{
 			name:           "unknown type",
 			path:           "/value/unknown/name",
@@ -73,9 +126,10 @@ func TestHandlers_Get(t *testing.T) {
 			wantStatusCode: http.StatusNotFound,
 			wantResponse:   "",
 			on: func(fields *mockedFields) {
-				fields.storage.On("GetGauge", "name").Return(
+				fields.storage.On("GetGauge", "name", model.Labels(nil)).Return(
 					nil, model.ErrMetricNotFound,
 				)
+				fields.storage.On("GetList").Return([]model.Metric{}, nil)
 			},
 		},
 		{
@@ -85,9 +139,10 @@ func TestHandlers_Get(t *testing.T) {
 			wantStatusCode: http.StatusNotFound,
 			wantResponse:   "",
 			on: func(fields *mockedFields) {
-				fields.storage.On("GetCounter", "name").Return(
+				fields.storage.On("GetCounter", "name", model.Labels(nil)).Return(
 					nil, model.ErrMetricNotFound,
 				)
+				fields.storage.On("GetList").Return([]model.Metric{}, nil)
 			},
 		},
 	}
@@ -106,6 +161,7 @@ func TestHandlers_Get(t *testing.T) {
 			assert.NoError(t, err)
 
 			req.URL = u
+			req.SetQueryString(tt.query)
 
 			if tt.on != nil {
 				tt.on(&tt.mockedFields)
@@ -114,6 +170,9 @@ func TestHandlers_Get(t *testing.T) {
 			resp, err := req.Send()
 			assert.NoError(t, err)
 			assert.Equal(t, tt.wantStatusCode, resp.StatusCode())
+			if tt.wantResponse != "" {
+				assert.Equal(t, tt.wantResponse, resp.String())
+			}
 
 			assert.True(t, tt.mockedFields.storage.AssertExpectations(t))
 		})
@@ -213,6 +272,222 @@ func TestHandlers_Store(t *testing.T) {
 	}
 }
 
+func TestSetupRoutes_TrustedSubnet(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		realIP       string
+		wantRespCode int
+		on           func(s *storage.MockStorage)
+	}{
+		{
+			name:         "write from trusted subnet",
+			method:       resty.MethodPost,
+			path:         "/update/counter/name/1",
+			realIP:       "10.1.2.3",
+			wantRespCode: http.StatusOK,
+			on: func(s *storage.MockStorage) {
+				s.On("Store", model.NewCounter("name", 1)).Return(nil)
+			},
+		},
+		{
+			name:         "write from untrusted address",
+			method:       resty.MethodPost,
+			path:         "/update/counter/name/1",
+			realIP:       "192.168.0.1",
+			wantRespCode: http.StatusForbidden,
+		},
+		{
+			name:         "write without real ip",
+			method:       resty.MethodPost,
+			path:         "/updates/",
+			wantRespCode: http.StatusForbidden,
+		},
+		{
+			name:         "read is not restricted",
+			method:       resty.MethodGet,
+			path:         "/",
+			realIP:       "192.168.0.1",
+			wantRespCode: http.StatusOK,
+			on: func(s *storage.MockStorage) {
+				s.On("GetList").Return([]model.Metric{}, nil)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &storage.MockStorage{}
+			r, err := SetupRoutes(New(s, &mock.MockConn{}), "", []byte(""), WithTrustedSubnet(trusted))
+			require.NoError(t, err)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			if tt.on != nil {
+				tt.on(s)
+			}
+
+			req := resty.New().R()
+			req.Method = tt.method
+			if tt.realIP != "" {
+				req.SetHeader("X-Real-IP", tt.realIP)
+			}
+			req.URL, err = url.JoinPath(srv.URL, tt.path)
+			require.NoError(t, err)
+
+			resp, err := req.Send()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantRespCode, resp.StatusCode())
+			assert.True(t, s.AssertExpectations(t))
+		})
+	}
+}
+
+func TestHandlers_Keys(t *testing.T) {
+	keys, err := auth.NewFileKeyStore(filepath.Join(t.TempDir(), "keys.json"))
+	require.NoError(t, err)
+	require.NoError(t, keys.Create(context.Background(), auth.APIKey{
+		Name: "root", TokenHash: auth.HashToken("root-token"), Scopes: []auth.Scope{auth.ScopeAdmin},
+	}))
+
+	s := &storage.MockStorage{}
+	s.On("Store", model.NewCounter("name", 1)).Return(nil).Once()
+	r, err := SetupRoutes(New(s, &mock.MockConn{}).WithKeyStore(keys), "", []byte(""))
+	require.NoError(t, err)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	cli := resty.New().SetBaseURL(srv.URL)
+
+	// агент без ключа не может записывать метрики
+	resp, err := cli.R().Post("/update/counter/name/1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+	// создание ключа агента доступно только с областью admin
+	var created APIKey
+	resp, err = cli.R().SetAuthToken("root-token").
+		SetHeader("Content-Type", "application/json").
+		SetBody(`{"name":"agent-1","scopes":["write"]}`).
+		SetResult(&created).
+		Post("/api/v1/keys/")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusCreated, resp.StatusCode())
+	assert.Equal(t, "agent-1", created.Name)
+	assert.NotEmpty(t, created.Token)
+
+	resp, err = cli.R().SetAuthToken(created.Token).
+		SetHeader("Content-Type", "application/json").
+		SetBody(`{"name":"agent-2","scopes":["write"]}`).
+		Post("/api/v1/keys/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+
+	resp, err = cli.R().SetAuthToken(created.Token).Post("/update/counter/name/1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode())
+
+	// ключ с областью write не дает чтения
+	resp, err = cli.R().SetAuthToken(created.Token).Get("/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode())
+
+	var list APIKeys
+	resp, err = cli.R().SetAuthToken("root-token").SetResult(&list).Get("/api/v1/keys/")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode())
+	require.Len(t, list.Keys, 2)
+	assert.Empty(t, list.Keys[1].Token)
+
+	resp, err = cli.R().SetAuthToken("root-token").Delete("/api/v1/keys/agent-1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode())
+
+	resp, err = cli.R().SetAuthToken("root-token").Delete("/api/v1/keys/unknown")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+
+	// отозванный ключ больше не проходит аутентификацию
+	resp, err = cli.R().SetAuthToken(created.Token).Post("/update/counter/name/1")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode())
+
+	// проверка доступности не требует ключа
+	resp, err = cli.R().Get("/ping")
+	require.NoError(t, err)
+	assert.NotEqual(t, http.StatusUnauthorized, resp.StatusCode())
+
+	s.AssertExpectations(t)
+}
+
+func TestSetupRoutes_ClientCert(t *testing.T) {
+	dir := t.TempDir()
+	writePair := func(name string, c *tlsconfig.Certificate) (string, string) {
+		keyPEM, err := c.KeyPEM()
+		require.NoError(t, err)
+		certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+		require.NoError(t, os.WriteFile(certFile, c.CertPEM(), 0o600))
+		require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+		return certFile, keyFile
+	}
+	ca, err := tlsconfig.NewCA("test CA", time.Hour)
+	require.NoError(t, err)
+	caFile, _ := writePair("ca", ca)
+	serverCert, err := ca.Issue("server", []string{"127.0.0.1"}, tlsconfig.UsageServer, time.Hour)
+	require.NoError(t, err)
+	serverCertFile, serverKeyFile := writePair("server", serverCert)
+
+	s := &storage.MockStorage{}
+	s.On("Store", model.NewCounter("name", 1)).Return(nil)
+	s.On("GetList").Return([]model.Metric{}, nil)
+	r, err := SetupRoutes(New(s, &mock.MockConn{}), "", []byte(""), WithClientCert([]string{"agent-1"}))
+	require.NoError(t, err)
+
+	serverConfig, err := tlsconfig.Server(serverCertFile, serverKeyFile, caFile, tls.VerifyClientCertIfGiven)
+	require.NoError(t, err)
+	srv := httptest.NewUnstartedServer(r)
+	srv.TLS = serverConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		clientCN     string
+		method       string
+		path         string
+		wantRespCode int
+	}{
+		{name: "allowed agent writes", clientCN: "agent-1", method: resty.MethodPost, path: "/update/counter/name/1", wantRespCode: http.StatusOK},
+		{name: "other agent", clientCN: "agent-2", method: resty.MethodPost, path: "/update/counter/name/1", wantRespCode: http.StatusForbidden},
+		{name: "without certificate", method: resty.MethodPost, path: "/update/counter/name/1", wantRespCode: http.StatusForbidden},
+		{name: "read without certificate", method: resty.MethodGet, path: "/", wantRespCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var certFile, keyFile string
+			if tt.clientCN != "" {
+				c, err := ca.Issue(tt.clientCN, nil, tlsconfig.UsageClient, time.Hour)
+				require.NoError(t, err)
+				certFile, keyFile = writePair(tt.clientCN, c)
+			}
+			clientConfig, err := tlsconfig.Client(caFile, certFile, keyFile, "")
+			require.NoError(t, err)
+
+			req := resty.New().SetTLSClientConfig(clientConfig).R()
+			req.Method = tt.method
+			req.URL, err = url.JoinPath(srv.URL, tt.path)
+			require.NoError(t, err)
+
+			resp, err := req.Send()
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRespCode, resp.StatusCode())
+		})
+	}
+}
+
 func TestHandlers_GetList(t *testing.T) {
 	type mockedFields struct {
 		storage *storage.MockStorage
@@ -273,6 +548,325 @@ func TestHandlers_GetList(t *testing.T) {
 	}
 }
 
+func TestHandlers_Prometheus(t *testing.T) {
+	type mockedFields struct {
+		storage *storage.MockStorage
+		db      db.Conn
+	}
+	tests := []struct {
+		name           string
+		mockedFields   mockedFields
+		on             func(fields *mockedFields)
+		wantedRespCode int
+		wantedRespBody string
+	}{
+		{
+			name:         "sorted and sanitized",
+			mockedFields: mockedFields{storage: &storage.MockStorage{}, db: &mock.MockConn{}},
+			on: func(fields *mockedFields) {
+				fields.storage.On("GetList").Return([]model.Metric{
+					*model.NewGauge("b.metric-2", 1.5),
+					*model.NewCounter("a", 3),
+					*model.NewGauge("1st", 0),
+				}, nil)
+			},
+			wantedRespCode: http.StatusOK,
+			wantedRespBody: "# TYPE _1st gauge\n_1st 0\n" +
+				"# TYPE a counter\na 3\n" +
+				"# TYPE b_metric_2 gauge\nb_metric_2 1.5\n",
+		},
+		{
+			name:         "labels",
+			mockedFields: mockedFields{storage: &storage.MockStorage{}, db: &mock.MockConn{}},
+			on: func(fields *mockedFields) {
+				fields.storage.On("GetList").Return([]model.Metric{
+					{Type: model.MetricTypeGauge, Name: "heap", Gauge: 2, Labels: model.Labels{"host": "b"}},
+					{Type: model.MetricTypeGauge, Name: "heap", Gauge: 1, Labels: model.Labels{"host": "a", "agent-id": `x"1`}},
+				}, nil)
+			},
+			wantedRespCode: http.StatusOK,
+			wantedRespBody: "# TYPE heap gauge\n" +
+				"heap{agent_id=\"x\\\"1\",host=\"a\"} 1\n" +
+				"heap{host=\"b\"} 2\n",
+		},
+		{
+			name:         "empty storage",
+			mockedFields: mockedFields{storage: &storage.MockStorage{}, db: &mock.MockConn{}},
+			on: func(fields *mockedFields) {
+				fields.storage.On("GetList").Return([]model.Metric{}, nil)
+			},
+			wantedRespCode: http.StatusOK,
+			wantedRespBody: "",
+		},
+		{
+			name:         "histogram",
+			mockedFields: mockedFields{storage: &storage.MockStorage{}, db: &mock.MockConn{}},
+			on: func(fields *mockedFields) {
+				m := model.NewHistogram("latency", []float64{0.1, 1})
+				m.Labels = model.Labels{"host": "a"}
+				m.Histogram.Observe(0.05)
+				m.Histogram.Observe(5)
+				fields.storage.On("GetList").Return([]model.Metric{*m}, nil)
+			},
+			wantedRespCode: http.StatusOK,
+			wantedRespBody: "# TYPE latency histogram\n" +
+				"latency_bucket{host=\"a\",le=\"0.1\"} 1\n" +
+				"latency_bucket{host=\"a\",le=\"1\"} 1\n" +
+				"latency_bucket{host=\"a\",le=\"+Inf\"} 2\n" +
+				"latency_sum{host=\"a\"} 5.05\n" +
+				"latency_count{host=\"a\"} 2\n",
+		},
+		{
+			name:         "one family per name",
+			mockedFields: mockedFields{storage: &storage.MockStorage{}, db: &mock.MockConn{}},
+			on: func(fields *mockedFields) {
+				lat := model.NewHistogram("lat", []float64{1})
+				lat.Histogram.Observe(0.5)
+				fields.storage.On("GetList").Return([]model.Metric{
+					*model.NewCounter("x", 3),
+					*model.NewGauge("x", 1),
+					*model.NewGauge("a.b", 1),
+					*model.NewGauge("a_b", 2),
+					*model.NewGauge("lat_sum", 7),
+					*lat,
+				}, nil)
+			},
+			wantedRespCode: http.StatusOK,
+			wantedRespBody: "# TYPE a_b gauge\na_b 1\n" +
+				"# TYPE lat histogram\n" +
+				"lat_bucket{le=\"1\"} 1\n" +
+				"lat_bucket{le=\"+Inf\"} 1\n" +
+				"lat_sum 0.5\n" +
+				"lat_count 1\n" +
+				"# TYPE x gauge\nx 1\n",
+		},
+		{
+			name:         "storage error",
+			mockedFields: mockedFields{storage: &storage.MockStorage{}, db: &mock.MockConn{}},
+			on: func(fields *mockedFields) {
+				fields.storage.On("GetList").Return([]model.Metric(nil), fmt.Errorf("storage error"))
+			},
+			wantedRespCode: http.StatusInternalServerError,
+			wantedRespBody: "{\"message\":\"Internal Server Error\"}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(tt.mockedFields.storage, tt.mockedFields.db)
+			r, err := SetupRoutes(h, "", []byte(""))
+			require.NoError(t, err)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			tt.on(&tt.mockedFields)
+
+			resp, err := resty.New().R().Get(srv.URL + "/metrics")
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantedRespCode, resp.StatusCode())
+			assert.True(t, tt.mockedFields.storage.AssertExpectations(t))
+			assert.Equal(t, tt.wantedRespBody, string(resp.Body()))
+		})
+	}
+}
+
+func TestHandlers_Series(t *testing.T) {
+	from := time.Unix(1700000000, 0)
+	to := time.Unix(1700000060, 0)
+	points := []model.Point{
+		{Timestamp: from.UTC(), Value: 1},
+		{Timestamp: to.UTC(), Value: 2},
+	}
+
+	tests := []struct {
+		name           string
+		query          string
+		on             func(s *storage.MockStorage)
+		wantedRespCode int
+		wantedRespBody string
+	}{
+		{
+			name:  "gauge with labels",
+			query: "?name=heap&type=gauge&from=1700000000&to=2023-11-14T22:14:20Z&label=host%3Da",
+			on: func(s *storage.MockStorage) {
+				s.On("GetSeries", model.MetricTypeGauge, "heap", model.Labels{"host": "a"}, from, to.UTC()).
+					Return(points, nil)
+			},
+			wantedRespCode: http.StatusOK,
+			wantedRespBody: `{"id":"heap","type":"gauge","labels":{"host":"a"},"points":[` +
+				`{"timestamp":"2023-11-14T22:13:20Z","value":1},{"timestamp":"2023-11-14T22:14:20Z","value":2}]}`,
+		},
+		{
+			name:           "missing name",
+			query:          "?type=gauge",
+			wantedRespCode: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown type",
+			query:          "?name=heap&type=unknown",
+			wantedRespCode: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid from",
+			query:          "?name=heap&type=gauge&from=yesterday",
+			wantedRespCode: http.StatusBadRequest,
+		},
+		{
+			name:           "to before from",
+			query:          "?name=heap&type=gauge&from=1700000060&to=1700000000",
+			wantedRespCode: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid label",
+			query:          "?name=heap&type=gauge&label=host",
+			wantedRespCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &storage.MockStorage{}
+			if tt.on != nil {
+				tt.on(s)
+			}
+			r, err := SetupRoutes(New(s, nil), "", []byte(""))
+			require.NoError(t, err)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			resp, err := resty.New().R().Get(srv.URL + "/api/v1/series" + tt.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantedRespCode, resp.StatusCode())
+			if tt.wantedRespBody != "" {
+				assert.JSONEq(t, tt.wantedRespBody, resp.String())
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
+
+func TestHandlers_Query(t *testing.T) {
+	at := time.Unix(1700000000, 0)
+	counter := model.NewCounter("PollCount", 0)
+	counter.Labels = model.Labels{"host": "a"}
+
+	tests := []struct {
+		name           string
+		query          string
+		on             func(s *storage.MockStorage)
+		wantedRespCode int
+		wantedRespBody string
+	}{
+		{
+			name:  "rate",
+			query: "?query=rate(PollCount%5B1m%5D)&time=1700000000",
+			on: func(s *storage.MockStorage) {
+				s.On("GetList").Return([]model.Metric{*counter}, nil)
+				s.On("GetSeries", model.MetricTypeCounter, "PollCount", model.Labels{"host": "a"}, at.Add(-time.Minute), at).
+					Return([]model.Point{{Timestamp: at.Add(-time.Minute), Value: 1}, {Timestamp: at, Value: 31}}, nil)
+			},
+			wantedRespCode: http.StatusOK,
+			wantedRespBody: `{"query":"rate(PollCount[1m0s])","timestamp":"` + at.Format(time.RFC3339) + `",` +
+				`"result":[{"labels":{"host":"a"},"value":0.5}]}`,
+		},
+		{
+			name:           "missing query",
+			query:          "",
+			wantedRespCode: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid query",
+			query:          "?query=rate(PollCount)",
+			wantedRespCode: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid time",
+			query:          "?query=PollCount&time=yesterday",
+			wantedRespCode: http.StatusBadRequest,
+		},
+		{
+			name:  "storage error",
+			query: "?query=PollCount",
+			on: func(s *storage.MockStorage) {
+				s.On("GetList").Return([]model.Metric(nil), errors.New("unavailable"))
+			},
+			wantedRespCode: http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &storage.MockStorage{}
+			if tt.on != nil {
+				tt.on(s)
+			}
+			r, err := SetupRoutes(New(s, nil), "", []byte(""))
+			require.NoError(t, err)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			resp, err := resty.New().R().Get(srv.URL + "/api/v1/query" + tt.query)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantedRespCode, resp.StatusCode())
+			if tt.wantedRespBody != "" {
+				assert.JSONEq(t, tt.wantedRespBody, resp.String())
+			}
+			s.AssertExpectations(t)
+		})
+	}
+}
+
+type alertSourceFunc func() []alerting.Alert
+
+func (f alertSourceFunc) Alerts() []alerting.Alert {
+	return f()
+}
+
+func TestHandlers_Alerts(t *testing.T) {
+	activeAt := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		alerts         AlertSource
+		wantedRespBody string
+	}{
+		{
+			name:           "not configured",
+			wantedRespBody: `{"alerts":[]}`,
+		},
+		{
+			name: "pending alert",
+			alerts: alertSourceFunc(func() []alerting.Alert {
+				return []alerting.Alert{{
+					Rule:     "gauge FreeMemory < 1e9 for 2m",
+					Name:     "FreeMemory",
+					Type:     "gauge",
+					Labels:   model.Labels{"host": "a"},
+					State:    alerting.StatePending,
+					Value:    5e8,
+					ActiveAt: activeAt,
+				}}
+			}),
+			wantedRespBody: `{"alerts":[{"rule":"gauge FreeMemory < 1e9 for 2m","name":"FreeMemory","type":"gauge",` +
+				`"labels":{"host":"a"},"state":"pending","value":500000000,"active_at":"2023-11-14T22:13:20Z"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&storage.MockStorage{}, nil)
+			if tt.alerts != nil {
+				h.WithAlerts(tt.alerts)
+			}
+			r, err := SetupRoutes(h, "", []byte(""))
+			require.NoError(t, err)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			resp, err := resty.New().R().Get(srv.URL + "/api/v1/alerts")
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, resp.StatusCode())
+			assert.JSONEq(t, tt.wantedRespBody, resp.String())
+		})
+	}
+}
+
 type StorageCall struct {
 	Metric *model.Metric
 }
@@ -335,7 +929,7 @@ func TestHandlers_StoreMetrics(t *testing.T) {
 			},
 			statusCode: http.StatusOK,
 			on: func(metric *model.Metric, storage *storage.MockStorage) {
-				mockStorage.On("GetCounter", "test-id").Return(metric, nil).Once()
+				mockStorage.On("GetCounter", "test-id", model.Labels(nil)).Return(metric, nil).Once()
 				mockStorage.On("Store", metric).Return(nil).Once()
 			},
 		},
@@ -355,12 +949,93 @@ func TestHandlers_StoreMetrics(t *testing.T) {
 			},
 			statusCode: http.StatusOK,
 			on: func(metric *model.Metric, storage *storage.MockStorage) {
-				mockStorage.On("GetCounter", "test-id").Return(
+				mockStorage.On("GetCounter", "test-id", model.Labels(nil)).Return(
 					nil,
 					model.ErrMetricNotFound).Once()
 				mockStorage.On("Store", metric).Return(nil).Once()
 			},
 		},
+		{
+			name: "StoreHistogramMetric",
+			metrics: Metrics{
+				MType: "histogram",
+				ID:    "test-id",
+				Histogram: &model.Histogram{
+					Buckets: []float64{0.1, 1},
+					Counts:  []int64{1, 0, 2},
+					Sum:     10.05,
+					Count:   3,
+				},
+			},
+			expectedCall: &StorageCall{
+				Metric: &model.Metric{
+					Type: model.MetricTypeHistogram,
+					Name: "test-id",
+					Histogram: &model.Histogram{
+						Buckets: []float64{0.1, 1},
+						Counts:  []int64{1, 0, 2},
+						Sum:     10.05,
+						Count:   3,
+					},
+				},
+			},
+			statusCode: http.StatusOK,
+			on: func(metric *model.Metric, storage *storage.MockStorage) {
+				mockStorage.On("Store", metric).Return(nil).Once()
+			},
+		},
+		{
+			name: "InvalidHistogramCounts",
+			metrics: Metrics{
+				MType: "histogram",
+				ID:    "test-id",
+				Histogram: &model.Histogram{
+					Buckets: []float64{0.1, 1},
+					Counts:  []int64{1},
+					Count:   1,
+				},
+			},
+			expectedCall: nil,
+			statusCode:   http.StatusBadRequest,
+		},
+		{
+			name: "MissingHistogramForHistogramMetric",
+			metrics: Metrics{
+				MType: "histogram",
+				ID:    "test-id",
+			},
+			expectedCall: nil,
+			statusCode:   http.StatusBadRequest,
+		},
+		{
+			name: "StoreSummaryMetric",
+			metrics: Metrics{
+				MType:        "summary",
+				ID:           "test-id",
+				Observations: []float64{1, 2},
+			},
+			expectedCall: &StorageCall{
+				Metric: func() *model.Metric {
+					m := model.NewSummary("test-id")
+					m.Summary.Observe(1)
+					m.Summary.Observe(2)
+					return m
+				}(),
+			},
+			statusCode: http.StatusOK,
+			on: func(metric *model.Metric, storage *storage.MockStorage) {
+				mockStorage.On("Store", metric).Return(nil).Once()
+			},
+		},
+		{
+			name: "MissingObservationsForSummaryMetric",
+			metrics: Metrics{
+				MType: "summary",
+				ID:    "test-id",
+			},
+			expectedCall: nil,
+			statusCode:   http.StatusBadRequest,
+		},
 		{
 			name: "MissingValueForGaugeMetric",
 			metrics: Metrics{
@@ -423,7 +1098,8 @@ func TestHandlers_StoreMetrics(t *testing.T) {
 func TestHandlers_Value(t *testing.T) {
 	mockStorage := &storage.MockStorage{}
 	h := &Handlers{
-		storage: mockStorage,
+		storage:   mockStorage,
+		quantiles: DefaultQuantiles,
 	}
 
 	r, err := SetupRoutes(h, "", []byte(""))
@@ -460,9 +1136,10 @@ func TestHandlers_Value(t *testing.T) {
 			expectedStatus: http.StatusNotFound,
 			expectedBody:   "{\"message\":\"Not Found\"}",
 			on: func() {
-				mockStorage.On("GetGauge", "not_found_id").Return(
+				mockStorage.On("GetGauge", "not_found_id", model.Labels(nil)).Return(
 					nil, model.ErrMetricNotFound,
 				).Once()
+				mockStorage.On("GetList").Return([]model.Metric{}, nil).Once()
 			},
 		},
 		{
@@ -471,18 +1148,54 @@ func TestHandlers_Value(t *testing.T) {
 			expectedStatus: http.StatusOK,
 			expectedBody:   `{"type": "gauge", "id": "valid_id", "value": 10.1}`,
 			on: func() {
-				mockStorage.On("GetGauge", "valid_id").Return(
+				mockStorage.On("GetGauge", "valid_id", model.Labels(nil)).Return(
 					model.NewGauge("valid_id", 10.1), nil,
 				).Once()
 			},
 		},
+		{
+			name:           "Successful request - Gauge with labels",
+			requestBody:    `{"type": "gauge", "id": "valid_id", "labels": {"host": "a"}}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"type": "gauge", "id": "valid_id", "value": 1.5, "labels": {"host": "a"}}`,
+			on: func() {
+				m := model.NewGauge("valid_id", 1.5)
+				m.Labels = model.Labels{"host": "a"}
+				mockStorage.On("GetGauge", "valid_id", model.Labels{"host": "a"}).Return(m, nil).Once()
+			},
+		},
+		{
+			name:           "Successful request - Histogram",
+			requestBody:    `{"type": "histogram", "id": "valid_id"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"type": "histogram", "id": "valid_id", "histogram": {"buckets": [1], "counts": [1, 0], "sum": 0.5, "count": 1}}`,
+			on: func() {
+				m := model.NewHistogram("valid_id", []float64{1})
+				m.Histogram.Observe(0.5)
+				mockStorage.On("GetHistogram", "valid_id", model.Labels(nil)).Return(m, nil).Once()
+			},
+		},
+		{
+			name:           "Successful request - Summary",
+			requestBody:    `{"type": "summary", "id": "valid_id"}`,
+			expectedStatus: http.StatusOK,
+			expectedBody: `{"type": "summary", "id": "valid_id", "summary": ` +
+				`{"count": 3, "sum": 6, "quantiles": {"0.5": 2, "0.9": 2, "0.99": 2}}}`,
+			on: func() {
+				m := model.NewSummary("valid_id")
+				m.Summary.Observe(2)
+				m.Summary.Observe(2)
+				m.Summary.Observe(2)
+				mockStorage.On("GetSummary", "valid_id", model.Labels(nil)).Return(m, nil).Once()
+			},
+		},
 		{
 			name:           "Successful request - Counter",
 			requestBody:    `{"type": "counter", "id": "valid_id"}`,
 			expectedStatus: http.StatusOK,
 			expectedBody:   `{"type": "counter", "id": "valid_id", "delta": 10}`,
 			on: func() {
-				mockStorage.On("GetCounter", "valid_id").Return(
+				mockStorage.On("GetCounter", "valid_id", model.Labels(nil)).Return(
 					model.NewCounter("valid_id", 10), nil,
 				).Once()
 			},
@@ -577,3 +1290,273 @@ func float64Ptr(f float64) *float64 {
 func intPtr(i int64) *int64 {
 	return &i
 }
+
+func TestHandlers_InfluxWrite(t *testing.T) {
+	mockStorage := &storage.MockStorage{}
+	h := &Handlers{logger: logger.Get(), storage: mockStorage}
+
+	r, err := SetupRoutes(h, "", []byte(""))
+	require.NoError(t, err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	client := resty.New()
+
+	tests := []struct {
+		name       string
+		body       string
+		query      string
+		want       []model.Metric
+		statusCode int
+		message    string
+	}{
+		{
+			name:  "counters and gauges",
+			body:  "mem,host=a used=10i,ratio=0.5 1700000000\ncpu value=1.5",
+			query: "?org=o&bucket=b&precision=s",
+			want: []model.Metric{
+				{Type: model.MetricTypeCounter, Name: "mem_used", Counter: 10, Labels: model.Labels{"host": "a"}},
+				{Type: model.MetricTypeGauge, Name: "mem_ratio", Gauge: 0.5, Labels: model.Labels{"host": "a"}},
+				{Type: model.MetricTypeGauge, Name: "cpu", Gauge: 1.5},
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "only string fields",
+			body:       `events msg="started"`,
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "invalid line",
+			body:       "cpu value=1\nmem used=abc",
+			statusCode: http.StatusBadRequest,
+			message:    `line 2: field \"used\": invalid value \"abc\"`,
+		},
+		{
+			name:       "timestamp out of range",
+			body:       "cpu value=1 1700000000\ncpu value=2 9223372037",
+			query:      "?precision=s",
+			statusCode: http.StatusBadRequest,
+			message:    `line 2: timestamp 9223372037 out of range`,
+		},
+		{
+			name:       "invalid precision",
+			body:       "cpu value=1",
+			query:      "?precision=m",
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.Calls = nil
+			mockStorage.ExpectedCalls = nil
+			if tt.want != nil {
+				mockStorage.On("StoreBatch", tt.want).Return(nil).Once()
+			}
+
+			resp, err := client.R().
+				SetHeader("Content-Type", "text/plain; charset=utf-8").
+				SetBody(tt.body).
+				Post(server.URL + "/api/v2/write" + tt.query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode())
+			assert.Contains(t, resp.String(), tt.message)
+
+			if tt.want != nil {
+				mockStorage.AssertExpectations(t)
+			} else {
+				assert.Empty(t, mockStorage.Calls)
+			}
+		})
+	}
+}
+
+func TestHandlers_RemoteWrite(t *testing.T) {
+	mockStorage := &storage.MockStorage{}
+	h := &Handlers{logger: logger.Get(), storage: mockStorage}
+
+	r, err := SetupRoutes(h, "", []byte(""))
+	require.NoError(t, err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// WriteRequest c сериями http_requests_total{job="api"} 2.5 и up 1
+	payload, err := hex.DecodeString("0a510a1f0a085f5f6e616d655f5f1213687474705f72657175657374735f746f74616c0a0a0a036a6f62" +
+		"120361706912100900000000000004401098c596ffbc31121009000000000000f83f1080d095ffbc310a220a0e0a085f5f6e616d655f5f" +
+		"12027570121009000000000000f03f1080d095ffbc31")
+	require.NoError(t, err)
+
+	client := resty.New()
+
+	tests := []struct {
+		name       string
+		body       []byte
+		want       []model.Metric
+		statusCode int
+	}{
+		{
+			name: "canned payload",
+			body: snappy.Encode(nil, payload),
+			want: []model.Metric{
+				{Type: model.MetricTypeGauge, Name: "http_requests_total", Gauge: 2.5, Labels: model.Labels{"job": "api"}},
+				{Type: model.MetricTypeGauge, Name: "up", Gauge: 1},
+			},
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "empty request",
+			body:       snappy.Encode(nil, nil),
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "not compressed",
+			body:       payload,
+			statusCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.Calls = nil
+			mockStorage.ExpectedCalls = nil
+			if tt.want != nil {
+				mockStorage.On("StoreBatch", tt.want).Return(nil).Once()
+			}
+
+			resp, err := client.R().
+				SetHeader("Content-Type", "application/x-protobuf").
+				SetHeader("Content-Encoding", "snappy").
+				SetHeader("X-Prometheus-Remote-Write-Version", "0.1.0").
+				SetBody(tt.body).
+				Post(server.URL + "/api/v1/write")
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode())
+
+			if tt.want != nil {
+				mockStorage.AssertExpectations(t)
+			} else {
+				assert.Empty(t, mockStorage.Calls)
+			}
+		})
+	}
+}
+
+func TestHandlers_OTLPMetrics(t *testing.T) {
+	mockStorage := &storage.MockStorage{}
+	h := New(mockStorage, nil)
+
+	r, err := SetupRoutes(h, "", []byte(""))
+	require.NoError(t, err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// ExportMetricsServiceRequest в protobuf: ресурс service.name=api, Sum requests (delta, монотонный) 3 и Gauge temperature 21.5
+	payload, err := hex.DecodeString("0a540a170a150a0c736572766963652e6e616d6512050a036170691239121b0a087265717565737473" +
+		"3a0f0a0931030000000000000010011801121a0a0b74656d70657261747572652a0b0a09210000000000803540")
+	require.NoError(t, err)
+
+	client := resty.New()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		want        []model.Metric
+		statusCode  int
+	}{
+		{
+			name:        "protobuf",
+			contentType: "application/x-protobuf",
+			body:        payload,
+			want: []model.Metric{
+				{Type: model.MetricTypeCounter, Name: "api.requests", Counter: 3},
+				{Type: model.MetricTypeGauge, Name: "api.temperature", Gauge: 21.5},
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:        "json",
+			contentType: "application/json",
+			body: []byte(`{"resourceMetrics": [{"scopeMetrics": [{"metrics": [
+				{"name": "queue", "gauge": {"dataPoints": [{"asInt": "4", "attributes": [{"key": "q", "value": {"stringValue": "jobs"}}]}]}}
+			]}]}]}`),
+			want: []model.Metric{
+				{Type: model.MetricTypeGauge, Name: "queue", Gauge: 4, Labels: model.Labels{"q": "jobs"}},
+			},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:        "empty request",
+			contentType: "application/x-protobuf",
+			body:        []byte{},
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "broken protobuf",
+			contentType: "application/x-protobuf",
+			body:        payload[:10],
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "text/plain",
+			body:        payload,
+			statusCode:  http.StatusUnsupportedMediaType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage.Calls = nil
+			mockStorage.ExpectedCalls = nil
+			if tt.want != nil {
+				mockStorage.On("StoreBatch", tt.want).Return(nil).Once()
+			}
+
+			resp, err := client.R().
+				SetHeader("Content-Type", tt.contentType).
+				SetBody(tt.body).
+				Post(server.URL + "/v1/metrics")
+			require.NoError(t, err)
+			assert.Equal(t, tt.statusCode, resp.StatusCode())
+
+			if tt.want != nil {
+				mockStorage.AssertExpectations(t)
+			} else {
+				assert.Empty(t, mockStorage.Calls)
+			}
+		})
+	}
+}
+
+func TestHandlers_OTLPMetrics_StoreError(t *testing.T) {
+	mockStorage := &storage.MockStorage{}
+	h := New(mockStorage, nil)
+
+	r, err := SetupRoutes(h, "", []byte(""))
+	require.NoError(t, err)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	counter := func(value string) string {
+		return `{"resourceMetrics": [{"scopeMetrics": [{"metrics": [{"name": "requests", "sum": {
+			"aggregationTemporality": 2, "isMonotonic": true, "dataPoints": [{"asInt": "` + value + `", "startTimeUnixNano": "1"}]}}]}]}]}`
+	}
+	post := func(body string) int {
+		resp, err := resty.New().R().
+			SetHeader("Content-Type", "application/json").
+			SetBody(body).
+			Post(server.URL + "/v1/metrics")
+		require.NoError(t, err)
+		return resp.StatusCode()
+	}
+
+	mockStorage.On("StoreBatch", []model.Metric{*model.NewCounter("requests", 0)}).Return(nil).Once()
+	assert.Equal(t, http.StatusOK, post(counter("10")))
+
+	// накопленное значение не запоминается, если метрики не сохранены, и повтор сохраняет то же приращение
+	mockStorage.On("StoreBatch", []model.Metric{*model.NewCounter("requests", 5)}).Return(errors.New("db is down")).Once()
+	assert.Equal(t, http.StatusInternalServerError, post(counter("15")))
+	mockStorage.On("StoreBatch", []model.Metric{*model.NewCounter("requests", 5)}).Return(nil).Once()
+	assert.Equal(t, http.StatusOK, post(counter("15")))
+
+	mockStorage.AssertExpectations(t)
+}
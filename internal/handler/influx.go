@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/soltanat/metrics/internal/influx"
+)
+
+// InfluxWrite сохраняет метрики, переданные в формате InfluxDB line protocol (совместим с /api/v2/write InfluxDB)
+// Целые поля сохраняются как counter, числа с плавающей точкой - как gauge (см. influx.Metrics)
+// precision - единица метки времени: ns (по умолчанию), us, ms или s; параметры org и bucket не используются
+// Метка времени проверяется (в том числе на переполнение в наносекундах), но не используется:
+// значения сохраняются со временем приема
+// Ошибка разбора возвращается со статусом 400 и номером некорректной строки, в этом случае ничего не сохраняется
+func (h *Handlers) InfluxWrite(c echo.Context) error {
+	precision, err := influx.ParsePrecision(c.QueryParam("precision"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	lines, err := influx.Parse(body, precision)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Error parsing line protocol")
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	metrics := influx.Metrics(lines)
+	if len(metrics) == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if err := h.storage.StoreBatch(metrics); err != nil {
+		h.logger.Error().Msgf("Error storing metric: %s", err)
+		return storeError(err)
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/soltanat/metrics/internal/auth"
+)
+
+// ListKeys возвращает API ключи без хешей токенов
+func (h *Handlers) ListKeys(c echo.Context) error {
+	keys, err := h.keys.List(c.Request().Context())
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Error listing api keys")
+		return echo.ErrInternalServerError
+	}
+
+	resp := APIKeys{Keys: make([]APIKey, 0, len(keys))}
+	for _, k := range keys {
+		resp.Keys = append(resp.Keys, apiKeyFromModel(k))
+	}
+	return c.JSON(http.StatusOK, resp)
+}
+
+// CreateKey создает API ключ и возвращает его токен, токен возвращается только один раз
+func (h *Handlers) CreateKey(c echo.Context) error {
+	var req APIKey
+	if err := c.Bind(&req); err != nil {
+		return echo.ErrBadRequest
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		return echo.ErrInternalServerError
+	}
+	key := auth.APIKey{
+		Name:      req.Name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	err = h.keys.Create(c.Request().Context(), key)
+	if errors.Is(err, auth.ErrInvalidKey) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if errors.Is(err, auth.ErrKeyExists) {
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Error creating api key")
+		return echo.ErrInternalServerError
+	}
+	h.logger.Info().Str("key", key.Name).Str("by", keyName(c)).Msg("api key created")
+
+	resp := apiKeyFromModel(key)
+	resp.Token = token
+	return c.JSON(http.StatusCreated, resp)
+}
+
+// RevokeKey отзывает API ключ по имени
+func (h *Handlers) RevokeKey(c echo.Context) error {
+	name := c.Param("name")
+
+	err := h.keys.Revoke(c.Request().Context(), name)
+	if errors.Is(err, auth.ErrKeyNotFound) {
+		return echo.ErrNotFound
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Error revoking api key")
+		return echo.ErrInternalServerError
+	}
+	h.logger.Info().Str("key", name).Str("by", keyName(c)).Msg("api key revoked")
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+func apiKeyFromModel(k auth.APIKey) APIKey {
+	return APIKey{Name: k.Name, Scopes: k.Scopes, CreatedAt: k.CreatedAt, RevokedAt: k.RevokedAt}
+}
+
+// keyName возвращает имя ключа, которым аутентифицирован запрос
+func keyName(c echo.Context) string {
+	if key, ok := auth.FromContext(c); ok {
+		return key.Name
+	}
+	return ""
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/soltanat/metrics/internal/otlp"
+)
+
+// OTLPMetrics сохраняет метрики, переданные по OTLP/HTTP (ExportMetricsServiceRequest в protobuf или JSON)
+// Sum, Gauge и Histogram преобразуются в метрики (см. otlp.Converter), неподдерживаемые значения
+// возвращаются в ответе как partial_success
+// Тип содержимого, отличный от application/x-protobuf и application/json, отклоняется со статусом 415,
+// поврежденный запрос - со статусом 400, в этих случаях ничего не сохраняется
+// Если сохранить метрики не удалось, накопленные значения не запоминаются и повтор запроса сохраняет те же приращения
+func (h *Handlers) OTLPMetrics(c echo.Context) error {
+	contentType := c.Request().Header.Get(echo.HeaderContentType)
+	mediaType, err := otlp.MediaType(contentType)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnsupportedMediaType, err.Error())
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	req, err := otlp.Decode(body, mediaType)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Error decoding OTLP request")
+		if errors.Is(err, otlp.ErrUnsupportedContentType) {
+			return echo.NewHTTPError(http.StatusUnsupportedMediaType, err.Error())
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	res := h.otlp.Convert(req)
+	if len(res.Metrics) > 0 {
+		if err := h.storage.StoreBatch(res.Metrics); err != nil {
+			h.logger.Error().Msgf("Error storing metric: %s", err)
+			return storeError(err)
+		}
+	}
+	// накопленные значения запоминаются только после сохранения, чтобы повтор запроса не потерял приращения
+	h.otlp.Commit(res)
+	if res.Rejected > 0 {
+		h.logger.Warn().Int64("rejected", res.Rejected).Msgf("OTLP data points rejected: %s", res.Reason)
+	}
+
+	resp, err := otlp.EncodeResponse(res.Rejected, res.Reason, mediaType)
+	if err != nil {
+		return err
+	}
+	return c.Blob(http.StatusOK, mediaType, resp)
+}
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/soltanat/metrics/internal/logger"
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// prometheusContentType
+// Content-Type текстового формата Prometheus
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// prometheusTypes
+// Соответствие типов метрик типам Prometheus
+var prometheusTypes = map[model.MetricType]string{
+	model.MetricTypeGauge:     "gauge",
+	model.MetricTypeCounter:   "counter",
+	model.MetricTypeHistogram: "histogram",
+	model.MetricTypeSummary:   "summary",
+}
+
+// sanitizePrometheusName
+// Приводит имя метрики к формату Prometheus [a-zA-Z_:][a-zA-Z0-9_:]*
+// Недопустимые символы заменяются на _
+func sanitizePrometheusName(name string) string {
+	if name == "" {
+		return "_"
+	}
+	b := strings.Builder{}
+	b.Grow(len(name) + 1)
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// prometheusLabels
+// Возвращает метки в формате Prometheus {k1="v1",k2="v2"}
+func prometheusLabels(labels model.Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	b := strings.Builder{}
+	b.WriteByte('{')
+	for i, k := range labels.Keys() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(sanitizePrometheusName(k))
+		b.WriteString(`="`)
+		b.WriteString(prometheusLabelValueReplacer.Replace(labels[k]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var prometheusLabelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writePrometheus
+// Записывает метрики в текстовом формате Prometheus
+// Метрики сортируются по имени, типу и меткам, чтобы вывод был стабильным между опросами
+// Для каждого имени выводится одно семейство: метрики с тем же именем (в том числе совпавшим после
+// sanitizePrometheusName) другого типа, повторяющиеся серии и серии, совпадающие с сериями _bucket, _sum
+// и _count гистограмм и summary, пропускаются с записью в лог, иначе Prometheus отклонит весь ответ
+// quantiles - квантили, выводимые для summary
+func writePrometheus(w io.Writer, metrics []model.Metric, quantiles []float64) error {
+	type sample struct {
+		metric model.Metric
+		labels string
+	}
+	sorted := make([]sample, 0, len(metrics))
+	for _, m := range metrics {
+		if _, ok := prometheusTypes[m.Type]; !ok {
+			continue
+		}
+		m.Name = sanitizePrometheusName(m.Name)
+		sorted = append(sorted, sample{metric: m, labels: prometheusLabels(m.Labels)})
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.metric.Name != b.metric.Name {
+			return a.metric.Name < b.metric.Name
+		}
+		if a.metric.Type != b.metric.Type {
+			return a.metric.Type < b.metric.Type
+		}
+		return a.labels < b.labels
+	})
+
+	l := logger.Get()
+	// families - типы выведенных семейств, owners - семейства, которым принадлежат имена серий
+	families := make(map[string]model.MetricType)
+	owners := make(map[string]string)
+	seen := make(map[string]struct{})
+	for _, s := range sorted {
+		m := s.metric
+		if t, ok := families[m.Name]; ok {
+			if t != m.Type {
+				l.Warn().Str("name", m.Name).Msgf("skipping %s metric: family already exported as %s", prometheusTypes[m.Type], prometheusTypes[t])
+				continue
+			}
+		} else {
+			if owner, ok := prometheusOwner(owners, m); ok {
+				l.Warn().Str("name", m.Name).Msgf("skipping %s metric: name collides with family %s", prometheusTypes[m.Type], owner)
+				continue
+			}
+			families[m.Name] = m.Type
+			for _, name := range prometheusSeriesNames(&m) {
+				owners[name] = m.Name
+			}
+			if _, err := fmt.Fprintf(w, "# TYPE %s %s\n", m.Name, prometheusTypes[m.Type]); err != nil {
+				return err
+			}
+		}
+
+		if _, ok := seen[m.Name+s.labels]; ok {
+			l.Warn().Str("name", m.Name).Str("labels", s.labels).Msg("skipping duplicate series")
+			continue
+		}
+		seen[m.Name+s.labels] = struct{}{}
+
+		if m.Type == model.MetricTypeHistogram {
+			if err := writePrometheusHistogram(w, &m); err != nil {
+				return err
+			}
+			continue
+		}
+		if m.Type == model.MetricTypeSummary {
+			if err := writePrometheusSummary(w, &m, quantiles); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", m.Name, s.labels, m.ValueAsString()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prometheusSeriesNames
+// Возвращает имена серий, которые выводятся для метрики
+func prometheusSeriesNames(m *model.Metric) []string {
+	switch m.Type {
+	case model.MetricTypeHistogram:
+		return []string{m.Name, m.Name + "_bucket", m.Name + "_sum", m.Name + "_count"}
+	case model.MetricTypeSummary:
+		return []string{m.Name, m.Name + "_sum", m.Name + "_count"}
+	}
+	return []string{m.Name}
+}
+
+// prometheusOwner
+// Возвращает выведенное семейство, которому уже принадлежит одна из серий метрики
+func prometheusOwner(owners map[string]string, m model.Metric) (string, bool) {
+	for _, name := range prometheusSeriesNames(&m) {
+		if owner, ok := owners[name]; ok {
+			return owner, true
+		}
+	}
+	return "", false
+}
+
+// writePrometheusHistogram
+// Записывает гистограмму в виде серий _bucket (с накопленными значениями), _sum и _count
+func writePrometheusHistogram(w io.Writer, m *model.Metric) error {
+	h := m.Histogram
+	if h == nil {
+		return nil
+	}
+	var cumulative int64
+	for i, c := range h.Counts {
+		cumulative += c
+		le := "+Inf"
+		if i < len(h.Buckets) {
+			le = strconv.FormatFloat(h.Buckets[i], 'f', -1, 64)
+		}
+		labels := model.Labels{"le": le}.Merge(m.Labels)
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", m.Name, prometheusLabels(labels), cumulative); err != nil {
+			return err
+		}
+	}
+	labels := prometheusLabels(m.Labels)
+	sum := strconv.FormatFloat(h.Sum, 'f', -1, 64)
+	_, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", m.Name, labels, sum, m.Name, labels, h.Count)
+	return err
+}
+
+// writePrometheusSummary
+// Записывает summary в виде серий с меткой quantile, _sum и _count
+func writePrometheusSummary(w io.Writer, m *model.Metric, quantiles []float64) error {
+	sm := m.Summary
+	if sm == nil {
+		return nil
+	}
+	if sm.Count > 0 {
+		for _, q := range quantiles {
+			labels := model.Labels{"quantile": strconv.FormatFloat(q, 'f', -1, 64)}.Merge(m.Labels)
+			v := strconv.FormatFloat(sm.Quantile(q), 'f', -1, 64)
+			if _, err := fmt.Fprintf(w, "%s%s %s\n", m.Name, prometheusLabels(labels), v); err != nil {
+				return err
+			}
+		}
+	}
+	labels := prometheusLabels(m.Labels)
+	sum := strconv.FormatFloat(sm.Sum, 'f', -1, 64)
+	_, err := fmt.Fprintf(w, "%s_sum%s %s\n%s_count%s %d\n", m.Name, labels, sum, m.Name, labels, sm.Count)
+	return err
+}
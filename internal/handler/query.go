@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/soltanat/metrics/internal/query"
+)
+
+// Query вычисляет выражение над историей значений метрик
+// query - выражение, например rate(PollCount[5m]) или sum by (host) (avg_over_time(Alloc[1h]))
+// time - момент времени в формате RFC3339 или unix timestamp в секундах, необязательный
+func (h *Handlers) Query(c echo.Context) error {
+	raw := c.QueryParam("query")
+	if raw == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "query is required")
+	}
+
+	t, err := parseTime(c.QueryParam("time"), time.Now())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid time: %s", err))
+	}
+
+	expr, err := query.Parse(raw)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	samples, err := query.Eval(h.storage, expr, t)
+	if errors.Is(err, query.ErrInvalidQuery) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Error evaluating query")
+		return echo.ErrInternalServerError
+	}
+
+	return c.JSON(http.StatusOK, QueryResult{
+		Query:     expr.String(),
+		Timestamp: t,
+		Result:    samples,
+	})
+}
@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/soltanat/metrics/internal/remotewrite"
+)
+
+// RemoteWrite сохраняет значения, переданные Prometheus remote_write (WriteRequest в protobuf, сжатый snappy)
+// Метка __name__ становится именем метрики, значения сохраняются как gauge (см. remotewrite.Metrics)
+// Поврежденный запрос или серия без имени отклоняются со статусом 400, в этом случае ничего не сохраняется
+func (h *Handlers) RemoteWrite(c echo.Context) error {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+
+	req, err := remotewrite.Decode(body)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Error decoding remote write request")
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	metrics, err := remotewrite.Metrics(req)
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Error decoding remote write request")
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if len(metrics) > 0 {
+		if err := h.storage.StoreBatch(metrics); err != nil {
+			h.logger.Error().Msgf("Error storing metric: %s", err)
+			return storeError(err)
+		}
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -1,10 +1,17 @@
 package handler
 
 import (
-	"github.com/soltanat/metrics/internal/middleware/decrypt"
+	"fmt"
+	"net"
 	"strings"
 
+	"github.com/soltanat/metrics/internal/auth"
+	"github.com/soltanat/metrics/internal/envelope"
+	"github.com/soltanat/metrics/internal/middleware/clientcert"
+	"github.com/soltanat/metrics/internal/middleware/decrypt"
+
 	"github.com/soltanat/metrics/internal/middleware/signature"
+	"github.com/soltanat/metrics/internal/middleware/subnet"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -13,9 +20,71 @@ import (
 	"github.com/soltanat/metrics/internal/logger"
 )
 
-func SetupRoutes(h *Handlers, signatureKey string, privateKey []byte) (*echo.Echo, error) {
+// RouteOption
+// Дополнительная настройка маршрутов
+type RouteOption func(*routeConfig)
+
+type routeConfig struct {
+	encryptionPolicy decrypt.Policy
+	trustedSubnet    *net.IPNet
+	signature        signature.Options
+	clientCert       bool
+	clientNames      []string
+	keyRing          *envelope.KeyRing
+}
+
+// WithEncryptionPolicy
+// Задает политику шифрования маршрутов записи метрик
+// По умолчанию зашифрованные запросы расшифровываются, незашифрованные принимаются как есть
+func WithEncryptionPolicy(policy decrypt.Policy) RouteOption {
+	return func(cfg *routeConfig) {
+		cfg.encryptionPolicy = policy
+	}
+}
+
+// WithKeyRing
+// Задает набор закрытых ключей для расшифровки запросов записи метрик вместо единственного ключа privateKey
+// Набор может обновляться во время работы сервера (см. envelope.KeyRing.Load)
+func WithKeyRing(keys *envelope.KeyRing) RouteOption {
+	return func(cfg *routeConfig) {
+		cfg.keyRing = keys
+	}
+}
+
+// WithTrustedSubnet
+// Разрешает запросы записи метрик только с адресов из доверенной подсети, адрес берется из заголовка X-Real-IP
+func WithTrustedSubnet(trusted *net.IPNet) RouteOption {
+	return func(cfg *routeConfig) {
+		cfg.trustedSubnet = trusted
+	}
+}
+
+// WithSignatureOptions
+// Задает режим проверки подписи запросов: обязательную подпись и допустимое расхождение времени
+func WithSignatureOptions(opts signature.Options) RouteOption {
+	return func(cfg *routeConfig) {
+		cfg.signature = opts
+	}
+}
+
+// WithClientCert
+// Разрешает запросы записи метрик только с проверенным сертификатом клиента
+// allowed - разрешенные имена клиентов, если пустой - разрешен любой сертификат, выпущенный CA
+func WithClientCert(allowed []string) RouteOption {
+	return func(cfg *routeConfig) {
+		cfg.clientCert = true
+		cfg.clientNames = allowed
+	}
+}
+
+func SetupRoutes(h *Handlers, signatureKey string, privateKey []byte, opts ...RouteOption) (*echo.Echo, error) {
 	l := logger.Get()
 
+	cfg := routeConfig{encryptionPolicy: decrypt.Policy{Default: decrypt.ModeOptional}}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	e := echo.New()
 
 	e.HideBanner = true
@@ -40,7 +109,9 @@ func SetupRoutes(h *Handlers, signatureKey string, privateKey []byte) (*echo.Ech
 		MinLength: 0,
 	}))
 	if signatureKey != "" {
-		e.Use(signature.SignatureMiddleware(signatureKey))
+		e.Use(signature.SignatureMiddleware(signatureKey, cfg.signature))
+	} else if cfg.signature.Strict {
+		return nil, fmt.Errorf("strict signature mode requires key")
 	}
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
 		LogURI:          true,
@@ -61,24 +132,53 @@ func SetupRoutes(h *Handlers, signatureKey string, privateKey []byte) (*echo.Ech
 	}))
 	e.Use(middleware.Recover())
 
-	storeMetricsBatch := h.StoreMetricsBatch
-
-	if len(privateKey) > 0 {
-		rsaDecMiddleware, err := decrypt.RSADecryptMiddleware(privateKey)
+	// readMiddleware, writeMiddleware - мидлвэры групп маршрутов чтения и записи метрик:
+	// аутентификация по API ключам, а для записи также сертификат клиента, доверенная подсеть и политика шифрования
+	var readMiddleware, writeMiddleware []echo.MiddlewareFunc
+	if h.keys != nil {
+		readMiddleware = append(readMiddleware, auth.Middleware(h.keys, auth.ScopeRead))
+		writeMiddleware = append(writeMiddleware, auth.Middleware(h.keys, auth.ScopeWrite))
+	}
+	if cfg.clientCert {
+		writeMiddleware = append(writeMiddleware, clientcert.ClientCertMiddleware(cfg.clientNames))
+	}
+	if cfg.trustedSubnet != nil {
+		writeMiddleware = append(writeMiddleware, subnet.TrustedSubnetMiddleware(cfg.trustedSubnet))
+	}
+	if cfg.keyRing != nil {
+		writeMiddleware = append(writeMiddleware, decrypt.KeyRingDecryptMiddleware(cfg.keyRing, cfg.encryptionPolicy))
+	} else if len(privateKey) > 0 {
+		rsaDecMiddleware, err := decrypt.RSADecryptMiddleware(privateKey, cfg.encryptionPolicy)
 		if err != nil {
 			return nil, err
 		}
-		storeMetricsBatch = rsaDecMiddleware(storeMetricsBatch)
+		writeMiddleware = append(writeMiddleware, rsaDecMiddleware)
+	} else if cfg.encryptionPolicy.Strict() {
+		return nil, fmt.Errorf("strict encryption policy requires private key")
 	}
+	e.POST("/update/:metricType/:metricName/:metricValue/", h.Store, writeMiddleware...)
+	e.POST("/update/", h.StoreMetrics, writeMiddleware...)
+	e.POST("/updates/", h.StoreMetricsBatch, writeMiddleware...)
+	e.POST("/api/v1/write/", h.RemoteWrite, writeMiddleware...)
+	e.POST("/api/v2/write/", h.InfluxWrite, writeMiddleware...)
+	e.POST("/v1/metrics/", h.OTLPMetrics, writeMiddleware...)
 
-	r := e.Router()
-	r.Add(echo.GET, "/", h.GetList)
-	r.Add(echo.GET, "/value/:metricType/:metricName/", h.Get)
-	r.Add(echo.POST, "/update/:metricType/:metricName/:metricValue/", h.Store)
-	r.Add(echo.POST, "/update/", h.StoreMetrics)
-	r.Add(echo.POST, "/updates/", storeMetricsBatch)
-	r.Add(echo.POST, "/value/", h.Value)
-	r.Add(echo.GET, "/ping/", h.Ping)
+	e.GET("/", h.GetList, readMiddleware...)
+	e.GET("/value/:metricType/:metricName/", h.Get, readMiddleware...)
+	e.POST("/value/", h.Value, readMiddleware...)
+	e.GET("/metrics/", h.Prometheus, readMiddleware...)
+	e.GET("/api/v1/series/", h.Series, readMiddleware...)
+	e.GET("/api/v1/query/", h.Query, readMiddleware...)
+	e.GET("/api/v1/alerts/", h.Alerts, readMiddleware...)
+
+	e.GET("/ping/", h.Ping)
+
+	if h.keys != nil {
+		adminMiddleware := auth.Middleware(h.keys, auth.ScopeAdmin)
+		e.GET("/api/v1/keys/", h.ListKeys, adminMiddleware)
+		e.POST("/api/v1/keys/", h.CreateKey, adminMiddleware)
+		e.DELETE("/api/v1/keys/:name/", h.RevokeKey, adminMiddleware)
+	}
 
 	return e, nil
 }
@@ -1,9 +1,65 @@
 package handler
 
+import (
+	"time"
+
+	"github.com/soltanat/metrics/internal/alerting"
+	"github.com/soltanat/metrics/internal/auth"
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/query"
+)
+
 // Metrics схема передачи метрик
 type Metrics struct {
-	ID    string   `json:"id"`              // имя метрики
-	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	ID     string            `json:"id"`               // имя метрики
+	MType  string            `json:"type"`             // параметр, принимающий значение gauge или counter
+	Delta  *int64            `json:"delta,omitempty"`  // значение метрики в случае передачи counter
+	Value  *float64          `json:"value,omitempty"`  // значение метрики в случае передачи gauge
+	Labels map[string]string `json:"labels,omitempty"` // метки метрики, входят в идентификатор метрики вместе с именем
+
+	Histogram *model.Histogram `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+
+	Observations []float64     `json:"observations,omitempty"` // наблюдения в случае передачи summary
+	Summary      *SummaryValue `json:"summary,omitempty"`      // значение summary в ответе
+}
+
+// SummaryValue схема значения summary
+type SummaryValue struct {
+	Count     int64              `json:"count"`     // количество наблюдений
+	Sum       float64            `json:"sum"`       // сумма наблюдений
+	Quantiles map[string]float64 `json:"quantiles"` // оценки квантилей, ключ - квантиль (например 0.99)
+}
+
+// Series схема передачи истории значений метрики
+type Series struct {
+	ID     string            `json:"id"`               // имя метрики
+	MType  string            `json:"type"`             // тип метрики, gauge или counter
+	Labels map[string]string `json:"labels,omitempty"` // метки метрики
+	Points []model.Point     `json:"points"`           // точки в порядке времени приема
+}
+
+// QueryResult схема результата вычисления выражения
+type QueryResult struct {
+	Query     string         `json:"query"`     // вычисленное выражение
+	Timestamp time.Time      `json:"timestamp"` // момент времени, на который вычислено выражение
+	Result    []query.Sample `json:"result"`    // значения серий
+}
+
+// Alerts схема передачи текущих оповещений
+type Alerts struct {
+	Alerts []alerting.Alert `json:"alerts"` // оповещения в состояниях pending, firing и resolved
+}
+
+// APIKey схема API ключа
+type APIKey struct {
+	Name      string       `json:"name"`                 // имя ключа
+	Scopes    []auth.Scope `json:"scopes"`               // области доступа: read, write, admin
+	Token     string       `json:"token,omitempty"`      // токен, возвращается только при создании ключа
+	CreatedAt time.Time    `json:"created_at"`           // время создания
+	RevokedAt *time.Time   `json:"revoked_at,omitempty"` // время отзыва
+}
+
+// APIKeys схема списка API ключей
+type APIKeys struct {
+	Keys []APIKey `json:"keys"`
 }
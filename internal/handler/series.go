@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// Series возвращает историю значений метрики
+// name - имя метрики
+// type - тип метрики
+// from, to - границы интервала в формате RFC3339 или unix timestamp в секундах, необязательные
+// label - метка в формате key=value, может повторяться
+func (h *Handlers) Series(c echo.Context) error {
+	name := c.QueryParam("name")
+	if name == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+	}
+
+	metricType, err := model.ParseMetricType(c.QueryParam("type"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	from, err := parseTime(c.QueryParam("from"), time.Time{})
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid from: %s", err))
+	}
+	to, err := parseTime(c.QueryParam("to"), time.Now())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid to: %s", err))
+	}
+	if to.Before(from) {
+		return echo.NewHTTPError(http.StatusBadRequest, "to is before from")
+	}
+
+	labels, err := parseLabels(c.QueryParams()["label"])
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	points, err := h.storage.GetSeries(metricType, name, labels, from, to)
+	if errors.Is(err, model.ErrInvalidMetricType) {
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("series are not stored for %s", metricType))
+	}
+	if err != nil {
+		h.logger.Error().Err(err).Msg("Error getting series")
+		return echo.ErrInternalServerError
+	}
+
+	return c.JSON(http.StatusOK, Series{
+		ID:     name,
+		MType:  metricType.String(),
+		Labels: labels,
+		Points: points,
+	})
+}
+
+// parseTime
+// Разбирает время в формате RFC3339 или unix timestamp в секундах
+// Для пустой строки возвращает def
+func parseTime(raw string, def time.Time) (time.Time, error) {
+	if raw == "" {
+		return def, nil
+	}
+	if sec, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+// parseLabels
+// Разбирает метки из списка строк формата key=value
+func parseLabels(raw []string) (model.Labels, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	labels := make(model.Labels, len(raw))
+	for _, r := range raw {
+		k, v, ok := strings.Cut(r, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", r)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
@@ -0,0 +1,314 @@
+// Package influx
+// Разбор протокола InfluxDB line protocol:
+//
+//	measurement[,tag=value...] field=value[,field=value...] [timestamp]
+package influx
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// FieldKind
+// Тип значения поля
+type FieldKind int
+
+const (
+	// FieldFloat число с плавающей точкой: 1, 1.5, -1e3
+	FieldFloat FieldKind = iota
+	// FieldInteger целое со знаком: 1i
+	FieldInteger
+	// FieldUnsigned целое без знака: 1u, не больше максимального int64
+	FieldUnsigned
+	// FieldBool логическое значение: t, true, f, false
+	FieldBool
+	// FieldString строка в кавычках: "value"
+	FieldString
+)
+
+// Field
+// Поле точки, заполнено значение, соответствующее Kind
+type Field struct {
+	Key      string
+	Kind     FieldKind
+	Float    float64
+	Integer  int64
+	Unsigned uint64
+	Bool     bool
+	String   string
+}
+
+// Line
+// Разобранная строка протокола
+// Timestamp - нулевое время, если метка времени не передана. Хранилище не поддерживает запись значений
+// на прошедшее время, поэтому метка времени только проверяется и не используется в Metrics
+type Line struct {
+	Measurement string
+	Tags        model.Labels
+	Fields      []Field
+	Timestamp   time.Time
+}
+
+// ParseError
+// Ошибка разбора строки протокола, Line - номер строки начиная с 1
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// precisions
+// Единицы метки времени по значениям параметра precision
+var precisions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"ms": time.Millisecond,
+	"s":  time.Second,
+}
+
+// ParsePrecision
+// Разбирает единицу метки времени: ns, us, ms или s, пустое значение - ns
+func ParsePrecision(raw string) (time.Duration, error) {
+	if raw == "" {
+		return time.Nanosecond, nil
+	}
+	p, ok := precisions[raw]
+	if !ok {
+		return 0, fmt.Errorf("invalid precision %q, expected ns, us, ms or s", raw)
+	}
+	return p, nil
+}
+
+// Parse
+// Разбирает строки протокола, пустые строки и комментарии (#) пропускаются
+// precision - единица метки времени, метка времени, которая в наносекундах не помещается в int64, считается ошибкой
+// Возвращает *ParseError для первой некорректной строки
+func Parse(data []byte, precision time.Duration) ([]Line, error) {
+	var lines []Line
+	for i, raw := range bytes.Split(data, []byte{'\n'}) {
+		s := strings.TrimSpace(string(raw))
+		if s == "" || s[0] == '#' {
+			continue
+		}
+		line, err := parseLine(s, precision)
+		if err != nil {
+			return nil, &ParseError{Line: i + 1, Msg: err.Error()}
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+func parseLine(s string, precision time.Duration) (Line, error) {
+	var line Line
+
+	measurement, rest, sep := scan(s, ", ")
+	if measurement == "" {
+		return line, fmt.Errorf("missing measurement")
+	}
+	line.Measurement = unescape(measurement)
+
+	for sep == ',' {
+		var tag string
+		tag, rest, sep = scan(rest, ", ")
+		key, value, ok := splitPair(tag)
+		if !ok || key == "" || value == "" {
+			return line, fmt.Errorf("invalid tag %q", tag)
+		}
+		if line.Tags == nil {
+			line.Tags = make(model.Labels)
+		}
+		line.Tags[key] = value
+	}
+	if sep != ' ' {
+		return line, fmt.Errorf("missing fields")
+	}
+
+	for {
+		field, err := parseField(&rest)
+		if err != nil {
+			return line, err
+		}
+		line.Fields = append(line.Fields, field)
+		if rest == "" || rest[0] == ' ' {
+			break
+		}
+		rest = rest[1:]
+	}
+
+	rest = strings.TrimLeft(rest, " ")
+	if rest == "" {
+		return line, nil
+	}
+	ts, err := strconv.ParseInt(rest, 10, 64)
+	if err != nil {
+		return line, fmt.Errorf("invalid timestamp %q", rest)
+	}
+	// метка времени в наносекундах должна помещаться в int64, иначе умножение переполнится
+	if ts > math.MaxInt64/int64(precision) || ts < math.MinInt64/int64(precision) {
+		return line, fmt.Errorf("timestamp %d out of range", ts)
+	}
+	line.Timestamp = time.Unix(0, ts*int64(precision))
+	return line, nil
+}
+
+// parseField
+// Разбирает поле key=value в начале s, s сдвигается на следующий за значением символ (',' или ' ')
+func parseField(s *string) (Field, error) {
+	var field Field
+
+	key, rest, sep := scan(*s, "=, ")
+	if key == "" || sep != '=' {
+		return field, fmt.Errorf("invalid field %q", key)
+	}
+	key = unescape(key)
+	field.Key = key
+
+	if strings.HasPrefix(rest, `"`) {
+		value, n, err := scanString(rest)
+		if err != nil {
+			return field, fmt.Errorf("field %q: %w", key, err)
+		}
+		field.Kind = FieldString
+		field.String = value
+		*s = rest[n:]
+		if *s != "" && (*s)[0] != ',' && (*s)[0] != ' ' {
+			return field, fmt.Errorf("field %q: unexpected data after string", key)
+		}
+		return field, nil
+	}
+
+	end := strings.IndexAny(rest, ", ")
+	if end < 0 {
+		end = len(rest)
+	}
+	raw := rest[:end]
+	*s = rest[end:]
+
+	var err error
+	switch {
+	case raw == "":
+		return field, fmt.Errorf("field %q: missing value", key)
+	case strings.HasSuffix(raw, "i"):
+		field.Kind = FieldInteger
+		field.Integer, err = strconv.ParseInt(raw[:len(raw)-1], 10, 64)
+	case strings.HasSuffix(raw, "u"):
+		field.Kind = FieldUnsigned
+		// значение должно помещаться в counter
+		field.Unsigned, err = strconv.ParseUint(raw[:len(raw)-1], 10, 63)
+	case raw == "t" || raw == "T" || raw == "true" || raw == "True" || raw == "TRUE":
+		field.Kind = FieldBool
+		field.Bool = true
+	case raw == "f" || raw == "F" || raw == "false" || raw == "False" || raw == "FALSE":
+		field.Kind = FieldBool
+	default:
+		field.Kind = FieldFloat
+		field.Float, err = strconv.ParseFloat(raw, 64)
+		if err == nil && (math.IsNaN(field.Float) || math.IsInf(field.Float, 0)) {
+			err = fmt.Errorf("not a finite number")
+		}
+	}
+	if err != nil {
+		return field, fmt.Errorf("field %q: invalid value %q", key, raw)
+	}
+	return field, nil
+}
+
+// scan
+// Читает s до первого неэкранированного символа из stops, экранированные \ символы пропускаются
+// Возвращает прочитанное значение без снятия экранирования, остаток после разделителя и сам разделитель
+// (0 в конце строки)
+func scan(s, stops string) (string, string, byte) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			continue
+		}
+		if strings.IndexByte(stops, s[i]) >= 0 {
+			return s[:i], s[i+1:], s[i]
+		}
+	}
+	return s, "", 0
+}
+
+// splitPair
+// Разделяет key=value по первому неэкранированному = и снимает экранирование
+func splitPair(s string) (string, string, bool) {
+	key, value, sep := scan(s, "=")
+	if sep != '=' {
+		return "", "", false
+	}
+	return unescape(key), unescape(value), true
+}
+
+var unescaper = strings.NewReplacer(`\=`, `=`, `\,`, `,`, `\ `, ` `, `\\`, `\`)
+
+// unescape
+// Снимает экранирование с имени measurement, ключа или значения тега и ключа поля
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
+
+// scanString
+// Читает строковое значение в кавычках в начале s, возвращает значение и количество прочитанных байт
+func scanString(s string) (string, int, error) {
+	b := strings.Builder{}
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\'):
+			b.WriteByte(s[i+1])
+			i++
+		case c == '"':
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// Metrics
+// Преобразует строки протокола в метрики
+// Имя метрики - measurement_field, для поля value - measurement, теги становятся метками
+// Целые поля (i и u) сохраняются как counter, числа с плавающей точкой и логические значения (0 или 1) - как gauge,
+// строковые поля пропускаются, метки времени строк не учитываются
+func Metrics(lines []Line) []model.Metric {
+	var metrics []model.Metric
+	for _, line := range lines {
+		for _, field := range line.Fields {
+			name := line.Measurement + "_" + field.Key
+			if field.Key == "value" {
+				name = line.Measurement
+			}
+
+			var m *model.Metric
+			switch field.Kind {
+			case FieldFloat:
+				m = model.NewGauge(name, field.Float)
+			case FieldInteger:
+				m = model.NewCounter(name, field.Integer)
+			case FieldUnsigned:
+				m = model.NewCounter(name, int64(field.Unsigned))
+			case FieldBool:
+				m = model.NewGauge(name, 0)
+				if field.Bool {
+					m.Gauge = 1
+				}
+			default:
+				continue
+			}
+			m.Labels = line.Tags
+			metrics = append(metrics, *m)
+		}
+	}
+	return metrics
+}
@@ -0,0 +1,152 @@
+package influx
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		precision time.Duration
+		want      []Line
+	}{
+		{
+			name: "fields without tags",
+			data: "cpu value=0.5",
+			want: []Line{{Measurement: "cpu", Fields: []Field{{Key: "value", Kind: FieldFloat, Float: 0.5}}}},
+		},
+		{
+			name: "tags, fields and timestamp",
+			data: "mem,host=a,region=eu used=10i,free=2u,ratio=-1e3,ok=t,state=\"running\" 1700000000000000000",
+			want: []Line{{
+				Measurement: "mem",
+				Tags:        model.Labels{"host": "a", "region": "eu"},
+				Fields: []Field{
+					{Key: "used", Kind: FieldInteger, Integer: 10},
+					{Key: "free", Kind: FieldUnsigned, Unsigned: 2},
+					{Key: "ratio", Kind: FieldFloat, Float: -1000},
+					{Key: "ok", Kind: FieldBool, Bool: true},
+					{Key: "state", Kind: FieldString, String: "running"},
+				},
+				Timestamp: time.Unix(1700000000, 0),
+			}},
+		},
+		{
+			name:      "precision",
+			data:      "cpu value=1 1700000000",
+			precision: time.Second,
+			want: []Line{{
+				Measurement: "cpu",
+				Fields:      []Field{{Key: "value", Kind: FieldFloat, Float: 1}},
+				Timestamp:   time.Unix(1700000000, 0),
+			}},
+		},
+		{
+			name: "escaping",
+			data: `disk\ io,path=/mnt/a\,b,dev\=x=sd\ a bytes\ read=1i,msg="a \"quoted\", spaced\\ string"`,
+			want: []Line{{
+				Measurement: "disk io",
+				Tags:        model.Labels{"path": "/mnt/a,b", "dev=x": "sd a"},
+				Fields: []Field{
+					{Key: "bytes read", Kind: FieldInteger, Integer: 1},
+					{Key: "msg", Kind: FieldString, String: `a "quoted", spaced\ string`},
+				},
+			}},
+		},
+		{
+			name: "several lines with comments and blank lines",
+			data: "# comment\ncpu value=1\n\r\n  \nmem value=2\r\n",
+			want: []Line{
+				{Measurement: "cpu", Fields: []Field{{Key: "value", Kind: FieldFloat, Float: 1}}},
+				{Measurement: "mem", Fields: []Field{{Key: "value", Kind: FieldFloat, Float: 2}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			precision := tt.precision
+			if precision == 0 {
+				precision = time.Nanosecond
+			}
+			got, err := Parse([]byte(tt.data), precision)
+			require.NoError(t, err)
+			require.Len(t, got, len(tt.want))
+			for i := range tt.want {
+				assert.Equal(t, tt.want[i].Measurement, got[i].Measurement)
+				assert.Equal(t, tt.want[i].Tags, got[i].Tags)
+				assert.Equal(t, tt.want[i].Fields, got[i].Fields)
+				assert.True(t, tt.want[i].Timestamp.Equal(got[i].Timestamp), "timestamp %s", got[i].Timestamp)
+			}
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		precision time.Duration
+		wantLine  int
+	}{
+		{name: "missing fields", data: "cpu", wantLine: 1},
+		{name: "missing fields after tags", data: "cpu,host=a", wantLine: 1},
+		{name: "empty measurement", data: ",host=a value=1", wantLine: 1},
+		{name: "invalid tag", data: "cpu,host value=1", wantLine: 1},
+		{name: "empty tag value", data: "cpu,host= value=1", wantLine: 1},
+		{name: "invalid float", data: "cpu value=abc", wantLine: 1},
+		{name: "invalid integer", data: "cpu value=1.5i", wantLine: 1},
+		{name: "unsigned overflows counter", data: "cpu value=18446744073709551615u", wantLine: 1},
+		{name: "not finite", data: "cpu value=NaN", wantLine: 1},
+		{name: "missing value", data: "cpu value=", wantLine: 1},
+		{name: "field without value", data: "cpu value", wantLine: 1},
+		{name: "unterminated string", data: `cpu msg="abc`, wantLine: 1},
+		{name: "invalid timestamp", data: "cpu value=1 abc", wantLine: 1},
+		{name: "timestamp overflows", data: "cpu value=1 1700000000\ncpu value=2 9223372037", precision: time.Second, wantLine: 2},
+		{name: "negative timestamp overflows", data: "cpu value=1 -9223372037", precision: time.Second, wantLine: 1},
+		{name: "second line", data: "cpu value=1\n\nmem value=x", wantLine: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			precision := tt.precision
+			if precision == 0 {
+				precision = time.Nanosecond
+			}
+			_, err := Parse([]byte(tt.data), precision)
+			var parseErr *ParseError
+			require.True(t, errors.As(err, &parseErr), "error %v", err)
+			assert.Equal(t, tt.wantLine, parseErr.Line)
+		})
+	}
+}
+
+func TestParsePrecision(t *testing.T) {
+	for raw, want := range map[string]time.Duration{"": time.Nanosecond, "ns": time.Nanosecond, "us": time.Microsecond, "ms": time.Millisecond, "s": time.Second} {
+		got, err := ParsePrecision(raw)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParsePrecision("m")
+	assert.Error(t, err)
+}
+
+func TestMetrics(t *testing.T) {
+	lines, err := Parse([]byte("mem,host=a used=10i,free=2u,ratio=0.5,ok=f,state=\"up\"\ncpu value=1.5"), time.Nanosecond)
+	require.NoError(t, err)
+
+	labels := model.Labels{"host": "a"}
+	assert.Equal(t, []model.Metric{
+		{Type: model.MetricTypeCounter, Name: "mem_used", Counter: 10, Labels: labels},
+		{Type: model.MetricTypeCounter, Name: "mem_free", Counter: 2, Labels: labels},
+		{Type: model.MetricTypeGauge, Name: "mem_ratio", Gauge: 0.5, Labels: labels},
+		{Type: model.MetricTypeGauge, Name: "mem_ok", Gauge: 0, Labels: labels},
+		{Type: model.MetricTypeGauge, Name: "cpu", Gauge: 1.5},
+	}, Metrics(lines))
+}
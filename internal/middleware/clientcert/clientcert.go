@@ -0,0 +1,35 @@
+// Package clientcert
+// Мидлвэр для аутентификации агентов по сертификату клиента
+package clientcert
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/soltanat/metrics/internal/tlsconfig"
+)
+
+// ClientCertMiddleware
+// Реализует мидлвэр, который пропускает только запросы с проверенным сертификатом клиента
+// allowed - разрешенные имена клиентов (Common Name сертификата), если пустой - разрешен любой сертификат, выпущенный CA
+// Запрос без сертификата или с неразрешенным именем отклоняется со статусом 403
+func ClientCertMiddleware(allowed []string) echo.MiddlewareFunc {
+	names := make(map[string]struct{}, len(allowed))
+	for _, name := range allowed {
+		names[name] = struct{}{}
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			identity, ok := tlsconfig.Identity(c.Request().TLS)
+			if !ok {
+				return echo.NewHTTPError(http.StatusForbidden, "client certificate is required")
+			}
+			if _, ok := names[identity]; len(names) > 0 && !ok {
+				return echo.NewHTTPError(http.StatusForbidden, "client certificate is not allowed")
+			}
+			return next(c)
+		}
+	}
+}
@@ -1,44 +1,70 @@
+// Package decrypt
+// Мидлвэр для расшифровки тела запроса
 package decrypt
 
 import (
 	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"fmt"
-	"github.com/labstack/echo/v4"
+	"errors"
 	"io"
 	"net/http"
-)
 
-func RSADecryptMiddleware(key []byte) (echo.MiddlewareFunc, error) {
-	block, _ := pem.Decode(key)
-	if block == nil {
-		return nil, fmt.Errorf("invalid block type")
-	}
+	"github.com/labstack/echo/v4"
 
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	"github.com/soltanat/metrics/internal/envelope"
+)
+
+// RSADecryptMiddleware
+// Реализует мидлвэр, который расшифровывает тело запроса закрытым ключом key (см. KeyRingDecryptMiddleware)
+func RSADecryptMiddleware(key []byte, policy Policy) (echo.MiddlewareFunc, error) {
+	privateKey, err := envelope.ParsePrivateKey(key)
 	if err != nil {
 		return nil, err
 	}
+	return KeyRingDecryptMiddleware(envelope.NewKeyRing(privateKey), policy), nil
+}
 
+// KeyRingDecryptMiddleware
+// Реализует мидлвэр, который расшифровывает тело запроса, зашифрованное envelope.Seal
+// Сеансовый ключ берется из заголовка X-Encrypted-Key и расшифровывается ключом из набора keys,
+// выбранным по заголовку X-Key-ID, а без этого заголовка - перебором всех ключей набора
+// Режим для запроса выбирается политикой по пути: в режиме strict запрос без заголовка отклоняется,
+// в режиме optional принимается как есть, в режиме off тело не расшифровывается
+// Запрос с поврежденным телом или неизвестным идентификатором ключа отклоняется со статусом 400
+func KeyRingDecryptMiddleware(keys *envelope.KeyRing, policy Policy) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
+			mode := policy.Mode(c.Request().URL.Path)
+			if mode == ModeOff {
+				return next(c)
+			}
+
+			encryptedKey := c.Request().Header.Get(envelope.KeyHeader)
+			if encryptedKey == "" {
+				if mode == ModeStrict {
+					return echo.NewHTTPError(http.StatusBadRequest, "encrypted body is required")
+				}
+				return next(c)
+			}
+
 			encryptedBody, err := io.ReadAll(c.Request().Body)
 			if err != nil {
 				return c.NoContent(http.StatusBadRequest)
 			}
 
-			decryptedBody, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, encryptedBody)
-			fmt.Println(string(decryptedBody))
+			decryptedBody, err := keys.Open(c.Request().Header.Get(envelope.KeyIDHeader), encryptedKey, encryptedBody)
+			if errors.Is(err, envelope.ErrUnknownKey) {
+				return echo.NewHTTPError(http.StatusBadRequest, "unknown key id")
+			}
 			if err != nil {
 				return c.NoContent(http.StatusBadRequest)
 			}
 
 			c.Request().Body = io.NopCloser(bytes.NewBuffer(decryptedBody))
+			c.Request().ContentLength = int64(len(decryptedBody))
+			c.Request().Header.Del(envelope.KeyHeader)
+			c.Request().Header.Del(envelope.KeyIDHeader)
 
 			return next(c)
 		}
-	}, nil
+	}
 }
@@ -0,0 +1,148 @@
+package decrypt_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/client"
+	"github.com/soltanat/metrics/internal/envelope"
+	"github.com/soltanat/metrics/internal/middleware/decrypt"
+)
+
+func TestRSADecryptMiddleware(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&key.PublicKey)})
+
+	decryptMiddleware, err := decrypt.RSADecryptMiddleware(privatePEM, decrypt.Policy{Default: decrypt.ModeStrict})
+	require.NoError(t, err)
+
+	// сервер возвращает sha256 расшифрованного тела
+	e := echo.New()
+	e.Use(middleware.Decompress())
+	e.POST("/updates/", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		h := sha256.Sum256(body)
+		return c.String(http.StatusOK, hex.EncodeToString(h[:]))
+	}, decryptMiddleware)
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	// транспорт агента: шифрование, затем сжатие
+	encryption, err := client.NewRSAEncryptionTransport(&client.GzipTransport{Transport: http.DefaultTransport}, publicPEM)
+	require.NoError(t, err)
+	httpClient := &http.Client{Transport: encryption}
+
+	tests := []struct {
+		name string
+		size int
+	}{
+		{name: "small batch", size: 512},
+		{name: "larger than modulus", size: 64 << 10},
+		{name: "several megabytes", size: 6 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := make([]byte, tt.size)
+			_, err := rand.Read(body)
+			require.NoError(t, err)
+
+			resp, err := httpClient.Post(srv.URL+"/updates/", "application/json", bytes.NewReader(body))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			got, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			h := sha256.Sum256(body)
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, hex.EncodeToString(h[:]), string(got))
+		})
+	}
+
+	t.Run("unencrypted body", func(t *testing.T) {
+		resp, err := http.Post(srv.URL+"/updates/", "application/json", bytes.NewReader([]byte(`[]`)))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestKeyRingDecryptMiddleware(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keys := envelope.NewKeyRing(oldKey, newKey)
+
+	e := echo.New()
+	e.POST("/updates/", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body))
+	}, decrypt.KeyRingDecryptMiddleware(keys, decrypt.Policy{Default: decrypt.ModeStrict}))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	post := func(t *testing.T, pub *rsa.PublicKey, keyID string) *http.Response {
+		transport := &client.RSAEncryptionTransport{Transport: http.DefaultTransport, Key: pub, KeyID: keyID}
+		resp, err := (&http.Client{Transport: transport}).Post(srv.URL+"/updates/", "application/json", bytes.NewReader([]byte(`[]`)))
+		require.NoError(t, err)
+		return resp
+	}
+
+	tests := []struct {
+		name       string
+		key        *rsa.PublicKey
+		keyID      string
+		wantStatus int
+	}{
+		{name: "old key", key: &oldKey.PublicKey, keyID: envelope.KeyID(&oldKey.PublicKey), wantStatus: http.StatusOK},
+		{name: "new key", key: &newKey.PublicKey, keyID: envelope.KeyID(&newKey.PublicKey), wantStatus: http.StatusOK},
+		{name: "without key id", key: &newKey.PublicKey, wantStatus: http.StatusOK},
+		{name: "unknown key id", key: &newKey.PublicKey, keyID: "0000000000000000", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := post(t, tt.key, tt.keyID)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, `[]`, string(body))
+			}
+		})
+	}
+
+	t.Run("old key removed", func(t *testing.T) {
+		keys.Set(newKey)
+
+		resp := post(t, &oldKey.PublicKey, envelope.KeyID(&oldKey.PublicKey))
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp = post(t, &newKey.PublicKey, envelope.KeyID(&newKey.PublicKey))
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+}
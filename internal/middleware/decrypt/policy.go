@@ -0,0 +1,113 @@
+package decrypt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Mode
+// Режим шифрования тела запроса
+type Mode int
+
+const (
+	// ModeOff тело запроса не расшифровывается
+	ModeOff Mode = iota
+	// ModeOptional тело расшифровывается, если передан заголовок X-Encrypted-Key, иначе принимается как есть
+	ModeOptional
+	// ModeStrict запросы без заголовка X-Encrypted-Key отклоняются
+	ModeStrict
+)
+
+var modeNames = map[string]Mode{
+	"off":      ModeOff,
+	"optional": ModeOptional,
+	"strict":   ModeStrict,
+}
+
+// ParseMode
+// Разбирает режим шифрования: off, optional или strict
+func ParseMode(raw string) (Mode, error) {
+	mode, ok := modeNames[strings.TrimSpace(raw)]
+	if !ok {
+		return ModeOff, fmt.Errorf("unknown encryption mode %q, expected off, optional or strict", raw)
+	}
+	return mode, nil
+}
+
+func (m Mode) String() string {
+	for k, v := range modeNames {
+		if v == m {
+			return k
+		}
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// Policy
+// Политика шифрования группы маршрутов
+// Default - режим по умолчанию, Routes - режимы для префиксов пути, выбирается самый длинный совпавший префикс
+type Policy struct {
+	Default Mode
+	Routes  map[string]Mode
+}
+
+// ParsePolicy
+// Разбирает политику в формате mode[,prefix=mode...], например strict,/update/=optional
+// Запись без префикса задает режим по умолчанию
+func ParsePolicy(raw string) (Policy, error) {
+	p := Policy{Default: ModeOptional, Routes: make(map[string]Mode)}
+	if strings.TrimSpace(raw) == "" {
+		return p, nil
+	}
+	for _, part := range strings.Split(raw, ",") {
+		prefix, modeRaw, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			mode, err := ParseMode(prefix)
+			if err != nil {
+				return Policy{}, err
+			}
+			p.Default = mode
+			continue
+		}
+		if !strings.HasPrefix(prefix, "/") {
+			return Policy{}, fmt.Errorf("invalid route prefix %q, expected path starting with /", prefix)
+		}
+		mode, err := ParseMode(modeRaw)
+		if err != nil {
+			return Policy{}, err
+		}
+		p.Routes[prefix] = mode
+	}
+	return p, nil
+}
+
+// Mode
+// Возвращает режим шифрования для пути запроса
+func (p Policy) Mode(path string) Mode {
+	prefixes := make([]string, 0, len(p.Routes))
+	for prefix := range p.Routes {
+		if strings.HasPrefix(path, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return p.Default
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+	return p.Routes[prefixes[0]]
+}
+
+// Strict
+// Возвращает true, если хотя бы для одного маршрута требуется шифрование
+func (p Policy) Strict() bool {
+	if p.Default == ModeStrict {
+		return true
+	}
+	for _, mode := range p.Routes {
+		if mode == ModeStrict {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package decrypt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    Policy
+		wantErr bool
+	}{
+		{name: "empty", raw: "", want: Policy{Default: ModeOptional, Routes: map[string]Mode{}}},
+		{name: "default only", raw: "strict", want: Policy{Default: ModeStrict, Routes: map[string]Mode{}}},
+		{
+			name: "routes",
+			raw:  "strict, /update/=optional,/updates/=off",
+			want: Policy{Default: ModeStrict, Routes: map[string]Mode{"/update/": ModeOptional, "/updates/": ModeOff}},
+		},
+		{name: "unknown mode", raw: "always", wantErr: true},
+		{name: "unknown route mode", raw: "/update/=always", wantErr: true},
+		{name: "invalid prefix", raw: "update=strict", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePolicy(tt.raw)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPolicy_Mode(t *testing.T) {
+	p, err := ParsePolicy("optional,/update/=strict,/update/gauge/=off")
+	require.NoError(t, err)
+
+	assert.Equal(t, ModeOptional, p.Mode("/updates/"))
+	assert.Equal(t, ModeStrict, p.Mode("/update/"))
+	assert.Equal(t, ModeStrict, p.Mode("/update/counter/name/1/"))
+	assert.Equal(t, ModeOff, p.Mode("/update/gauge/name/1/"))
+	assert.True(t, p.Strict())
+
+	p, err = ParsePolicy("off,/updates/=optional")
+	require.NoError(t, err)
+	assert.False(t, p.Strict())
+}
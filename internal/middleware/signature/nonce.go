@@ -0,0 +1,45 @@
+package signature
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceCache
+// Одноразовые значения принятых запросов
+// Значение хранится, пока запрос с ним может пройти проверку времени подписи, после этого удаляется
+// Один кеш используется HTTP и gRPC API, чтобы подписанный запрос нельзя было повторить через другой API
+type NonceCache struct {
+	mu        sync.Mutex
+	expires   map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewNonceCache
+// Создает NonceCache
+func NewNonceCache() *NonceCache {
+	return &NonceCache{expires: make(map[string]time.Time)}
+}
+
+// add
+// Запоминает одноразовое значение до expiresAt
+// Возвращает false, если значение уже использовалось и еще не истекло
+func (c *NonceCache) add(nonce string, expiresAt, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if now.Sub(c.lastSweep) > time.Minute {
+		for k, exp := range c.expires {
+			if !exp.After(now) {
+				delete(c.expires, k)
+			}
+		}
+		c.lastSweep = now
+	}
+
+	if exp, ok := c.expires[nonce]; ok && exp.After(now) {
+		return false
+	}
+	c.expires[nonce] = expiresAt
+	return true
+}
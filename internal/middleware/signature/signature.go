@@ -4,24 +4,80 @@ package signature
 
 import (
 	"bytes"
+	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
-	"hash"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
+const (
+	// HeaderSignature заголовок с HMAC-SHA256 подписью запроса или ответа в hex
+	HeaderSignature = "HashSHA256"
+	// HeaderTimestamp заголовок с временем подписи запроса, unix timestamp в секундах
+	HeaderTimestamp = "X-Signature-Timestamp"
+	// HeaderNonce заголовок с одноразовым значением запроса
+	HeaderNonce = "X-Signature-Nonce"
+)
+
+// DefaultMaxSkew
+// Допустимое по умолчанию расхождение времени подписи запроса и времени сервера
+const DefaultMaxSkew = 5 * time.Minute
+
+// maxNonceLength
+// Максимальная длина одноразового значения
+const maxNonceLength = 64
+
+// Sign
+// Возвращает HMAC-SHA256 подпись запроса в hex
+// Подписываются время подписи, одноразовое значение и тело запроса
+func Sign(key, timestamp, nonce string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(nonce))
+	mac.Write([]byte{'\n'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignResponse
+// Возвращает HMAC-SHA256 подпись ответа в hex
+// Подписываются одноразовое значение запроса, код статуса и тело ответа, поэтому ответ нельзя подменить ответом
+// на другой запрос или изменить его статус. Для запроса без подписи одноразовое значение пустое
+func SignResponse(key, nonce string, status int, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte{'\n'})
+	mac.Write([]byte(strconv.Itoa(status)))
+	mac.Write([]byte{'\n'})
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Options
+// Настройки проверки подписи запросов
+type Options struct {
+	// Strict - запросы без подписи отклоняются, кроме GET и HEAD
+	Strict bool
+	// MaxSkew - допустимое расхождение времени подписи и времени сервера, по умолчанию DefaultMaxSkew
+	MaxSkew time.Duration
+	// Nonces - кеш одноразовых значений, если не задан - создается свой
+	Nonces *NonceCache
+}
+
 // responseWriterWithHash
-// Реализация http.ResponseWriter с поддержкой подсчета хеша
+// Реализация http.ResponseWriter, которая буферизует ответ и при закрытии добавляет его подпись (см. SignResponse)
 type responseWriterWithHash struct {
 	Writer     http.ResponseWriter
-	hash       hash.Hash
+	key        string
+	nonce      string
 	buf        *bytes.Buffer
 	statusCode int
-	n          int
 }
 
 func (w *responseWriterWithHash) Header() http.Header {
@@ -36,17 +92,16 @@ func (w *responseWriterWithHash) Write(b []byte) (int, error) {
 	if w.statusCode == 0 {
 		w.statusCode = http.StatusOK
 	}
-	n, err := w.buf.Write(b)
-	if err != nil {
-		return n, err
-	}
-	w.n += n
-	return w.hash.Write(b)
+	return w.buf.Write(b)
 }
 
 func (w *responseWriterWithHash) Close() error {
-	if w.n != 0 {
-		w.Writer.Header().Set("HashSHA256", hex.EncodeToString(w.hash.Sum(nil)))
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	w.Writer.Header().Set(HeaderSignature, SignResponse(w.key, w.nonce, w.statusCode, w.buf.Bytes()))
+	w.Writer.WriteHeader(w.statusCode)
+	if w.buf.Len() != 0 {
 		_, err := w.Writer.Write(w.buf.Bytes())
 		return err
 	}
@@ -54,41 +109,59 @@ func (w *responseWriterWithHash) Close() error {
 }
 
 // SignatureMiddleware
-// Реализует мидлвэр, который проверяет подпись запроса, а так же добавляет подпись в заголовок ответа на основе тела ответа
-func SignatureMiddleware(key string) echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			signature := c.Request().Header.Get("HashSHA256")
-
-			if signature != "" {
-				body, err := io.ReadAll(c.Request().Body)
-				if err != nil {
-					return c.NoContent(http.StatusInternalServerError)
-				}
-
-				c.Request().Body = io.NopCloser(bytes.NewBuffer(body))
+// Реализует мидлвэр, который проверяет подпись запроса, а так же добавляет подпись ответа в заголовок HashSHA256,
+// в том числе ответа об ошибке проверки
+// Подпись запроса - HMAC-SHA256 от времени подписи, одноразового значения и тела (см. Sign)
+// Запрос отклоняется со статусом 400, если подпись не совпадает, время подписи отличается от времени сервера
+// больше чем на MaxSkew или одноразовое значение уже использовалось
+// Без режима Strict запросы без заголовка HashSHA256 пропускаются без проверки
+func SignatureMiddleware(key string, opts Options) echo.MiddlewareFunc {
+	verifier := NewVerifier(key, opts)
+
+	// verify проверяет подпись запроса и возвращает его одноразовое значение, пустое для запроса без подписи
+	verify := func(req *http.Request) (string, error) {
+		signature := req.Header.Get(HeaderSignature)
+		if signature == "" {
+			if opts.Strict && req.Method != http.MethodGet && req.Method != http.MethodHead {
+				return "", echo.NewHTTPError(http.StatusBadRequest, "signature is required")
+			}
+			return "", nil
+		}
 
-				h := sha256.Sum256([]byte(string(body) + key))
-				calculatedSignature := fmt.Sprintf("%x", h)
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return "", echo.ErrInternalServerError
+		}
+		req.Body = io.NopCloser(bytes.NewBuffer(body))
 
-				if signature != calculatedSignature {
-					return c.NoContent(http.StatusBadRequest)
-				}
-			}
+		nonce := req.Header.Get(HeaderNonce)
+		if err := verifier.Verify(signature, req.Header.Get(HeaderTimestamp), nonce, body); err != nil {
+			return "", echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		return nonce, nil
+	}
 
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
 			writer := &responseWriterWithHash{
 				Writer: c.Response().Writer,
+				key:    key,
 				buf:    bytes.NewBuffer([]byte{}),
-				hash:   sha256.New(),
 			}
-			defer writer.Close()
-
 			c.Response().Writer = writer
 
-			err := next(c)
-
-			return err
+			// ошибки записываем до подписи, иначе echo запишет их после закрытия writer
+			nonce, err := verify(c.Request())
+			if err == nil {
+				writer.nonce = nonce
+				err = next(c)
+			}
+			if err != nil {
+				c.Error(err)
+			}
 
+			c.Response().Writer = writer.Writer
+			return writer.Close()
 		}
 	}
 }
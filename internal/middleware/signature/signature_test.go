@@ -0,0 +1,173 @@
+package signature_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/client"
+	"github.com/soltanat/metrics/internal/middleware/signature"
+)
+
+const key = "secret"
+
+func newServer(t *testing.T, opts signature.Options) *httptest.Server {
+	e := echo.New()
+	e.Use(signature.SignatureMiddleware(key, opts))
+	e.POST("/updates/", func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		return c.String(http.StatusOK, string(body))
+	})
+	e.POST("/fail/", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusBadRequest, "bad metric")
+	})
+	e.GET("/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "list")
+	})
+	srv := httptest.NewServer(e)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func signedRequest(t *testing.T, url, k string, signedAt time.Time, nonce string, body []byte) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	require.NoError(t, err)
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	req.Header.Set(signature.HeaderTimestamp, timestamp)
+	req.Header.Set(signature.HeaderNonce, nonce)
+	req.Header.Set(signature.HeaderSignature, signature.Sign(k, timestamp, nonce, body))
+	return req
+}
+
+func TestSignatureMiddleware(t *testing.T) {
+	srv := newServer(t, signature.Options{Strict: true, MaxSkew: time.Minute})
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1}]`)
+
+	tests := []struct {
+		name     string
+		req      func() *http.Request
+		wantCode int
+	}{
+		{
+			name:     "valid signature",
+			req:      func() *http.Request { return signedRequest(t, srv.URL+"/updates/", key, time.Now(), "n1", body) },
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "replayed nonce",
+			req:      func() *http.Request { return signedRequest(t, srv.URL+"/updates/", key, time.Now(), "n1", body) },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "wrong key",
+			req:      func() *http.Request { return signedRequest(t, srv.URL+"/updates/", "other", time.Now(), "n2", body) },
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "modified body",
+			req: func() *http.Request {
+				req := signedRequest(t, srv.URL+"/updates/", key, time.Now(), "n3", body)
+				req.Body = io.NopCloser(bytes.NewReader([]byte(`[]`)))
+				req.ContentLength = 2
+				return req
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "stale timestamp",
+			req: func() *http.Request {
+				return signedRequest(t, srv.URL+"/updates/", key, time.Now().Add(-2*time.Minute), "n4", body)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "timestamp from future",
+			req: func() *http.Request {
+				return signedRequest(t, srv.URL+"/updates/", key, time.Now().Add(2*time.Minute), "n5", body)
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "missing nonce",
+			req: func() *http.Request {
+				req := signedRequest(t, srv.URL+"/updates/", key, time.Now(), "n6", body)
+				req.Header.Del(signature.HeaderNonce)
+				return req
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "unsigned write in strict mode",
+			req: func() *http.Request {
+				req, err := http.NewRequest(http.MethodPost, srv.URL+"/updates/", bytes.NewReader(body))
+				require.NoError(t, err)
+				return req
+			},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name: "unsigned read in strict mode",
+			req: func() *http.Request {
+				req, err := http.NewRequest(http.MethodGet, srv.URL+"/", nil)
+				require.NoError(t, err)
+				return req
+			},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "handler error keeps status",
+			req:      func() *http.Request { return signedRequest(t, srv.URL+"/fail/", key, time.Now(), "n7", body) },
+			wantCode: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := http.DefaultClient.Do(tt.req())
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.wantCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestSignatureMiddleware_Optional(t *testing.T) {
+	srv := newServer(t, signature.Options{})
+
+	resp, err := http.Post(srv.URL+"/updates/", "application/json", bytes.NewReader([]byte(`[]`)))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, signature.SignResponse(key, "", http.StatusOK, got), resp.Header.Get(signature.HeaderSignature))
+}
+
+func TestSignatureTransport(t *testing.T) {
+	srv := newServer(t, signature.Options{Strict: true})
+	httpClient := &http.Client{Transport: &client.SignatureTransport{Transport: http.DefaultTransport, Key: key}}
+
+	// каждый запрос получает новое одноразовое значение, поэтому повторная отправка того же тела проходит
+	for i := 0; i < 3; i++ {
+		resp, err := httpClient.Post(srv.URL+"/updates/", "application/json", bytes.NewReader([]byte(`[]`)))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// сервер отклоняет запрос с чужим ключом, а клиент не принимает ответ, подписанный другим ключом
+	_, err := (&http.Client{Transport: &client.SignatureTransport{Transport: http.DefaultTransport, Key: "other"}}).
+		Post(srv.URL+"/updates/", "application/json", bytes.NewReader([]byte(`[]`)))
+	assert.ErrorIs(t, err, client.ErrResponseSignature)
+}
@@ -0,0 +1,67 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrInvalidNonce одноразовое значение не задано или слишком длинное
+	ErrInvalidNonce = errors.New("invalid signature nonce")
+	// ErrInvalidTimestamp время подписи не является unix timestamp
+	ErrInvalidTimestamp = errors.New("invalid signature timestamp")
+	// ErrInvalidSignature подпись не совпадает
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrStaleSignature время подписи отличается от времени сервера больше чем на MaxSkew
+	ErrStaleSignature = errors.New("stale signature")
+	// ErrNonceUsed одноразовое значение уже использовалось
+	ErrNonceUsed = errors.New("signature nonce already used")
+)
+
+// Verifier
+// Проверяет подписи запросов (см. Sign) и запоминает их одноразовые значения
+type Verifier struct {
+	key     string
+	maxSkew time.Duration
+	nonces  *NonceCache
+}
+
+// NewVerifier
+// Создает Verifier, opts.Strict не используется: решение о запросах без подписи принимает вызывающий код
+func NewVerifier(key string, opts Options) *Verifier {
+	if opts.MaxSkew <= 0 {
+		opts.MaxSkew = DefaultMaxSkew
+	}
+	if opts.Nonces == nil {
+		opts.Nonces = NewNonceCache()
+	}
+	return &Verifier{key: key, maxSkew: opts.MaxSkew, nonces: opts.Nonces}
+}
+
+// Verify
+// Проверяет подпись signature тела body, время подписи timestamp и одноразовое значение nonce
+// Подпись сравнивается за постоянное время, одноразовое значение запоминается только для верной подписи
+func (v *Verifier) Verify(signature, timestamp, nonce string, body []byte) error {
+	if nonce == "" || len(nonce) > maxNonceLength {
+		return ErrInvalidNonce
+	}
+	sec, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidTimestamp
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(v.key, timestamp, nonce, body))) {
+		return ErrInvalidSignature
+	}
+
+	now := time.Now()
+	signedAt := time.Unix(sec, 0)
+	if signedAt.Before(now.Add(-v.maxSkew)) || signedAt.After(now.Add(v.maxSkew)) {
+		return ErrStaleSignature
+	}
+	if !v.nonces.add(nonce, signedAt.Add(v.maxSkew), now) {
+		return ErrNonceUsed
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Package subnet
+// Мидлвэр для проверки адреса клиента по доверенной подсети
+package subnet
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RealIPHeader
+// Заголовок, в котором агент передает адрес своего исходящего интерфейса
+const RealIPHeader = "X-Real-IP"
+
+// TrustedSubnetMiddleware
+// Реализует мидлвэр, который пропускает только запросы с адресом из заголовка X-Real-IP, входящим в доверенную подсеть
+// Запрос без заголовка, с некорректным адресом или адресом вне подсети отклоняется со статусом 403
+func TrustedSubnetMiddleware(trusted *net.IPNet) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ip := net.ParseIP(c.Request().Header.Get(RealIPHeader))
+			if ip == nil || !trusted.Contains(ip) {
+				return echo.NewHTTPError(http.StatusForbidden, "address is not in trusted subnet")
+			}
+			return next(c)
+		}
+	}
+}
+
+// Contains
+// Проверяет, что адрес соединения addr (например отправителя пакета UDP) входит в доверенную подсеть
+// Если подсеть не задана, подходит любой адрес
+func Contains(trusted *net.IPNet, addr net.Addr) bool {
+	if trusted == nil {
+		return true
+	}
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+	return trusted.Contains(ip)
+}
@@ -0,0 +1,67 @@
+package subnet
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedSubnetMiddleware(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+
+	e := echo.New()
+	e.POST("/update/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	}, TrustedSubnetMiddleware(trusted))
+
+	tests := []struct {
+		name     string
+		realIP   string
+		wantCode int
+	}{
+		{name: "trusted", realIP: "192.168.1.10", wantCode: http.StatusOK},
+		{name: "untrusted", realIP: "10.0.0.1", wantCode: http.StatusForbidden},
+		{name: "missing header", realIP: "", wantCode: http.StatusForbidden},
+		{name: "invalid address", realIP: "not-an-ip", wantCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/update/", nil)
+			if tt.realIP != "" {
+				req.Header.Set(RealIPHeader, tt.realIP)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			assert.Equal(t, tt.wantCode, rec.Code)
+		})
+	}
+}
+
+func TestContains(t *testing.T) {
+	_, trusted, err := net.ParseCIDR("192.168.1.0/24")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		trusted *net.IPNet
+		addr    net.Addr
+		want    bool
+	}{
+		{name: "udp trusted", trusted: trusted, addr: &net.UDPAddr{IP: net.ParseIP("192.168.1.10"), Port: 8125}, want: true},
+		{name: "tcp trusted", trusted: trusted, addr: &net.TCPAddr{IP: net.ParseIP("192.168.1.10"), Port: 2003}, want: true},
+		{name: "untrusted", trusted: trusted, addr: &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8125}, want: false},
+		{name: "unknown address", trusted: trusted, addr: &net.UnixAddr{Name: "/tmp/sock"}, want: false},
+		{name: "no subnet", addr: &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 8125}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Contains(tt.trusted, tt.addr))
+		})
+	}
+}
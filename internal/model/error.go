@@ -5,3 +5,7 @@ import "fmt"
 // ErrMetricNotFound
 // Ошибка при поиске метрики
 var ErrMetricNotFound = fmt.Errorf("metric not found")
+
+// ErrAmbiguousMetric
+// Ошибка при поиске метрики без меток, если есть несколько серий с таким именем
+var ErrAmbiguousMetric = fmt.Errorf("metric is ambiguous, labels are required")
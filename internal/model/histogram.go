@@ -0,0 +1,119 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// DefaultBuckets
+// Границы бакетов гистограммы по умолчанию
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// ErrHistogramBucketsMismatch
+// Ошибка при объединении гистограмм с разными границами бакетов
+var ErrHistogramBucketsMismatch = errors.New("histogram buckets mismatch")
+
+// ErrInvalidHistogram
+// Ошибка при некорректных данных гистограммы
+var ErrInvalidHistogram = errors.New("invalid histogram")
+
+// Histogram
+// Значение метрики histogram
+// buckets: верхние границы бакетов по возрастанию
+// counts: количество наблюдений в каждом бакете, последний элемент - наблюдения больше последней границы (+Inf)
+// sum: сумма наблюдений
+// count: количество наблюдений
+type Histogram struct {
+	Buckets []float64 `json:"buckets"`
+	Counts  []int64   `json:"counts"`
+	Sum     float64   `json:"sum"`
+	Count   int64     `json:"count"`
+}
+
+// NewHistogram
+// Создает метрику histogram с пустой гистограммой
+// buckets - верхние границы бакетов, при пустом значении используются DefaultBuckets
+func NewHistogram(name string, buckets []float64) *Metric {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+	return &Metric{
+		Type: MetricTypeHistogram,
+		Name: name,
+		Histogram: &Histogram{
+			Buckets: b,
+			Counts:  make([]int64, len(b)+1),
+		},
+	}
+}
+
+// Observe
+// Добавляет наблюдение в гистограмму
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.Buckets, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+// Validate
+// Проверяет корректность гистограммы
+func (h *Histogram) Validate() error {
+	if len(h.Counts) != len(h.Buckets)+1 {
+		return fmt.Errorf("%w: expected %d counts, got %d", ErrInvalidHistogram, len(h.Buckets)+1, len(h.Counts))
+	}
+	for i := 1; i < len(h.Buckets); i++ {
+		if h.Buckets[i] <= h.Buckets[i-1] {
+			return fmt.Errorf("%w: buckets must be strictly increasing", ErrInvalidHistogram)
+		}
+	}
+	var total int64
+	for _, c := range h.Counts {
+		if c < 0 {
+			return fmt.Errorf("%w: negative bucket count", ErrInvalidHistogram)
+		}
+		total += c
+	}
+	if total != h.Count {
+		return fmt.Errorf("%w: count %d does not match bucket counts %d", ErrInvalidHistogram, h.Count, total)
+	}
+	return nil
+}
+
+// Merge
+// Добавляет наблюдения гистограммы o
+// Границы бакетов должны совпадать, иначе возвращается ErrHistogramBucketsMismatch
+func (h *Histogram) Merge(o *Histogram) error {
+	if len(h.Buckets) != len(o.Buckets) || len(h.Counts) != len(o.Counts) {
+		return ErrHistogramBucketsMismatch
+	}
+	for i := range h.Buckets {
+		if h.Buckets[i] != o.Buckets[i] {
+			return ErrHistogramBucketsMismatch
+		}
+	}
+	for i := range h.Counts {
+		h.Counts[i] += o.Counts[i]
+	}
+	h.Sum += o.Sum
+	h.Count += o.Count
+	return nil
+}
+
+// Clone
+// Возвращает копию гистограммы
+func (h *Histogram) Clone() *Histogram {
+	c := &Histogram{
+		Buckets: make([]float64, len(h.Buckets)),
+		Counts:  make([]int64, len(h.Counts)),
+		Sum:     h.Sum,
+		Count:   h.Count,
+	}
+	copy(c.Buckets, h.Buckets)
+	copy(c.Counts, h.Counts)
+	return c
+}
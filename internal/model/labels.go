@@ -0,0 +1,81 @@
+package model
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Labels
+// Набор меток метрики (ключ - значение)
+// Метки входят в идентификатор метрики наравне с именем
+type Labels map[string]string
+
+// Keys
+// Возвращает отсортированный список ключей меток
+func (l Labels) Keys() []string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// String
+// Возвращает каноническое строковое представление меток в виде {k1="v1",k2="v2"}
+// Для пустого набора возвращает пустую строку
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	b := strings.Builder{}
+	b.WriteByte('{')
+	for i, k := range l.Keys() {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(l[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Equal
+// Сравнивает наборы меток, nil и пустой набор считаются равными
+func (l Labels) Equal(o Labels) bool {
+	if len(l) != len(o) {
+		return false
+	}
+	for k, v := range l {
+		if ov, ok := o[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Merge
+// Возвращает новый набор меток, дополненный метками o
+// При совпадении ключей приоритет у текущего набора
+func (l Labels) Merge(o Labels) Labels {
+	if len(l) == 0 && len(o) == 0 {
+		return nil
+	}
+	merged := make(Labels, len(l)+len(o))
+	for k, v := range o {
+		merged[k] = v
+	}
+	for k, v := range l {
+		merged[k] = v
+	}
+	return merged
+}
+
+// SeriesKey
+// Возвращает идентификатор серии метрики по имени и меткам
+func SeriesKey(name string, labels Labels) string {
+	return name + labels.String()
+}
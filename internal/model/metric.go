@@ -11,11 +11,19 @@ import (
 // name: имя метрики
 // gauge: значение gauge
 // counter: значение counter
+// histogram: значение histogram
+// summary: значение summary
+// observations: наблюдения summary, которые агент отправляет на сервер
+// labels: метки метрики
 type Metric struct {
-	Type    MetricType
-	Name    string
-	Gauge   float64
-	Counter int64
+	Type         MetricType
+	Name         string
+	Gauge        float64
+	Counter      int64
+	Histogram    *Histogram
+	Summary      *Summary
+	Observations []float64
+	Labels       Labels
 }
 
 func NewGauge(name string, value float64) *Metric {
@@ -34,6 +42,12 @@ func NewCounter(name string, value int64) *Metric {
 	}
 }
 
+// Key
+// Возвращает идентификатор серии метрики (имя и метки)
+func (m *Metric) Key() string {
+	return SeriesKey(m.Name, m.Labels)
+}
+
 // IncCounter
 // Увеличивает значение counter
 func (m *Metric) IncCounter() {
@@ -52,9 +66,11 @@ func (m *Metric) AsString() string {
 	switch m.Type {
 	case MetricTypeGauge:
 		v := strconv.FormatFloat(m.Gauge, 'f', -1, 64)
-		return fmt.Sprintf("type: %s, name: %s, value: %s", MetricTypeGauge.String(), m.Name, v)
+		return fmt.Sprintf("type: %s, name: %s, value: %s%s", MetricTypeGauge.String(), m.Name, v, m.labelsAsString())
 	case MetricTypeCounter:
-		return fmt.Sprintf("type: %s, name: %s, value: %d", MetricTypeCounter.String(), m.Name, m.Counter)
+		return fmt.Sprintf("type: %s, name: %s, value: %d%s", MetricTypeCounter.String(), m.Name, m.Counter, m.labelsAsString())
+	case MetricTypeHistogram, MetricTypeSummary:
+		return fmt.Sprintf("type: %s, name: %s, value: %s%s", m.Type.String(), m.Name, m.ValueAsString(), m.labelsAsString())
 	}
 	return ""
 }
@@ -68,6 +84,25 @@ func (m *Metric) ValueAsString() string {
 		return v
 	case MetricTypeCounter:
 		return fmt.Sprintf("%d", m.Counter)
+	case MetricTypeHistogram:
+		if m.Histogram == nil {
+			return ""
+		}
+		sum := strconv.FormatFloat(m.Histogram.Sum, 'f', -1, 64)
+		return fmt.Sprintf("count=%d sum=%s", m.Histogram.Count, sum)
+	case MetricTypeSummary:
+		if m.Summary == nil {
+			return ""
+		}
+		sum := strconv.FormatFloat(m.Summary.Sum, 'f', -1, 64)
+		return fmt.Sprintf("count=%d sum=%s", m.Summary.Count, sum)
 	}
 	return ""
 }
+
+func (m *Metric) labelsAsString() string {
+	if len(m.Labels) == 0 {
+		return ""
+	}
+	return ", labels: " + m.Labels.String()
+}
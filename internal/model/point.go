@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// Point
+// Точка временного ряда метрики
+// timestamp: время приема значения
+// value: значение метрики (для counter - накопленное значение)
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
@@ -0,0 +1,225 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// DefaultSummaryAccuracy
+// Относительная точность оценки квантилей по умолчанию
+const DefaultSummaryAccuracy = 0.01
+
+// minSummaryValue
+// Значения по модулю меньше minSummaryValue учитываются как ноль
+const minSummaryValue = 1e-9
+
+// ErrSummaryAccuracyMismatch
+// Ошибка при объединении summary с разной точностью
+var ErrSummaryAccuracyMismatch = errors.New("summary accuracy mismatch")
+
+// ErrInvalidSummary
+// Ошибка при некорректных данных summary
+var ErrInvalidSummary = errors.New("invalid summary")
+
+// Summary
+// Значение метрики summary
+// Хранит наблюдения в скетче DDSketch: наблюдения раскладываются по логарифмическим бакетам,
+// что дает оценку любого квантиля с относительной ошибкой не больше accuracy
+// Скетчи с одинаковой точностью объединяются без потери точности
+// accuracy: относительная точность оценки квантилей
+// positive, negative: количество наблюдений в бакетах положительных и отрицательных значений
+// zero: количество наблюдений, близких к нулю
+// count: количество наблюдений
+// sum, min, max: сумма, минимум и максимум наблюдений
+type Summary struct {
+	Accuracy float64       `json:"accuracy"`
+	Positive map[int]int64 `json:"positive,omitempty"`
+	Negative map[int]int64 `json:"negative,omitempty"`
+	Zero     int64         `json:"zero"`
+	Count    int64         `json:"count"`
+	Sum      float64       `json:"sum"`
+	Min      float64       `json:"min"`
+	Max      float64       `json:"max"`
+}
+
+// NewSummary
+// Создает метрику summary с пустым скетчем точности DefaultSummaryAccuracy
+func NewSummary(name string) *Metric {
+	return &Metric{
+		Type:    MetricTypeSummary,
+		Name:    name,
+		Summary: &Summary{Accuracy: DefaultSummaryAccuracy},
+	}
+}
+
+// Observe
+// Добавляет наблюдение в summary и сохраняет его в Observations для отправки на сервер
+func (m *Metric) Observe(v float64) {
+	m.Summary.Observe(v)
+	m.Observations = append(m.Observations, v)
+}
+
+func (s *Summary) gamma() float64 {
+	return (1 + s.Accuracy) / (1 - s.Accuracy)
+}
+
+func (s *Summary) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+func (s *Summary) value(i int) float64 {
+	g := s.gamma()
+	return 2 * math.Pow(g, float64(i)) / (g + 1)
+}
+
+// Observe
+// Добавляет наблюдение в скетч
+func (s *Summary) Observe(v float64) {
+	switch {
+	case v > minSummaryValue:
+		if s.Positive == nil {
+			s.Positive = make(map[int]int64)
+		}
+		s.Positive[s.index(v)]++
+	case v < -minSummaryValue:
+		if s.Negative == nil {
+			s.Negative = make(map[int]int64)
+		}
+		s.Negative[s.index(-v)]++
+	default:
+		s.Zero++
+	}
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+}
+
+// Validate
+// Проверяет корректность скетча
+func (s *Summary) Validate() error {
+	if s.Accuracy <= 0 || s.Accuracy >= 1 {
+		return ErrInvalidSummary
+	}
+	total := s.Zero
+	for _, c := range s.Positive {
+		total += c
+	}
+	for _, c := range s.Negative {
+		total += c
+	}
+	if total != s.Count || s.Zero < 0 {
+		return ErrInvalidSummary
+	}
+	return nil
+}
+
+// Merge
+// Добавляет наблюдения скетча o
+// Точность скетчей должна совпадать, иначе возвращается ErrSummaryAccuracyMismatch
+func (s *Summary) Merge(o *Summary) error {
+	if s.Accuracy != o.Accuracy {
+		return ErrSummaryAccuracyMismatch
+	}
+	if o.Count == 0 {
+		return nil
+	}
+	if s.Count == 0 || o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if s.Count == 0 || o.Max > s.Max {
+		s.Max = o.Max
+	}
+	if len(o.Positive) > 0 && s.Positive == nil {
+		s.Positive = make(map[int]int64, len(o.Positive))
+	}
+	for i, c := range o.Positive {
+		s.Positive[i] += c
+	}
+	if len(o.Negative) > 0 && s.Negative == nil {
+		s.Negative = make(map[int]int64, len(o.Negative))
+	}
+	for i, c := range o.Negative {
+		s.Negative[i] += c
+	}
+	s.Zero += o.Zero
+	s.Count += o.Count
+	s.Sum += o.Sum
+	return nil
+}
+
+// Quantile
+// Возвращает оценку квантиля q (0 <= q <= 1)
+// Для пустого скетча возвращает 0
+func (s *Summary) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return s.Min
+	}
+	if q >= 1 {
+		return s.Max
+	}
+
+	rank := q * float64(s.Count-1)
+	var seen int64
+
+	negative := sortedIndexes(s.Negative)
+	for i := len(negative) - 1; i >= 0; i-- {
+		seen += s.Negative[negative[i]]
+		if float64(seen) > rank {
+			return s.clamp(-s.value(negative[i]))
+		}
+	}
+	seen += s.Zero
+	if float64(seen) > rank {
+		return 0
+	}
+	for _, i := range sortedIndexes(s.Positive) {
+		seen += s.Positive[i]
+		if float64(seen) > rank {
+			return s.clamp(s.value(i))
+		}
+	}
+	return s.Max
+}
+
+func (s *Summary) clamp(v float64) float64 {
+	return math.Min(math.Max(v, s.Min), s.Max)
+}
+
+// Clone
+// Возвращает копию скетча
+func (s *Summary) Clone() *Summary {
+	c := *s
+	c.Positive = nil
+	c.Negative = nil
+	if s.Positive != nil {
+		c.Positive = make(map[int]int64, len(s.Positive))
+		for i, v := range s.Positive {
+			c.Positive[i] = v
+		}
+	}
+	if s.Negative != nil {
+		c.Negative = make(map[int]int64, len(s.Negative))
+		for i, v := range s.Negative {
+			c.Negative[i] = v
+		}
+	}
+	return &c
+}
+
+func sortedIndexes(bins map[int]int64) []int {
+	indexes := make([]int, 0, len(bins))
+	for i := range bins {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
@@ -0,0 +1,75 @@
+package model
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary_Quantile(t *testing.T) {
+	m := NewSummary("latency")
+	for i := 1; i <= 1000; i++ {
+		m.Summary.Observe(float64(i))
+	}
+
+	tests := []struct {
+		name string
+		q    float64
+		want float64
+	}{
+		{"min", 0, 1},
+		{"p50", 0.5, 500},
+		{"p90", 0.9, 900},
+		{"p99", 0.99, 990},
+		{"max", 1, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := m.Summary.Quantile(tt.q)
+			assert.InDelta(t, tt.want, got, tt.want*DefaultSummaryAccuracy+1)
+		})
+	}
+	assert.Equal(t, int64(1000), m.Summary.Count)
+	assert.Equal(t, float64(500500), m.Summary.Sum)
+}
+
+func TestSummary_NegativeAndZero(t *testing.T) {
+	s := NewSummary("temperature").Summary
+	for _, v := range []float64{-10, -5, 0, 5, 10} {
+		s.Observe(v)
+	}
+
+	assert.InDelta(t, -10, s.Quantile(0.1), 0.2)
+	assert.Equal(t, float64(0), s.Quantile(0.5))
+	assert.InDelta(t, 5, s.Quantile(0.8), 0.1)
+	assert.Equal(t, float64(10), s.Quantile(1))
+	assert.NoError(t, s.Validate())
+}
+
+func TestSummary_Merge(t *testing.T) {
+	a := NewSummary("latency").Summary
+	b := NewSummary("latency").Summary
+	all := NewSummary("latency").Summary
+	for i := 1; i <= 100; i++ {
+		a.Observe(float64(i))
+		b.Observe(float64(i * 10))
+		all.Observe(float64(i))
+		all.Observe(float64(i * 10))
+	}
+
+	require.NoError(t, a.Merge(b))
+	assert.Equal(t, all, a)
+	assert.NoError(t, a.Validate())
+
+	other := &Summary{Accuracy: 0.05}
+	assert.ErrorIs(t, a.Merge(other), ErrSummaryAccuracyMismatch)
+}
+
+func TestSummary_Empty(t *testing.T) {
+	s := NewSummary("empty").Summary
+	assert.Equal(t, float64(0), s.Quantile(0.5))
+	assert.False(t, math.IsNaN(s.Quantile(0.99)))
+	assert.NoError(t, s.Validate())
+}
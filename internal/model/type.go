@@ -2,8 +2,10 @@ package model
 
 //go:generate go-enum --marshal
 
-// MetricType ENUM(gauge, counter)
+// MetricType ENUM(gauge, counter, histogram, summary)
 // тип метрики
 // gauge: тип метрики gauge
 // counter: тип метрики counter
+// histogram: тип метрики histogram
+// summary: тип метрики summary
 type MetricType int
@@ -16,15 +16,21 @@ const (
 	MetricTypeGauge MetricType = iota
 	// MetricTypeCounter is a MetricType of type Counter.
 	MetricTypeCounter
+	// MetricTypeHistogram is a MetricType of type Histogram.
+	MetricTypeHistogram
+	// MetricTypeSummary is a MetricType of type Summary.
+	MetricTypeSummary
 )
 
 var ErrInvalidMetricType = errors.New("not a valid MetricType")
 
-const _MetricTypeName = "gaugecounter"
+const _MetricTypeName = "gaugecounterhistogramsummary"
 
 var _MetricTypeMap = map[MetricType]string{
-	MetricTypeGauge:   _MetricTypeName[0:5],
-	MetricTypeCounter: _MetricTypeName[5:12],
+	MetricTypeGauge:     _MetricTypeName[0:5],
+	MetricTypeCounter:   _MetricTypeName[5:12],
+	MetricTypeHistogram: _MetricTypeName[12:21],
+	MetricTypeSummary:   _MetricTypeName[21:28],
 }
 
 // String implements the Stringer interface.
@@ -43,8 +49,10 @@ func (x MetricType) IsValid() bool {
 }
 
 var _MetricTypeValue = map[string]MetricType{
-	_MetricTypeName[0:5]:  MetricTypeGauge,
-	_MetricTypeName[5:12]: MetricTypeCounter,
+	_MetricTypeName[0:5]:   MetricTypeGauge,
+	_MetricTypeName[5:12]:  MetricTypeCounter,
+	_MetricTypeName[12:21]: MetricTypeHistogram,
+	_MetricTypeName[21:28]: MetricTypeSummary,
 }
 
 // ParseMetricType attempts to convert a string to a MetricType.
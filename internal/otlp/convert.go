@@ -0,0 +1,386 @@
+package otlp
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// DefaultPrefixAttribute
+// Атрибут ресурса, значение которого по умолчанию становится префиксом имени метрики
+const DefaultPrefixAttribute = "service.name"
+
+// stateTTL
+// Время хранения накопленного значения серии, от которой не приходят данные
+const stateTTL = time.Hour
+
+// noRecordedValue
+// Флаг значения без данных
+const noRecordedValue = uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)
+
+// Result
+// Результат преобразования запроса
+// Rejected - количество отклоненных значений, Reason - причина отклонения первого из них
+type Result struct {
+	Metrics  []model.Metric
+	Rejected int64
+	Reason   string
+	// pending накопленные значения серий, запоминаются в Converter вызовом Commit
+	pending map[string]*cumulative
+}
+
+func (r *Result) reject(format string, args ...any) {
+	if r.Rejected == 0 {
+		r.Reason = fmt.Sprintf(format, args...)
+	}
+	r.Rejected++
+}
+
+// remember
+// Добавляет накопленное значение серии в результат
+func (r *Result) remember(key string, value *cumulative) {
+	if r.pending == nil {
+		r.pending = make(map[string]*cumulative)
+	}
+	r.pending[key] = value
+}
+
+// cumulative
+// Последнее накопленное значение серии, seen - время последнего значения
+type cumulative struct {
+	start     uint64
+	value     float64
+	histogram *model.Histogram
+	seen      time.Time
+}
+
+// Converter
+// Преобразует метрики OTLP в model.Metric
+// Монотонный Sum сохраняется как counter с приращением, немонотонный Sum и Gauge - как gauge,
+// Histogram с явными границами - как histogram
+// Накопленные (cumulative) значения Sum и Histogram преобразуются в приращения относительно
+// предыдущего значения серии, значение после сброса сохраняется целиком
+// Первое значение серии становится точкой отсчета с нулевым приращением, иначе после каждого перезапуска сервера
+// накопленное за все время значение сохранялось бы повторно; целиком оно сохраняется, только если
+// время начала серии (StartTimeUnixNano) позже создания Converter
+// Накопленные значения запоминаются только вызовом Commit после сохранения метрик и забываются,
+// если от серии нет данных дольше часа
+// ExponentialHistogram и Summary не поддерживаются и отклоняются
+type Converter struct {
+	prefixAttribute string
+	mu              sync.Mutex
+	last            map[string]*cumulative
+	lastSweep       time.Time
+	started         time.Time
+	now             func() time.Time
+}
+
+// NewConverter
+// Создает Converter
+// prefixAttribute - атрибут ресурса, значение которого становится префиксом имени метрики: "<значение>.<имя>",
+// пустое значение отключает префикс
+func NewConverter(prefixAttribute string) *Converter {
+	return &Converter{
+		prefixAttribute: prefixAttribute,
+		last:            make(map[string]*cumulative),
+		started:         time.Now(),
+		now:             time.Now,
+	}
+}
+
+// Convert
+// Преобразует запрос в метрики
+// Атрибуты значений становятся метками, значения без данных (флаг NO_RECORDED_VALUE), NaN и бесконечные значения пропускаются
+// Накопленные значения серий не запоминаются до вызова Commit с результатом
+func (c *Converter) Convert(req *collectormetrics.ExportMetricsServiceRequest) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var res Result
+	for _, rm := range req.GetResourceMetrics() {
+		resource := attributes(rm.GetResource().GetAttributes())
+		prefix := ""
+		if c.prefixAttribute != "" {
+			prefix = resource[c.prefixAttribute]
+		}
+		// resourceKey отделяет накопленные значения одноименных серий разных ресурсов
+		resourceKey := resource.String()
+
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				name := m.GetName()
+				if name == "" {
+					res.reject("metric without name")
+					continue
+				}
+				if prefix != "" {
+					name = prefix + "." + name
+				}
+
+				switch data := m.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					for _, dp := range data.Gauge.GetDataPoints() {
+						c.gauge(&res, name, dp)
+					}
+				case *metricspb.Metric_Sum:
+					sum := data.Sum
+					for _, dp := range sum.GetDataPoints() {
+						if !sum.GetIsMonotonic() {
+							c.gauge(&res, name, dp)
+							continue
+						}
+						c.counter(&res, resourceKey, name, sum.GetAggregationTemporality(), dp)
+					}
+				case *metricspb.Metric_Histogram:
+					h := data.Histogram
+					for _, dp := range h.GetDataPoints() {
+						c.histogram(&res, resourceKey, name, h.GetAggregationTemporality(), dp)
+					}
+				case *metricspb.Metric_ExponentialHistogram:
+					for range data.ExponentialHistogram.GetDataPoints() {
+						res.reject("metric %q: exponential histogram is not supported", name)
+					}
+				case *metricspb.Metric_Summary:
+					for range data.Summary.GetDataPoints() {
+						res.reject("metric %q: summary is not supported", name)
+					}
+				}
+			}
+		}
+	}
+	return res
+}
+
+// Commit
+// Запоминает накопленные значения серий из результата Convert
+// Вызывается после успешного сохранения метрик: если сохранить не удалось, повторно отправленные накопленные
+// значения снова преобразуются в приращения относительно прежних, и приращение не теряется
+// Заодно удаляются накопленные значения серий, от которых нет данных дольше stateTTL
+func (c *Converter) Commit(res Result) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for key, value := range res.pending {
+		value.seen = now
+		c.last[key] = value
+	}
+
+	if now.Sub(c.lastSweep) > time.Minute {
+		for key, value := range c.last {
+			if now.Sub(value.seen) > stateTTL {
+				delete(c.last, key)
+			}
+		}
+		c.lastSweep = now
+	}
+}
+
+// previous
+// Возвращает последнее накопленное значение серии с учетом еще не запомненных значений результата
+func (c *Converter) previous(res *Result, key string) (*cumulative, bool) {
+	if value, ok := res.pending[key]; ok {
+		return value, true
+	}
+	value, ok := c.last[key]
+	return value, ok
+}
+
+// startedAfter
+// Возвращает true, если серия со временем начала start началась после создания Converter
+// и ее накопленное значение еще не было сохранено
+func (c *Converter) startedAfter(start uint64) bool {
+	return start != 0 && start > uint64(c.started.UnixNano())
+}
+
+func (c *Converter) gauge(res *Result, name string, dp *metricspb.NumberDataPoint) {
+	value, ok := numberValue(dp)
+	if !ok {
+		return
+	}
+	m := model.NewGauge(name, value)
+	m.Labels = attributes(dp.GetAttributes())
+	res.Metrics = append(res.Metrics, *m)
+}
+
+func (c *Converter) counter(res *Result, resourceKey string, name string, temporality metricspb.AggregationTemporality, dp *metricspb.NumberDataPoint) {
+	value, ok := numberValue(dp)
+	if !ok {
+		return
+	}
+	labels := attributes(dp.GetAttributes())
+
+	var delta int64
+	switch temporality {
+	case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+		delta = int64(math.Round(value))
+	case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+		key := resourceKey + model.SeriesKey(name, labels)
+		start := dp.GetStartTimeUnixNano()
+		prev, ok := c.previous(res, key)
+		res.remember(key, &cumulative{start: start, value: value})
+		switch {
+		case ok && prev.start == start && value >= prev.value:
+			// разность округленных значений, чтобы ошибки округления не накапливались
+			delta = int64(math.Round(value)) - int64(math.Round(prev.value))
+		case ok || c.startedAfter(start):
+			delta = int64(math.Round(value))
+		}
+	default:
+		res.reject("metric %q: unspecified aggregation temporality", name)
+		return
+	}
+
+	m := model.NewCounter(name, delta)
+	m.Labels = labels
+	res.Metrics = append(res.Metrics, *m)
+}
+
+func (c *Converter) histogram(res *Result, resourceKey string, name string, temporality metricspb.AggregationTemporality, dp *metricspb.HistogramDataPoint) {
+	if dp.GetFlags()&noRecordedValue != 0 {
+		return
+	}
+	h, err := histogramValue(dp)
+	if err != nil {
+		res.reject("metric %q: %s", name, err)
+		return
+	}
+	labels := attributes(dp.GetAttributes())
+
+	switch temporality {
+	case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA:
+	case metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE:
+		key := resourceKey + model.SeriesKey(name, labels)
+		start := dp.GetStartTimeUnixNano()
+		prev, ok := c.previous(res, key)
+		res.remember(key, &cumulative{start: start, histogram: h.Clone()})
+		switch {
+		case ok && prev.start == start && prev.histogram != nil:
+			if delta, ok := histogramDelta(h, prev.histogram); ok {
+				h = delta
+			}
+		case !ok && !c.startedAfter(start):
+			// точка отсчета: гистограмма с теми же бакетами без наблюдений
+			h, _ = histogramDelta(h, h)
+		}
+	default:
+		res.reject("metric %q: unspecified aggregation temporality", name)
+		return
+	}
+
+	res.Metrics = append(res.Metrics, model.Metric{Type: model.MetricTypeHistogram, Name: name, Labels: labels, Histogram: h})
+}
+
+// numberValue
+// Возвращает значение NumberDataPoint, false - если значения нет или оно не конечное
+func numberValue(dp *metricspb.NumberDataPoint) (float64, bool) {
+	if dp.GetFlags()&noRecordedValue != 0 {
+		return 0, false
+	}
+	var value float64
+	switch v := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsDouble:
+		value = v.AsDouble
+	case *metricspb.NumberDataPoint_AsInt:
+		value = float64(v.AsInt)
+	default:
+		return 0, false
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+	return value, true
+}
+
+// histogramValue
+// Преобразует HistogramDataPoint в model.Histogram
+// Значение без бакетов сохраняется как гистограмма с одним бакетом +Inf
+func histogramValue(dp *metricspb.HistogramDataPoint) (*model.Histogram, error) {
+	bounds := dp.GetExplicitBounds()
+	counts := dp.GetBucketCounts()
+	if len(counts) == 0 && len(bounds) == 0 {
+		counts = []uint64{dp.GetCount()}
+	}
+	if len(counts) != len(bounds)+1 {
+		return nil, fmt.Errorf("expected %d bucket counts, got %d", len(bounds)+1, len(counts))
+	}
+
+	h := &model.Histogram{
+		Buckets: make([]float64, len(bounds)),
+		Counts:  make([]int64, len(counts)),
+		Sum:     dp.GetSum(),
+		Count:   int64(dp.GetCount()),
+	}
+	copy(h.Buckets, bounds)
+	for i, n := range counts {
+		if n > math.MaxInt64 {
+			return nil, fmt.Errorf("bucket count %d overflows int64", n)
+		}
+		h.Counts[i] = int64(n)
+	}
+	if err := h.Validate(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// histogramDelta
+// Возвращает разность накопленных гистограмм, false - если границы бакетов изменились или значения уменьшились (сброс)
+func histogramDelta(cur *model.Histogram, prev *model.Histogram) (*model.Histogram, bool) {
+	if len(cur.Buckets) != len(prev.Buckets) || cur.Count < prev.Count {
+		return nil, false
+	}
+	for i := range cur.Buckets {
+		if cur.Buckets[i] != prev.Buckets[i] {
+			return nil, false
+		}
+	}
+
+	delta := cur.Clone()
+	delta.Count -= prev.Count
+	delta.Sum -= prev.Sum
+	for i := range delta.Counts {
+		delta.Counts[i] -= prev.Counts[i]
+		if delta.Counts[i] < 0 {
+			return nil, false
+		}
+	}
+	return delta, true
+}
+
+// attributes
+// Преобразует атрибуты в метки, составные значения (массивы, списки) и байты пропускаются
+func attributes(kvs []*commonpb.KeyValue) model.Labels {
+	var labels model.Labels
+	for _, kv := range kvs {
+		var value string
+		switch v := kv.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			value = v.StringValue
+		case *commonpb.AnyValue_BoolValue:
+			value = strconv.FormatBool(v.BoolValue)
+		case *commonpb.AnyValue_IntValue:
+			value = strconv.FormatInt(v.IntValue, 10)
+		case *commonpb.AnyValue_DoubleValue:
+			value = strconv.FormatFloat(v.DoubleValue, 'f', -1, 64)
+		default:
+			continue
+		}
+		if kv.GetKey() == "" {
+			continue
+		}
+		if labels == nil {
+			labels = make(model.Labels, len(kvs))
+		}
+		labels[kv.GetKey()] = value
+	}
+	return labels
+}
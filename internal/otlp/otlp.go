@@ -0,0 +1,87 @@
+// Package otlp
+// Прием метрик OpenTelemetry по OTLP/HTTP: ExportMetricsServiceRequest в protobuf или JSON
+package otlp
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// ContentTypeProtobuf
+	// Тип содержимого запроса в protobuf
+	ContentTypeProtobuf = "application/x-protobuf"
+	// ContentTypeJSON
+	// Тип содержимого запроса в JSON
+	ContentTypeJSON = "application/json"
+)
+
+var (
+	// ErrUnsupportedContentType
+	// Ошибка: тип содержимого не application/x-protobuf и не application/json
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+	// ErrInvalidRequest
+	// Ошибка разбора запроса
+	ErrInvalidRequest = errors.New("invalid export request")
+)
+
+// MediaType
+// Возвращает тип содержимого без параметров, ErrUnsupportedContentType - если тип не поддерживается
+func MediaType(contentType string) (string, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedContentType, contentType)
+	}
+	switch mediaType {
+	case ContentTypeProtobuf, ContentTypeJSON:
+		return mediaType, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnsupportedContentType, contentType)
+}
+
+// Decode
+// Разбирает ExportMetricsServiceRequest в формате contentType, неизвестные поля JSON пропускаются
+func Decode(data []byte, contentType string) (*collectormetrics.ExportMetricsServiceRequest, error) {
+	mediaType, err := MediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &collectormetrics.ExportMetricsServiceRequest{}
+	if mediaType == ContentTypeJSON {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, req)
+	} else {
+		err = proto.Unmarshal(data, req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+	return req, nil
+}
+
+// EncodeResponse
+// Кодирует ExportMetricsServiceResponse в формате contentType
+// rejected - количество отклоненных значений, reason - причина, при rejected равном 0 ответ пустой
+func EncodeResponse(rejected int64, reason string, contentType string) ([]byte, error) {
+	mediaType, err := MediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &collectormetrics.ExportMetricsServiceResponse{}
+	if rejected > 0 {
+		resp.PartialSuccess = &collectormetrics.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rejected,
+			ErrorMessage:       reason,
+		}
+	}
+	if mediaType == ContentTypeJSON {
+		return protojson.Marshal(resp)
+	}
+	return proto.Marshal(resp)
+}
@@ -0,0 +1,317 @@
+package otlp
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectormetrics "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// cannedRequest
+// ExportMetricsServiceRequest в JSON: ресурс checkout с монотонным delta Sum, Gauge и delta Histogram
+const cannedRequest = `{
+  "resourceMetrics": [{
+    "resource": {"attributes": [
+      {"key": "service.name", "value": {"stringValue": "checkout"}},
+      {"key": "host.name", "value": {"stringValue": "web1"}}
+    ]},
+    "scopeMetrics": [{
+      "scope": {"name": "app"},
+      "metrics": [
+        {"name": "requests", "sum": {
+          "aggregationTemporality": 1, "isMonotonic": true,
+          "dataPoints": [{"asInt": "5", "attributes": [{"key": "code", "value": {"intValue": "200"}}]}]
+        }},
+        {"name": "temperature", "gauge": {"dataPoints": [{"asDouble": 21.5}]}},
+        {"name": "latency", "histogram": {
+          "aggregationTemporality": "AGGREGATION_TEMPORALITY_DELTA",
+          "dataPoints": [{"count": "3", "sum": 0.7, "bucketCounts": ["1", "2", "0"], "explicitBounds": [0.1, 0.5]}]
+        }}
+      ]
+    }]
+  }]
+}`
+
+func decodeJSON(t *testing.T, data string) *collectormetrics.ExportMetricsServiceRequest {
+	req, err := Decode([]byte(data), ContentTypeJSON)
+	require.NoError(t, err)
+	return req
+}
+
+func TestDecode(t *testing.T) {
+	req := decodeJSON(t, cannedRequest)
+	data, err := proto.Marshal(req)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		wantErr     error
+	}{
+		{name: "json", data: []byte(cannedRequest), contentType: "application/json; charset=utf-8"},
+		{name: "protobuf", data: data, contentType: ContentTypeProtobuf},
+		{name: "unsupported content type", data: data, contentType: "text/plain", wantErr: ErrUnsupportedContentType},
+		{name: "empty content type", data: data, contentType: "", wantErr: ErrUnsupportedContentType},
+		{name: "broken json", data: []byte(`{"resourceMetrics": [`), contentType: ContentTypeJSON, wantErr: ErrInvalidRequest},
+		{name: "broken protobuf", data: []byte{0x0a, 0x05, 0x01}, contentType: ContentTypeProtobuf, wantErr: ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.data, tt.contentType)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, proto.Equal(req, got))
+		})
+	}
+}
+
+func TestConverter_Convert(t *testing.T) {
+	tests := []struct {
+		name            string
+		prefixAttribute string
+		request         string
+		want            []model.Metric
+		wantRejected    int64
+	}{
+		{
+			name:            "canned request",
+			prefixAttribute: DefaultPrefixAttribute,
+			request:         cannedRequest,
+			want: []model.Metric{
+				{Type: model.MetricTypeCounter, Name: "checkout.requests", Counter: 5, Labels: model.Labels{"code": "200"}},
+				{Type: model.MetricTypeGauge, Name: "checkout.temperature", Gauge: 21.5},
+				{Type: model.MetricTypeHistogram, Name: "checkout.latency", Histogram: &model.Histogram{
+					Buckets: []float64{0.1, 0.5}, Counts: []int64{1, 2, 0}, Sum: 0.7, Count: 3,
+				}},
+			},
+		},
+		{
+			name:            "prefix from another attribute",
+			prefixAttribute: "host.name",
+			request:         cannedRequest,
+			want: []model.Metric{
+				{Type: model.MetricTypeCounter, Name: "web1.requests", Counter: 5, Labels: model.Labels{"code": "200"}},
+				{Type: model.MetricTypeGauge, Name: "web1.temperature", Gauge: 21.5},
+				{Type: model.MetricTypeHistogram, Name: "web1.latency", Histogram: &model.Histogram{
+					Buckets: []float64{0.1, 0.5}, Counts: []int64{1, 2, 0}, Sum: 0.7, Count: 3,
+				}},
+			},
+		},
+		{
+			name:    "prefix disabled",
+			request: cannedRequest,
+			want: []model.Metric{
+				{Type: model.MetricTypeCounter, Name: "requests", Counter: 5, Labels: model.Labels{"code": "200"}},
+				{Type: model.MetricTypeGauge, Name: "temperature", Gauge: 21.5},
+				{Type: model.MetricTypeHistogram, Name: "latency", Histogram: &model.Histogram{
+					Buckets: []float64{0.1, 0.5}, Counts: []int64{1, 2, 0}, Sum: 0.7, Count: 3,
+				}},
+			},
+		},
+		{
+			name:            "resource without prefix attribute",
+			prefixAttribute: DefaultPrefixAttribute,
+			request: `{"resourceMetrics": [{"scopeMetrics": [{"metrics": [
+				{"name": "queue", "sum": {"aggregationTemporality": 2, "dataPoints": [{"asDouble": -2}]}}
+			]}]}]}`,
+			want: []model.Metric{
+				{Type: model.MetricTypeGauge, Name: "queue", Gauge: -2},
+			},
+		},
+		{
+			name: "attributes and skipped values",
+			request: `{"resourceMetrics": [{"scopeMetrics": [{"metrics": [
+				{"name": "g", "gauge": {"dataPoints": [
+					{"asDouble": 1, "attributes": [
+						{"key": "ok", "value": {"boolValue": true}},
+						{"key": "ratio", "value": {"doubleValue": 0.25}},
+						{"key": "list", "value": {"arrayValue": {"values": [{"stringValue": "a"}]}}}
+					]},
+					{"asDouble": "NaN"},
+					{"asDouble": 2, "flags": 1},
+					{}
+				]}}
+			]}]}]}`,
+			want: []model.Metric{
+				{Type: model.MetricTypeGauge, Name: "g", Gauge: 1, Labels: model.Labels{"ok": "true", "ratio": "0.25"}},
+			},
+		},
+		{
+			name: "unsupported data points rejected",
+			request: `{"resourceMetrics": [{"scopeMetrics": [{"metrics": [
+				{"name": "s", "summary": {"dataPoints": [{"count": "1", "sum": 1}, {"count": "2", "sum": 2}]}},
+				{"name": "e", "exponentialHistogram": {"aggregationTemporality": 1, "dataPoints": [{"count": "1"}]}},
+				{"name": "c", "sum": {"isMonotonic": true, "dataPoints": [{"asInt": "1"}]}},
+				{"name": "h", "histogram": {"aggregationTemporality": 1, "dataPoints": [
+					{"count": "3", "bucketCounts": ["1", "1"], "explicitBounds": [1, 2]},
+					{"count": "3", "bucketCounts": ["1", "1", "0"], "explicitBounds": [1, 2]}
+				]}},
+				{"sum": {"aggregationTemporality": 1, "isMonotonic": true, "dataPoints": [{"asInt": "1"}]}},
+				{"name": "ok", "gauge": {"dataPoints": [{"asInt": "7"}]}}
+			]}]}]}`,
+			want: []model.Metric{
+				{Type: model.MetricTypeGauge, Name: "ok", Gauge: 7},
+			},
+			wantRejected: 7,
+		},
+		{
+			name: "histogram without buckets",
+			request: `{"resourceMetrics": [{"scopeMetrics": [{"metrics": [
+				{"name": "h", "histogram": {"aggregationTemporality": 1, "dataPoints": [{"count": "4", "sum": 10}]}}
+			]}]}]}`,
+			want: []model.Metric{
+				{Type: model.MetricTypeHistogram, Name: "h", Histogram: &model.Histogram{
+					Buckets: []float64{}, Counts: []int64{4}, Sum: 10, Count: 4,
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := NewConverter(tt.prefixAttribute).Convert(decodeJSON(t, tt.request))
+			assert.Equal(t, tt.want, res.Metrics)
+			assert.Equal(t, tt.wantRejected, res.Rejected)
+			if tt.wantRejected > 0 {
+				assert.NotEmpty(t, res.Reason)
+			}
+		})
+	}
+}
+
+func TestConverter_Cumulative(t *testing.T) {
+	counter := func(value string, start string) string {
+		return `{"resourceMetrics": [{"resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "api"}}]},
+			"scopeMetrics": [{"metrics": [{"name": "requests", "sum": {"aggregationTemporality": 2, "isMonotonic": true,
+			"dataPoints": [{"asDouble": ` + value + `, "startTimeUnixNano": "` + start + `"}]}}]}]}]}`
+	}
+	histogram := func(counts string, sum string, count string, bounds string) string {
+		return `{"resourceMetrics": [{"scopeMetrics": [{"metrics": [{"name": "latency", "histogram": {
+			"aggregationTemporality": "AGGREGATION_TEMPORALITY_CUMULATIVE", "dataPoints": [{"startTimeUnixNano": "1",
+			"count": "` + count + `", "sum": ` + sum + `, "bucketCounts": ` + counts + `, "explicitBounds": ` + bounds + `}]}}]}]}]}`
+	}
+
+	t.Run("sum", func(t *testing.T) {
+		c := NewConverter(DefaultPrefixAttribute)
+		var got []int64
+		for _, req := range []string{
+			counter("10", "1"),
+			counter("15.4", "1"),
+			counter("15.6", "1"),
+			// сброс: значение уменьшилось
+			counter("3", "1"),
+			// сброс: изменилось время начала
+			counter("8", "2"),
+			counter("9", "2"),
+		} {
+			res := c.Convert(decodeJSON(t, req))
+			c.Commit(res)
+			require.Len(t, res.Metrics, 1)
+			assert.Equal(t, model.MetricTypeCounter, res.Metrics[0].Type)
+			assert.Equal(t, "api.requests", res.Metrics[0].Name)
+			got = append(got, res.Metrics[0].Counter)
+		}
+		assert.Equal(t, []int64{0, 5, 1, 3, 8, 1}, got)
+	})
+
+	t.Run("histogram", func(t *testing.T) {
+		c := NewConverter(DefaultPrefixAttribute)
+		var got []*model.Histogram
+		for _, req := range []string{
+			histogram(`["1", "2", "0"]`, "1", "3", "[1, 2]"),
+			histogram(`["2", "4", "1"]`, "4", "7", "[1, 2]"),
+			// сброс: изменились границы бакетов
+			histogram(`["1", "1"]`, "1", "2", "[5]"),
+		} {
+			res := c.Convert(decodeJSON(t, req))
+			c.Commit(res)
+			require.Len(t, res.Metrics, 1)
+			got = append(got, res.Metrics[0].Histogram)
+		}
+		assert.Equal(t, []*model.Histogram{
+			{Buckets: []float64{1, 2}, Counts: []int64{0, 0, 0}, Sum: 0, Count: 0},
+			{Buckets: []float64{1, 2}, Counts: []int64{1, 2, 1}, Sum: 3, Count: 4},
+			{Buckets: []float64{5}, Counts: []int64{1, 1}, Sum: 1, Count: 2},
+		}, got)
+	})
+
+	t.Run("restart", func(t *testing.T) {
+		// после перезапуска сервера накопленное значение не сохраняется повторно
+		for i := 0; i < 2; i++ {
+			c := NewConverter(DefaultPrefixAttribute)
+			res := c.Convert(decodeJSON(t, counter("10", "1")))
+			c.Commit(res)
+			require.Len(t, res.Metrics, 1)
+			assert.Equal(t, int64(0), res.Metrics[0].Counter)
+		}
+	})
+
+	t.Run("started after converter", func(t *testing.T) {
+		c := NewConverter(DefaultPrefixAttribute)
+		start := strconv.FormatInt(c.started.Add(time.Second).UnixNano(), 10)
+		res := c.Convert(decodeJSON(t, counter("10", start)))
+		require.Len(t, res.Metrics, 1)
+		assert.Equal(t, int64(10), res.Metrics[0].Counter)
+	})
+
+	t.Run("not committed", func(t *testing.T) {
+		c := NewConverter(DefaultPrefixAttribute)
+		c.Commit(c.Convert(decodeJSON(t, counter("10", "1"))))
+
+		// метрики не сохранены, повтор запроса возвращает то же приращение
+		res := c.Convert(decodeJSON(t, counter("15", "1")))
+		require.Len(t, res.Metrics, 1)
+		assert.Equal(t, int64(5), res.Metrics[0].Counter)
+		res = c.Convert(decodeJSON(t, counter("15", "1")))
+		require.Len(t, res.Metrics, 1)
+		assert.Equal(t, int64(5), res.Metrics[0].Counter)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		now := time.Now()
+		c := NewConverter(DefaultPrefixAttribute)
+		c.now = func() time.Time { return now }
+		c.Commit(c.Convert(decodeJSON(t, counter("10", "1"))))
+		require.Len(t, c.last, 1)
+
+		now = now.Add(stateTTL + time.Minute)
+		c.Commit(Result{})
+		assert.Empty(t, c.last)
+	})
+}
+
+func TestEncodeResponse(t *testing.T) {
+	data, err := EncodeResponse(0, "", ContentTypeJSON)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(data))
+
+	data, err = EncodeResponse(0, "", ContentTypeProtobuf)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+
+	data, err = EncodeResponse(2, "summary is not supported", ContentTypeProtobuf)
+	require.NoError(t, err)
+	resp := &collectormetrics.ExportMetricsServiceResponse{}
+	require.NoError(t, proto.Unmarshal(data, resp))
+	assert.Equal(t, int64(2), resp.GetPartialSuccess().GetRejectedDataPoints())
+	assert.Equal(t, "summary is not supported", resp.GetPartialSuccess().GetErrorMessage())
+
+	data, err = EncodeResponse(1, "invalid", ContentTypeJSON)
+	require.NoError(t, err)
+	resp = &collectormetrics.ExportMetricsServiceResponse{}
+	require.NoError(t, protojson.Unmarshal(data, resp))
+	assert.Equal(t, int64(1), resp.GetPartialSuccess().GetRejectedDataPoints())
+
+	_, err = EncodeResponse(0, "", "text/plain")
+	assert.ErrorIs(t, err, ErrUnsupportedContentType)
+}
@@ -0,0 +1,166 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/soltanat/metrics/internal/logger"
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/promtext"
+)
+
+const (
+	// instanceLabel
+	// Метка с адресом приложения, добавляется к собранным метрикам
+	instanceLabel = "instance"
+	// scrapeAccept
+	// Заголовок Accept запроса: текстовый формат Prometheus
+	scrapeAccept = "text/plain;version=0.0.4;q=1,*/*;q=0.1"
+)
+
+// PrometheusScrapePoller
+// Реализует интерфейс Poll для сбора метрик приложений в текстовом формате Prometheus
+// Серии типа counter передаются как counter с приращением относительно предыдущего сбора:
+// первое значение серии служит точкой отсчета и передается как нулевое приращение, так как накоплено до запуска агента,
+// значение после перезапуска приложения (меньше предыдущего) передается целиком
+// Остальные серии, в том числе серии гистограмм и summary, передаются как gauge
+// К меткам серии добавляется метка instance с адресом приложения, если она не задана приложением
+type PrometheusScrapePoller struct {
+	metricsChan chan *model.Metric
+	targets     []string
+	client      *http.Client
+	// last последние значения counter по адресу приложения и идентификатору серии
+	last map[string]map[string]float64
+}
+
+// NewPrometheusScrapePoller
+// Создает PrometheusScrapePoller
+// targets - адреса страниц метрик приложений, например http://localhost:9100/metrics
+// timeout - время ожидания ответа приложения
+func NewPrometheusScrapePoller(targets []string, timeout time.Duration) *PrometheusScrapePoller {
+	metricsChan := make(chan *model.Metric)
+	return &PrometheusScrapePoller{
+		metricsChan: metricsChan,
+		targets:     targets,
+		client:      &http.Client{Timeout: timeout},
+		last:        make(map[string]map[string]float64),
+	}
+}
+
+// Run
+// Запускает сбор метрик
+// Ошибка сбора одного приложения записывается в лог и не останавливает сбор остальных
+// interval - интервал сбора метрик
+func (p *PrometheusScrapePoller) RunPoller(ctx context.Context, interval time.Duration) error {
+	l := logger.Get()
+	ticker := time.NewTicker(interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			close(p.metricsChan)
+			ticker.Stop()
+			return nil
+		case <-ticker.C:
+			for _, target := range p.targets {
+				metrics, err := p.scrape(ctx, target)
+				if err != nil {
+					l.Error().Err(err).Str("target", target).Msg("unable to scrape metrics")
+					continue
+				}
+				if err := p.sendMetric(ctx, metrics); err != nil {
+					// контекст отменен, канал закрывается на следующей итерации
+					break
+				}
+			}
+		}
+	}
+}
+
+// scrape
+// Загружает и разбирает метрики приложения
+func (p *PrometheusScrapePoller) scrape(ctx context.Context, target string) ([]*model.Metric, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", scrapeAccept)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	samples, err := promtext.Parse(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return p.metrics(target, samples), nil
+}
+
+// metrics
+// Преобразует значения серий приложения в метрики
+func (p *PrometheusScrapePoller) metrics(target string, samples []promtext.Sample) []*model.Metric {
+	instance := target
+	if u, err := url.Parse(target); err == nil && u.Host != "" {
+		instance = u.Host
+	}
+
+	prev := p.last[target]
+	last := make(map[string]float64)
+
+	metrics := make([]*model.Metric, 0, len(samples))
+	for _, s := range samples {
+		if math.IsNaN(s.Value) || math.IsInf(s.Value, 0) {
+			continue
+		}
+		labels := s.Labels.Merge(model.Labels{instanceLabel: instance})
+
+		var m *model.Metric
+		if s.Type == promtext.TypeCounter {
+			key := model.SeriesKey(s.Name, labels)
+			last[key] = s.Value
+
+			// первое значение - точка отсчета
+			var delta int64
+			if v, ok := prev[key]; ok {
+				delta = int64(math.Round(s.Value))
+				if s.Value >= v {
+					// разность округленных значений, чтобы ошибки округления не накапливались
+					delta -= int64(math.Round(v))
+				}
+			}
+			m = model.NewCounter(s.Name, delta)
+		} else {
+			m = model.NewGauge(s.Name, s.Value)
+		}
+		m.Labels = labels
+		metrics = append(metrics, m)
+	}
+
+	p.last[target] = last
+	return metrics
+}
+
+func (p *PrometheusScrapePoller) sendMetric(ctx context.Context, metric []*model.Metric) error {
+	for i := 0; i < len(metric); i++ {
+		select {
+		case p.metricsChan <- metric[i]:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (p *PrometheusScrapePoller) GetChannel() chan *model.Metric {
+	return p.metricsChan
+}
@@ -0,0 +1,69 @@
+package poller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+func TestPrometheusScrapePoller_RunPoller(t *testing.T) {
+	// значения counter по сборам: 10 (точка отсчета), 15, 3 (перезапуск приложения)
+	counters := []int{10, 15, 3}
+	var scrapes atomic.Int32
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(scrapes.Add(1)) - 1
+		if n >= len(counters) {
+			n = len(counters) - 1
+		}
+		_, _ = fmt.Fprintf(w, "# TYPE jobs_total counter\njobs_total{queue=\"mail\"} %d\n"+
+			"# TYPE queue_size gauge\nqueue_size %d\n", counters[n], n)
+	}))
+	defer app.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer broken.Close()
+
+	p := NewPrometheusScrapePoller([]string{broken.URL + "/metrics", app.URL + "/metrics"}, time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := p.RunPoller(ctx, 10*time.Millisecond)
+		assert.NoError(t, err)
+	}()
+
+	instance := strings.TrimPrefix(app.URL, "http://")
+	var got []model.Metric
+	for len(got) < 2*len(counters) {
+		m := <-p.GetChannel()
+		got = append(got, *m)
+	}
+	cancel()
+	wg.Wait()
+
+	want := []model.Metric{
+		{Type: model.MetricTypeCounter, Name: "jobs_total", Counter: 0, Labels: model.Labels{"queue": "mail", "instance": instance}},
+		{Type: model.MetricTypeGauge, Name: "queue_size", Gauge: 0, Labels: model.Labels{"instance": instance}},
+		{Type: model.MetricTypeCounter, Name: "jobs_total", Counter: 5, Labels: model.Labels{"queue": "mail", "instance": instance}},
+		{Type: model.MetricTypeGauge, Name: "queue_size", Gauge: 1, Labels: model.Labels{"instance": instance}},
+		{Type: model.MetricTypeCounter, Name: "jobs_total", Counter: 3, Labels: model.Labels{"queue": "mail", "instance": instance}},
+		{Type: model.MetricTypeGauge, Name: "queue_size", Gauge: 2, Labels: model.Labels{"instance": instance}},
+	}
+	require.Len(t, got, len(want))
+	assert.Equal(t, want, got)
+}
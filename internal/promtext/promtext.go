@@ -0,0 +1,254 @@
+// Package promtext
+// Разбор текстового формата метрик Prometheus (text exposition format 0.0.4)
+package promtext
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// Type
+// Тип семейства метрик, указанный в комментарии # TYPE
+type Type string
+
+const (
+	// TypeCounter накопленный счетчик
+	TypeCounter Type = "counter"
+	// TypeGauge значение
+	TypeGauge Type = "gauge"
+	// TypeHistogram гистограмма: серии name_bucket{le="..."}, name_sum и name_count
+	TypeHistogram Type = "histogram"
+	// TypeSummary summary: серии name{quantile="..."}, name_sum и name_count
+	TypeSummary Type = "summary"
+	// TypeUntyped тип не указан
+	TypeUntyped Type = "untyped"
+)
+
+// Sample
+// Значение серии
+// Type - тип семейства, к которому относится серия, для серий name_bucket, name_sum и name_count
+// гистограммы или summary - тип семейства name
+type Sample struct {
+	Name   string
+	Labels model.Labels
+	Value  float64
+	Type   Type
+}
+
+// ParseError
+// Ошибка разбора строки, Line - номер строки начиная с 1
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// Parse
+// Разбирает метрики в текстовом формате: строки "name{label="value",...} value [timestamp]"
+// Комментарии # TYPE задают тип семейства, остальные комментарии и пустые строки пропускаются
+// Серии без # TYPE имеют тип untyped, метка времени проверяется, но не используется
+// Возвращает *ParseError для первой некорректной строки
+func Parse(r io.Reader) ([]Sample, error) {
+	types := make(map[string]Type)
+	var samples []Sample
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		s := strings.TrimSpace(scanner.Text())
+		if s == "" {
+			continue
+		}
+		if s[0] == '#' {
+			if err := parseComment(s, types); err != nil {
+				return nil, &ParseError{Line: line, Msg: err.Error()}
+			}
+			continue
+		}
+		sample, err := parseSample(s)
+		if err != nil {
+			return nil, &ParseError{Line: line, Msg: err.Error()}
+		}
+		sample.Type = familyType(types, sample.Name)
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// parseComment
+// Запоминает тип семейства из комментария # TYPE name type
+func parseComment(s string, types map[string]Type) error {
+	fields := strings.Fields(s[1:])
+	if len(fields) == 0 || fields[0] != "TYPE" {
+		return nil
+	}
+	if len(fields) != 3 {
+		return fmt.Errorf("invalid TYPE comment")
+	}
+	switch t := Type(fields[2]); t {
+	case TypeCounter, TypeGauge, TypeHistogram, TypeSummary, TypeUntyped:
+		types[fields[1]] = t
+	default:
+		return fmt.Errorf("unknown metric type %q", fields[2])
+	}
+	return nil
+}
+
+// familyType
+// Возвращает тип семейства серии name
+func familyType(types map[string]Type, name string) Type {
+	if t, ok := types[name]; ok {
+		return t
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		family, ok := strings.CutSuffix(name, suffix)
+		if !ok {
+			continue
+		}
+		switch t := types[family]; {
+		case t == TypeHistogram:
+			return t
+		case t == TypeSummary && suffix != "_bucket":
+			return t
+		}
+	}
+	return TypeUntyped
+}
+
+func parseSample(s string) (Sample, error) {
+	var sample Sample
+
+	i := 0
+	for i < len(s) && isNameChar(s[i], i == 0) {
+		i++
+	}
+	if i == 0 {
+		return sample, fmt.Errorf("invalid metric name")
+	}
+	sample.Name = s[:i]
+	s = s[i:]
+
+	if strings.HasPrefix(s, "{") {
+		labels, rest, err := parseLabels(s[1:])
+		if err != nil {
+			return sample, err
+		}
+		sample.Labels = labels
+		s = rest
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) != 1 && len(fields) != 2 {
+		return sample, fmt.Errorf("expected value and optional timestamp")
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid value %q", fields[0])
+	}
+	sample.Value = value
+	if len(fields) == 2 {
+		if _, err := strconv.ParseInt(fields[1], 10, 64); err != nil {
+			return sample, fmt.Errorf("invalid timestamp %q", fields[1])
+		}
+	}
+	return sample, nil
+}
+
+// parseLabels
+// Разбирает метки после открывающей скобки, возвращает остаток строки после закрывающей скобки
+func parseLabels(s string) (model.Labels, string, error) {
+	var labels model.Labels
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if strings.HasPrefix(s, "}") {
+			return labels, s[1:], nil
+		}
+
+		i := 0
+		for i < len(s) && isNameChar(s[i], i == 0) && s[i] != ':' {
+			i++
+		}
+		if i == 0 {
+			return nil, "", fmt.Errorf("invalid label name")
+		}
+		name := s[:i]
+		s = strings.TrimLeft(s[i:], " \t")
+		if !strings.HasPrefix(s, "=") {
+			return nil, "", fmt.Errorf("label %s: expected =", name)
+		}
+		s = strings.TrimLeft(s[1:], " \t")
+		if !strings.HasPrefix(s, `"`) {
+			return nil, "", fmt.Errorf("label %s: expected quoted value", name)
+		}
+
+		value, rest, err := unquote(s[1:])
+		if err != nil {
+			return nil, "", fmt.Errorf("label %s: %w", name, err)
+		}
+		if labels == nil {
+			labels = make(model.Labels)
+		}
+		labels[name] = value
+
+		s = strings.TrimLeft(rest, " \t")
+		switch {
+		case strings.HasPrefix(s, ","):
+			s = s[1:]
+		case strings.HasPrefix(s, "}"):
+		default:
+			return nil, "", fmt.Errorf("expected , or } after label %s", name)
+		}
+	}
+}
+
+// unquote
+// Читает значение метки до закрывающей кавычки, обрабатывая \\, \" и \n
+func unquote(s string) (string, string, error) {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			return b.String(), s[i+1:], nil
+		case '\\':
+			if i+1 == len(s) {
+				return "", "", fmt.Errorf("unterminated escape")
+			}
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case '\\', '"':
+				b.WriteByte(s[i])
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated value")
+}
+
+// isNameChar
+// Проверяет символ имени [a-zA-Z_:][a-zA-Z0-9_:]*
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package promtext
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []Sample
+		wantErr string
+	}{
+		{
+			name: "families",
+			data: `# HELP http_requests_total Total requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+http_requests_total{method="get", code="400",} 3
+
+# TYPE temperature gauge
+temperature -2.5
+# TYPE latency histogram
+latency_bucket{le="0.1"} 2
+latency_bucket{le="+Inf"} 5
+latency_sum 1.2
+latency_count 5
+# TYPE rpc summary
+rpc{quantile="0.5"} 0.05
+rpc_sum 17
+rpc_count 40
+rpc_bucket 1
+up 1
+`,
+			want: []Sample{
+				{Name: "http_requests_total", Labels: model.Labels{"method": "post", "code": "200"}, Value: 1027, Type: TypeCounter},
+				{Name: "http_requests_total", Labels: model.Labels{"method": "get", "code": "400"}, Value: 3, Type: TypeCounter},
+				{Name: "temperature", Value: -2.5, Type: TypeGauge},
+				{Name: "latency_bucket", Labels: model.Labels{"le": "0.1"}, Value: 2, Type: TypeHistogram},
+				{Name: "latency_bucket", Labels: model.Labels{"le": "+Inf"}, Value: 5, Type: TypeHistogram},
+				{Name: "latency_sum", Value: 1.2, Type: TypeHistogram},
+				{Name: "latency_count", Value: 5, Type: TypeHistogram},
+				{Name: "rpc", Labels: model.Labels{"quantile": "0.5"}, Value: 0.05, Type: TypeSummary},
+				{Name: "rpc_sum", Value: 17, Type: TypeSummary},
+				{Name: "rpc_count", Value: 40, Type: TypeSummary},
+				{Name: "rpc_bucket", Value: 1, Type: TypeUntyped},
+				{Name: "up", Value: 1, Type: TypeUntyped},
+			},
+		},
+		{
+			name: "escaped label values",
+			data: `msg{path="C:\\dir",text="say \"hi\"\nbye",raw="a\b"} 1`,
+			want: []Sample{
+				{Name: "msg", Labels: model.Labels{"path": `C:\dir`, "text": "say \"hi\"\nbye", "raw": `a\b`}, Value: 1, Type: TypeUntyped},
+			},
+		},
+		{
+			name: "empty labels",
+			data: "up{} 0",
+			want: []Sample{{Name: "up", Value: 0, Type: TypeUntyped}},
+		},
+		{name: "missing value", data: "# comment\nup", wantErr: "line 2: expected value and optional timestamp"},
+		{name: "invalid value", data: "up one", wantErr: `line 1: invalid value "one"`},
+		{name: "invalid timestamp", data: "up 1 now", wantErr: `line 1: invalid timestamp "now"`},
+		{name: "invalid name", data: "1up 1", wantErr: "line 1: invalid metric name"},
+		{name: "unterminated label value", data: `up{job="api} 1`, wantErr: "line 1: label job: unterminated value"},
+		{name: "unquoted label value", data: `up{job=api} 1`, wantErr: "line 1: label job: expected quoted value"},
+		{name: "missing comma", data: `up{a="1" b="2"} 1`, wantErr: "line 1: expected , or } after label a"},
+		{name: "unknown type", data: "# TYPE up enum\nup 1", wantErr: `line 1: unknown metric type "enum"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.data))
+			if tt.wantErr != "" {
+				var parseErr *ParseError
+				require.ErrorAs(t, err, &parseErr)
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParse_SpecialValues(t *testing.T) {
+	got, err := Parse(strings.NewReader("a NaN\nb +Inf\nc -Inf\nd 1e3"))
+	require.NoError(t, err)
+	require.Len(t, got, 4)
+	assert.True(t, math.IsNaN(got[0].Value))
+	assert.True(t, math.IsInf(got[1].Value, 1))
+	assert.True(t, math.IsInf(got[2].Value, -1))
+	assert.Equal(t, 1000.0, got[3].Value)
+}
@@ -0,0 +1,130 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// ErrInvalidMetric
+// Ошибка проверки метрики, полученной по gRPC
+var ErrInvalidMetric = errors.New("invalid metric")
+
+var modelTypes = map[MType]model.MetricType{
+	MType_GAUGE:     model.MetricTypeGauge,
+	MType_COUNTER:   model.MetricTypeCounter,
+	MType_HISTOGRAM: model.MetricTypeHistogram,
+	MType_SUMMARY:   model.MetricTypeSummary,
+}
+
+// ModelType
+// Возвращает тип метрики модели
+func ModelType(t MType) (model.MetricType, error) {
+	mt, ok := modelTypes[t]
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown type %s", ErrInvalidMetric, t)
+	}
+	return mt, nil
+}
+
+// FromModelType
+// Возвращает тип метрики gRPC
+func FromModelType(t model.MetricType) MType {
+	for k, v := range modelTypes {
+		if v == t {
+			return k
+		}
+	}
+	return MType_MTYPE_UNSPECIFIED
+}
+
+// ToModel
+// Проверяет метрику и преобразует её в метрику модели
+// Для summary наблюдения observations собираются в новый sketch
+func (m *Metric) ToModel() (*model.Metric, error) {
+	metricType, err := ModelType(m.GetType())
+	if err != nil {
+		return nil, err
+	}
+
+	var metric *model.Metric
+	switch metricType {
+	case model.MetricTypeGauge:
+		metric = model.NewGauge(m.GetId(), m.GetValue())
+	case model.MetricTypeCounter:
+		metric = model.NewCounter(m.GetId(), m.GetDelta())
+	case model.MetricTypeHistogram:
+		if m.GetHistogram() == nil {
+			return nil, fmt.Errorf("%w: missing histogram", ErrInvalidMetric)
+		}
+		h := &model.Histogram{
+			Buckets: m.Histogram.GetBuckets(),
+			Counts:  m.Histogram.GetCounts(),
+			Sum:     m.Histogram.GetSum(),
+			Count:   m.Histogram.GetCount(),
+		}
+		if err := h.Validate(); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMetric, err)
+		}
+		metric = &model.Metric{Type: model.MetricTypeHistogram, Name: m.GetId(), Histogram: h}
+	case model.MetricTypeSummary:
+		if len(m.GetObservations()) == 0 {
+			return nil, fmt.Errorf("%w: missing observations", ErrInvalidMetric)
+		}
+		metric = model.NewSummary(m.GetId())
+		for _, v := range m.GetObservations() {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("%w: invalid observation", ErrInvalidMetric)
+			}
+			metric.Summary.Observe(v)
+		}
+	}
+
+	if len(m.GetLabels()) > 0 {
+		metric.Labels = m.GetLabels()
+	}
+	return metric, nil
+}
+
+// FromModel
+// Преобразует метрику модели в метрику gRPC
+// quantiles - квантили, оценки которых возвращаются для summary
+// Для summary передаются и наблюдения observations, если они сохранены в метрике (отправка агентом)
+func FromModel(metric *model.Metric, quantiles []float64) *Metric {
+	m := &Metric{
+		Id:     metric.Name,
+		Type:   FromModelType(metric.Type),
+		Labels: metric.Labels,
+	}
+	switch metric.Type {
+	case model.MetricTypeGauge:
+		m.Value = metric.Gauge
+	case model.MetricTypeCounter:
+		m.Delta = metric.Counter
+	case model.MetricTypeHistogram:
+		if metric.Histogram != nil {
+			m.Histogram = &Histogram{
+				Buckets: metric.Histogram.Buckets,
+				Counts:  metric.Histogram.Counts,
+				Sum:     metric.Histogram.Sum,
+				Count:   metric.Histogram.Count,
+			}
+		}
+	case model.MetricTypeSummary:
+		m.Observations = metric.Observations
+		if metric.Summary != nil {
+			m.Summary = &Summary{
+				Count:     metric.Summary.Count,
+				Sum:       metric.Summary.Sum,
+				Quantiles: make(map[string]float64, len(quantiles)),
+			}
+			for _, q := range quantiles {
+				m.Summary.Quantiles[strconv.FormatFloat(q, 'f', -1, 64)] = metric.Summary.Quantile(q)
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,41 @@
+package proto
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// PushCommittedTrailer
+	// Ключ trailer метаданных потока Push, завершенного с ошибкой: пакеты, сохраненные до ошибки
+	PushCommittedTrailer = "x-push-committed"
+	// PushRejectedTrailer
+	// Ключ trailer метаданных потока Push, завершенного с ошибкой: пакеты, отклоненные до ошибки
+	PushRejectedTrailer = "x-push-rejected"
+)
+
+// FormatBatchIDs
+// Возвращает идентификаторы пакетов через запятую
+func FormatBatchIDs(ids []uint64) string {
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.FormatUint(id, 10))
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseBatchIDs
+// Разбирает идентификаторы пакетов, записанные FormatBatchIDs, некорректные значения пропускаются
+func ParseBatchIDs(values []string) []uint64 {
+	var ids []uint64
+	for _, v := range values {
+		for _, part := range strings.Split(v, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 64)
+			if err != nil {
+				continue
+			}
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,32 @@
+package proto
+
+import (
+	"strconv"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// SignatureHeader
+	// Ключ метаданных с подписью сообщения, аналог заголовка HashSHA256 в HTTP API
+	SignatureHeader = "hashsha256"
+	// SignatureTimestampHeader
+	// Ключ метаданных с временем подписи, аналог заголовка X-Signature-Timestamp в HTTP API
+	SignatureTimestampHeader = "x-signature-timestamp"
+	// SignatureNonceHeader
+	// Ключ метаданных с одноразовым значением, аналог заголовка X-Signature-Nonce в HTTP API
+	SignatureNonceHeader = "x-signature-nonce"
+)
+
+// SigningBytes
+// Возвращает детерминированно сериализованное сообщение, которое подписывается вместо тела HTTP запроса
+func SigningBytes(msg proto.Message) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// StreamNonce
+// Возвращает одноразовое значение пакета потока: одноразовое значение потока и номер пакета начиная с 1,
+// поэтому пакет нельзя повторить или переставить внутри потока
+func StreamNonce(nonce string, seq uint64) string {
+	return nonce + "/" + strconv.FormatUint(seq, 10)
+}
@@ -0,0 +1,191 @@
+package query
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// LookbackDelta
+// Интервал, в котором ищется последнее значение серии для выражения без интервала
+const LookbackDelta = 5 * time.Minute
+
+// Storage
+// Хранилище истории значений, над которым вычисляются выражения
+type Storage interface {
+	GetList() ([]model.Metric, error)
+	GetSeries(metricType model.MetricType, name string, labels model.Labels, from, to time.Time) ([]model.Point, error)
+}
+
+// Sample
+// Значение серии в результате вычисления выражения
+// Name - имя метрики, пустое после применения функций и агрегации
+type Sample struct {
+	Name   string       `json:"name,omitempty"`
+	Labels model.Labels `json:"labels,omitempty"`
+	Value  float64      `json:"value"`
+}
+
+// Eval
+// Вычисляет выражение на момент времени t
+// Результат отсортирован по имени и меткам
+func Eval(s Storage, expr Expr, t time.Time) ([]Sample, error) {
+	samples, err := eval(s, expr, t)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		if samples[i].Name != samples[j].Name {
+			return samples[i].Name < samples[j].Name
+		}
+		return samples[i].Labels.String() < samples[j].Labels.String()
+	})
+	return samples, nil
+}
+
+func eval(s Storage, expr Expr, t time.Time) ([]Sample, error) {
+	switch e := expr.(type) {
+	case *Selector:
+		return evalRange(s, e, t, LookbackDelta, e.Name, last)
+	case *Call:
+		return evalRange(s, e.Arg, t, e.Arg.Range, "", rangeFunctions[e.Func])
+	case *Aggregate:
+		samples, err := eval(s, e.Expr, t)
+		if err != nil {
+			return nil, err
+		}
+		return sum(samples, e.By), nil
+	}
+	return nil, ErrInvalidQuery
+}
+
+// evalRange
+// Применяет fn к точкам каждой серии, подходящей под селектор, за интервал [t-window, t]
+// Серии без значения в интервале в результат не попадают
+func evalRange(s Storage, sel *Selector, t time.Time, window time.Duration, name string, fn func([]model.Point) (float64, bool)) ([]Sample, error) {
+	metrics, err := s.GetList()
+	if err != nil {
+		return nil, err
+	}
+	samples := make([]Sample, 0)
+	for _, m := range metrics {
+		if !matches(sel, &m) {
+			continue
+		}
+		points, err := s.GetSeries(m.Type, m.Name, m.Labels, t.Add(-window), t)
+		if err != nil {
+			return nil, err
+		}
+		v, ok := fn(points)
+		if !ok {
+			continue
+		}
+		samples = append(samples, Sample{Name: name, Labels: m.Labels, Value: v})
+	}
+	return samples, nil
+}
+
+// matches
+// Проверяет, что метрика хранит историю и подходит под имя и метки селектора
+func matches(sel *Selector, m *model.Metric) bool {
+	if m.Name != sel.Name {
+		return false
+	}
+	if m.Type != model.MetricTypeGauge && m.Type != model.MetricTypeCounter {
+		return false
+	}
+	for k, v := range sel.Matchers {
+		if m.Labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// sum
+// Суммирует значения серий с одинаковыми значениями меток by
+func sum(samples []Sample, by []string) []Sample {
+	groups := make(map[string]*Sample)
+	order := make([]string, 0)
+	for _, smp := range samples {
+		var labels model.Labels
+		for _, k := range by {
+			if v, ok := smp.Labels[k]; ok {
+				labels = labels.Merge(model.Labels{k: v})
+			}
+		}
+		key := labels.String()
+		g, ok := groups[key]
+		if !ok {
+			g = &Sample{Labels: labels}
+			groups[key] = g
+			order = append(order, key)
+		}
+		g.Value += smp.Value
+	}
+	result := make([]Sample, 0, len(order))
+	for _, key := range order {
+		result = append(result, *groups[key])
+	}
+	return result
+}
+
+// last
+// Последнее значение серии
+func last(points []model.Point) (float64, bool) {
+	if len(points) == 0 {
+		return 0, false
+	}
+	return points[len(points)-1].Value, true
+}
+
+// rate
+// Средняя скорость роста накопленного значения в секунду между первой и последней точкой
+// Уменьшение значения считается сбросом счетчика
+func rate(points []model.Point) (float64, bool) {
+	if len(points) < 2 {
+		return 0, false
+	}
+	first, lastPoint := points[0], points[len(points)-1]
+	seconds := lastPoint.Timestamp.Sub(first.Timestamp).Seconds()
+	if seconds <= 0 {
+		return 0, false
+	}
+	var increase float64
+	for i := 1; i < len(points); i++ {
+		delta := points[i].Value - points[i-1].Value
+		if delta < 0 {
+			delta = points[i].Value
+		}
+		increase += delta
+	}
+	return increase / seconds, true
+}
+
+// avgOverTime
+// Среднее значение за интервал
+func avgOverTime(points []model.Point) (float64, bool) {
+	if len(points) == 0 {
+		return 0, false
+	}
+	var total float64
+	for _, p := range points {
+		total += p.Value
+	}
+	return total / float64(len(points)), true
+}
+
+// maxOverTime
+// Максимальное значение за интервал
+func maxOverTime(points []model.Point) (float64, bool) {
+	if len(points) == 0 {
+		return 0, false
+	}
+	m := math.Inf(-1)
+	for _, p := range points {
+		m = math.Max(m, p.Value)
+	}
+	return m, true
+}
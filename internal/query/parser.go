@@ -0,0 +1,347 @@
+// Package query
+// Язык выражений над историей значений метрик
+//
+// Поддерживаемые выражения:
+//
+//	PollCount                             последнее значение серий метрики
+//	PollCount{host="a"}                   последнее значение серий с метками
+//	rate(PollCount[5m])                   скорость роста counter в секунду за интервал
+//	avg_over_time(Alloc[1h])              среднее значение за интервал
+//	max_over_time(Alloc[1h])              максимальное значение за интервал
+//	sum by (host) (rate(PollCount[5m]))   сумма значений с группировкой по меткам
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// ErrInvalidQuery
+// Ошибка разбора или проверки выражения
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Expr
+// Узел дерева выражения
+type Expr interface {
+	String() string
+}
+
+// Selector
+// Выбор серий метрики по имени и меткам
+// Range - длина интервала для функций над интервалом, 0 - последнее значение
+type Selector struct {
+	Name     string
+	Matchers model.Labels
+	Range    time.Duration
+}
+
+func (s *Selector) String() string {
+	str := s.Name + s.Matchers.String()
+	if s.Range > 0 {
+		str += "[" + s.Range.String() + "]"
+	}
+	return str
+}
+
+// Call
+// Вызов функции над интервалом значений серий
+type Call struct {
+	Func string
+	Arg  *Selector
+}
+
+func (c *Call) String() string {
+	return c.Func + "(" + c.Arg.String() + ")"
+}
+
+// Aggregate
+// Агрегация значений нескольких серий с группировкой по меткам By
+type Aggregate struct {
+	Op   string
+	By   []string
+	Expr Expr
+}
+
+func (a *Aggregate) String() string {
+	str := a.Op
+	if len(a.By) > 0 {
+		str += " by (" + strings.Join(a.By, ", ") + ")"
+	}
+	return str + " (" + a.Expr.String() + ")"
+}
+
+// rangeFunctions
+// Функции над интервалом значений серии
+var rangeFunctions = map[string]func([]model.Point) (float64, bool){
+	"rate":          rate,
+	"avg_over_time": avgOverTime,
+	"max_over_time": maxOverTime,
+}
+
+// aggregateOperators
+// Операторы агрегации серий
+var aggregateOperators = map[string]struct{}{
+	"sum": {},
+}
+
+// Parse
+// Разбирает выражение
+func Parse(input string) (Expr, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf("unexpected %q", t.value)
+	}
+	return expr, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenString
+	tokenPunct
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// lex
+// Разбивает выражение на идентификаторы, строки в кавычках и знаки ( ) { } [ ] , =
+func lex(input string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(input); {
+		r := rune(input[i])
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case strings.ContainsRune("(){}[],=", r):
+			tokens = append(tokens, token{kind: tokenPunct, value: string(r), pos: i})
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(input) && input[j] != '"' {
+				if input[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(input) {
+				return nil, fmt.Errorf("%w: unterminated string at %d", ErrInvalidQuery, i)
+			}
+			value, err := strconv.Unquote(input[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid string at %d: %s", ErrInvalidQuery, i, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, value: value, pos: i})
+			i = j + 1
+		case isIdentRune(r):
+			j := i
+			for j < len(input) && isIdentRune(rune(input[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, value: input[i:j], pos: i})
+			i = j
+		default:
+			return nil, fmt.Errorf("%w: unexpected character %q at %d", ErrInvalidQuery, r, i)
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(input)}), nil
+}
+
+func isIdentRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == ':' || r == '.'
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at %d", ErrInvalidQuery, fmt.Sprintf(format, args...), p.peek().pos)
+}
+
+func (p *parser) expect(value string) error {
+	if t := p.peek(); t.kind != tokenPunct || t.value != value {
+		return p.errorf("expected %q", value)
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) accept(value string) bool {
+	if t := p.peek(); t.kind == tokenPunct && t.value == value {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseExpr() (Expr, error) {
+	t := p.peek()
+	if t.kind != tokenIdent {
+		return nil, p.errorf("expected metric name or function")
+	}
+	if _, ok := aggregateOperators[t.value]; ok {
+		return p.parseAggregate()
+	}
+	if _, ok := rangeFunctions[t.value]; ok {
+		return p.parseCall()
+	}
+	return p.parseSelector()
+}
+
+// parseAggregate
+// sum by (l1, l2) (expr) или sum (expr) by (l1, l2)
+func (p *parser) parseAggregate() (Expr, error) {
+	agg := &Aggregate{Op: p.next().value}
+	var err error
+	if t := p.peek(); t.kind == tokenIdent && t.value == "by" {
+		if agg.By, err = p.parseBy(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expect("("); err != nil {
+		return nil, err
+	}
+	if agg.Expr, err = p.parseExpr(); err != nil {
+		return nil, err
+	}
+	if err = p.expect(")"); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); agg.By == nil && t.kind == tokenIdent && t.value == "by" {
+		if agg.By, err = p.parseBy(); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
+
+func (p *parser) parseBy() ([]string, error) {
+	p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	by := make([]string, 0)
+	for !p.accept(")") {
+		if len(by) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		t := p.next()
+		if t.kind != tokenIdent {
+			return nil, p.errorf("expected label name")
+		}
+		by = append(by, t.value)
+	}
+	return by, nil
+}
+
+func (p *parser) parseCall() (Expr, error) {
+	call := &Call{Func: p.next().value}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arg, err := p.parseSelector()
+	if err != nil {
+		return nil, err
+	}
+	if arg.Range == 0 {
+		return nil, p.errorf("%s expects a range selector, e.g. metric[5m]", call.Func)
+	}
+	call.Arg = arg
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return call, nil
+}
+
+func (p *parser) parseSelector() (*Selector, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return nil, p.errorf("expected metric name")
+	}
+	s := &Selector{Name: t.value}
+	if p.accept("{") {
+		s.Matchers = make(model.Labels)
+		for !p.accept("}") {
+			if len(s.Matchers) > 0 {
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+			k := p.next()
+			if k.kind != tokenIdent {
+				return nil, p.errorf("expected label name")
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			v := p.next()
+			if v.kind != tokenString {
+				return nil, p.errorf("expected quoted label value")
+			}
+			s.Matchers[k.value] = v.value
+		}
+	}
+	if p.accept("[") {
+		t := p.next()
+		if t.kind != tokenIdent {
+			return nil, p.errorf("expected range duration")
+		}
+		d, err := parseDuration(t.value)
+		if err != nil || d <= 0 {
+			return nil, p.errorf("invalid range duration %q", t.value)
+		}
+		s.Range = d
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// parseDuration
+// Разбирает длительность в формате time.ParseDuration, дополнительно поддерживаются дни (1d)
+func parseDuration(raw string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(raw)
+}
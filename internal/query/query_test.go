@@ -0,0 +1,190 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    Expr
+		wantErr bool
+	}{
+		{
+			name:  "selector",
+			input: "PollCount",
+			want:  &Selector{Name: "PollCount"},
+		},
+		{
+			name:  "selector with matchers",
+			input: `Alloc{host="a", agent_id="1"}`,
+			want:  &Selector{Name: "Alloc", Matchers: model.Labels{"host": "a", "agent_id": "1"}},
+		},
+		{
+			name:  "rate",
+			input: "rate(PollCount[5m])",
+			want:  &Call{Func: "rate", Arg: &Selector{Name: "PollCount", Range: 5 * time.Minute}},
+		},
+		{
+			name:  "days range",
+			input: "max_over_time(Alloc[1d])",
+			want:  &Call{Func: "max_over_time", Arg: &Selector{Name: "Alloc", Range: 24 * time.Hour}},
+		},
+		{
+			name:  "sum by",
+			input: "sum by (host) (avg_over_time(Alloc[1h]))",
+			want: &Aggregate{Op: "sum", By: []string{"host"}, Expr: &Call{
+				Func: "avg_over_time", Arg: &Selector{Name: "Alloc", Range: time.Hour},
+			}},
+		},
+		{
+			name:  "sum with trailing by",
+			input: "sum(PollCount) by (host, agent_id)",
+			want:  &Aggregate{Op: "sum", By: []string{"host", "agent_id"}, Expr: &Selector{Name: "PollCount"}},
+		},
+		{
+			name:  "sum without grouping",
+			input: "sum(PollCount)",
+			want:  &Aggregate{Op: "sum", Expr: &Selector{Name: "PollCount"}},
+		},
+		{
+			name:    "function without range",
+			input:   "rate(PollCount)",
+			wantErr: true,
+		},
+		{
+			name:    "invalid range",
+			input:   "rate(PollCount[5x])",
+			wantErr: true,
+		},
+		{
+			name:    "unquoted label value",
+			input:   "PollCount{host=a}",
+			wantErr: true,
+		},
+		{
+			name:    "unterminated string",
+			input:   `PollCount{host="a}`,
+			wantErr: true,
+		},
+		{
+			name:    "trailing tokens",
+			input:   "PollCount Alloc",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidQuery)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEval(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	hostA := model.Labels{"host": "a", "agent_id": "1"}
+	hostB := model.Labels{"host": "b", "agent_id": "2"}
+
+	pollCountA := model.NewCounter("PollCount", 0)
+	pollCountA.Labels = hostA
+	pollCountB := model.NewCounter("PollCount", 0)
+	pollCountB.Labels = hostB
+	allocA := model.NewGauge("Alloc", 0)
+	allocA.Labels = hostA
+
+	series := func(values ...float64) []model.Point {
+		points := make([]model.Point, 0, len(values))
+		for i, v := range values {
+			points = append(points, model.Point{Timestamp: now.Add(time.Duration(i-len(values)+1) * 10 * time.Second), Value: v})
+		}
+		return points
+	}
+
+	s := &storage.MockStorage{}
+	s.On("GetList").Return([]model.Metric{*pollCountA, *pollCountB, *allocA}, nil)
+	s.On("GetSeries", model.MetricTypeCounter, "PollCount", hostA, mock.Anything, now).Return(series(10, 20, 30), nil)
+	// сброс счетчика после перезапуска агента
+	s.On("GetSeries", model.MetricTypeCounter, "PollCount", hostB, mock.Anything, now).Return(series(50, 5, 15), nil)
+	s.On("GetSeries", model.MetricTypeGauge, "Alloc", hostA, mock.Anything, now).Return(series(1, 5, 3), nil)
+
+	tests := []struct {
+		name  string
+		input string
+		want  []Sample
+	}{
+		{
+			name:  "last value",
+			input: "Alloc",
+			want:  []Sample{{Name: "Alloc", Labels: hostA, Value: 3}},
+		},
+		{
+			name:  "rate",
+			input: "rate(PollCount[5m])",
+			want: []Sample{
+				{Labels: hostA, Value: 1},
+				{Labels: hostB, Value: 0.75},
+			},
+		},
+		{
+			name:  "rate with matcher",
+			input: `rate(PollCount{host="b"}[5m])`,
+			want:  []Sample{{Labels: hostB, Value: 0.75}},
+		},
+		{
+			name:  "avg over time",
+			input: "avg_over_time(Alloc[1h])",
+			want:  []Sample{{Labels: hostA, Value: 3}},
+		},
+		{
+			name:  "max over time",
+			input: "max_over_time(Alloc[1h])",
+			want:  []Sample{{Labels: hostA, Value: 5}},
+		},
+		{
+			name:  "sum",
+			input: "sum(rate(PollCount[5m]))",
+			want:  []Sample{{Value: 1.75}},
+		},
+		{
+			name:  "sum by",
+			input: "sum by (host) (PollCount)",
+			want: []Sample{
+				{Labels: model.Labels{"host": "a"}, Value: 30},
+				{Labels: model.Labels{"host": "b"}, Value: 15},
+			},
+		},
+		{
+			name:  "unknown metric",
+			input: "unknown",
+			want:  []Sample{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := Parse(tt.input)
+			assert.NoError(t, err)
+			got, err := Eval(s, expr, now)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
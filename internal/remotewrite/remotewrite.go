@@ -0,0 +1,226 @@
+// Package remotewrite
+// Разбор запросов Prometheus remote_write: WriteRequest в protobuf, сжатый snappy
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/golang/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// MaxDecodedSize
+// Максимальный размер распакованного запроса
+const MaxDecodedSize = 32 << 20
+
+// NameLabel
+// Метка с именем метрики
+const NameLabel = "__name__"
+
+// ErrInvalidRequest
+// Ошибка разбора запроса: поврежденные данные или серия без имени
+var ErrInvalidRequest = errors.New("invalid write request")
+
+// Label
+// Метка серии
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample
+// Значение серии, Timestamp - время в миллисекундах
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// TimeSeries
+// Серия с метками и значениями
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// WriteRequest
+// Запрос remote_write, метаданные и exemplars не используются
+type WriteRequest struct {
+	Timeseries []TimeSeries
+}
+
+// номера полей prometheus.WriteRequest, TimeSeries, Label и Sample
+const (
+	fieldWriteRequestTimeseries = 1
+	fieldTimeSeriesLabels       = 1
+	fieldTimeSeriesSamples      = 2
+	fieldLabelName              = 1
+	fieldLabelValue             = 2
+	fieldSampleValue            = 1
+	fieldSampleTimestamp        = 2
+)
+
+// Decode
+// Распаковывает snappy (block format) и разбирает WriteRequest
+func Decode(compressed []byte) (*WriteRequest, error) {
+	size, err := snappy.DecodedLen(compressed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+	if size > MaxDecodedSize {
+		return nil, fmt.Errorf("%w: decoded size %d exceeds %d", ErrInvalidRequest, size, MaxDecodedSize)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRequest, err)
+	}
+	return Unmarshal(data)
+}
+
+// Unmarshal
+// Разбирает WriteRequest в protobuf, неизвестные поля пропускаются
+func Unmarshal(data []byte) (*WriteRequest, error) {
+	req := &WriteRequest{}
+	err := walk(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if num != fieldWriteRequestTimeseries || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := unmarshalTimeSeries(v)
+		if err != nil {
+			return err
+		}
+		req.Timeseries = append(req.Timeseries, ts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func unmarshalTimeSeries(data []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := walk(data, func(num protowire.Number, typ protowire.Type, v []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case fieldTimeSeriesLabels:
+			var label Label
+			err := walk(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				if typ != protowire.BytesType {
+					return nil
+				}
+				switch num {
+				case fieldLabelName:
+					label.Name = string(v)
+				case fieldLabelValue:
+					label.Value = string(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, label)
+		case fieldTimeSeriesSamples:
+			var sample Sample
+			err := walk(v, func(num protowire.Number, typ protowire.Type, v []byte) error {
+				switch {
+				case num == fieldSampleValue && typ == protowire.Fixed64Type:
+					bits, _ := protowire.ConsumeFixed64(v)
+					sample.Value = math.Float64frombits(bits)
+				case num == fieldSampleTimestamp && typ == protowire.VarintType:
+					n, _ := protowire.ConsumeVarint(v)
+					sample.Timestamp = int64(n)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, sample)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+// walk
+// Перебирает поля сообщения protobuf
+// Для полей varint и fixed64 в fn передается закодированное значение, для bytes - содержимое поля
+func walk(data []byte, fn func(num protowire.Number, typ protowire.Type, v []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return fmt.Errorf("%w: %s", ErrInvalidRequest, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		var v []byte
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(data)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, data)
+			if n >= 0 {
+				v = data[:n]
+			}
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %s", ErrInvalidRequest, protowire.ParseError(n))
+		}
+		data = data[n:]
+
+		if err := fn(num, typ, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Metrics
+// Преобразует серии в метрики gauge: метка __name__ становится именем, остальные метки - метками метрики
+// Для каждой серии сохраняется последнее по времени значение, NaN (в том числе маркеры устаревания)
+// и бесконечные значения пропускаются
+// Значения counter Prometheus накопленные, поэтому тоже сохраняются как gauge, а не прибавляются к counter
+func Metrics(req *WriteRequest) ([]model.Metric, error) {
+	metrics := make([]model.Metric, 0, len(req.Timeseries))
+	for _, ts := range req.Timeseries {
+		var name string
+		var labels model.Labels
+		for _, label := range ts.Labels {
+			if label.Name == NameLabel {
+				name = label.Value
+				continue
+			}
+			if labels == nil {
+				labels = make(model.Labels, len(ts.Labels))
+			}
+			labels[label.Name] = label.Value
+		}
+		if name == "" {
+			return nil, fmt.Errorf("%w: series %s without %s label", ErrInvalidRequest, labels.String(), NameLabel)
+		}
+
+		samples := make([]Sample, 0, len(ts.Samples))
+		for _, s := range ts.Samples {
+			if !math.IsNaN(s.Value) && !math.IsInf(s.Value, 0) {
+				samples = append(samples, s)
+			}
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].Timestamp < samples[j].Timestamp })
+
+		m := model.NewGauge(name, samples[len(samples)-1].Value)
+		m.Labels = labels
+		metrics = append(metrics, *m)
+	}
+	return metrics, nil
+}
@@ -0,0 +1,126 @@
+package remotewrite
+
+import (
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/golang/snappy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// cannedRequest
+// WriteRequest в protobuf: http_requests_total{job="api"} со значениями 2.5 и 1.5 (в обратном порядке времени),
+// up со значением 1 и метаданные, которые должны пропускаться
+const cannedRequest = "0a510a1f0a085f5f6e616d655f5f1213687474705f72657175657374735f746f74616c0a0a0a036a6f6212036170" +
+	"6912100900000000000004401098c596ffbc31121009000000000000f83f1080d095ffbc310a220a0e0a085f5f6e616d655f5f1202757012" +
+	"1009000000000000f03f1080d095ffbc311a06080112027570"
+
+func canned(t *testing.T) []byte {
+	data, err := hex.DecodeString(cannedRequest)
+	require.NoError(t, err)
+	return data
+}
+
+// encode
+// Кодирует WriteRequest в protobuf
+func encode(req *WriteRequest) []byte {
+	var b []byte
+	for _, ts := range req.Timeseries {
+		var tsb []byte
+		for _, l := range ts.Labels {
+			var lb []byte
+			lb = protowire.AppendTag(lb, fieldLabelName, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Name)
+			lb = protowire.AppendTag(lb, fieldLabelValue, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.Value)
+			tsb = protowire.AppendTag(tsb, fieldTimeSeriesLabels, protowire.BytesType)
+			tsb = protowire.AppendBytes(tsb, lb)
+		}
+		for _, s := range ts.Samples {
+			var sb []byte
+			sb = protowire.AppendTag(sb, fieldSampleValue, protowire.Fixed64Type)
+			sb = protowire.AppendFixed64(sb, math.Float64bits(s.Value))
+			sb = protowire.AppendTag(sb, fieldSampleTimestamp, protowire.VarintType)
+			sb = protowire.AppendVarint(sb, uint64(s.Timestamp))
+			tsb = protowire.AppendTag(tsb, fieldTimeSeriesSamples, protowire.BytesType)
+			tsb = protowire.AppendBytes(tsb, sb)
+		}
+		b = protowire.AppendTag(b, fieldWriteRequestTimeseries, protowire.BytesType)
+		b = protowire.AppendBytes(b, tsb)
+	}
+	return b
+}
+
+func TestDecode(t *testing.T) {
+	req, err := Decode(snappy.Encode(nil, canned(t)))
+	require.NoError(t, err)
+
+	assert.Equal(t, &WriteRequest{Timeseries: []TimeSeries{
+		{
+			Labels:  []Label{{Name: "__name__", Value: "http_requests_total"}, {Name: "job", Value: "api"}},
+			Samples: []Sample{{Value: 2.5, Timestamp: 1700000015000}, {Value: 1.5, Timestamp: 1700000000000}},
+		},
+		{
+			Labels:  []Label{{Name: "__name__", Value: "up"}},
+			Samples: []Sample{{Value: 1, Timestamp: 1700000000000}},
+		},
+	}}, req)
+
+	t.Run("round trip", func(t *testing.T) {
+		got, err := Unmarshal(encode(req))
+		require.NoError(t, err)
+		assert.Equal(t, req, got)
+	})
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	data := canned(t)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "not snappy", data: []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "uncompressed protobuf", data: data},
+		{name: "truncated protobuf", data: snappy.Encode(nil, data[:len(data)-10])},
+		{name: "too large", data: snappy.Encode(nil, make([]byte, MaxDecodedSize+1))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.data)
+			assert.ErrorIs(t, err, ErrInvalidRequest)
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	req, err := Unmarshal(canned(t))
+	require.NoError(t, err)
+
+	metrics, err := Metrics(req)
+	require.NoError(t, err)
+	assert.Equal(t, []model.Metric{
+		{Type: model.MetricTypeGauge, Name: "http_requests_total", Gauge: 2.5, Labels: model.Labels{"job": "api"}},
+		{Type: model.MetricTypeGauge, Name: "up", Gauge: 1},
+	}, metrics)
+
+	t.Run("stale and empty series", func(t *testing.T) {
+		metrics, err := Metrics(&WriteRequest{Timeseries: []TimeSeries{
+			{Labels: []Label{{Name: NameLabel, Value: "stale"}}, Samples: []Sample{{Value: math.NaN(), Timestamp: 1}}},
+			{Labels: []Label{{Name: NameLabel, Value: "empty"}}},
+		}})
+		require.NoError(t, err)
+		assert.Empty(t, metrics)
+	})
+
+	t.Run("series without name", func(t *testing.T) {
+		_, err := Metrics(&WriteRequest{Timeseries: []TimeSeries{
+			{Labels: []Label{{Name: "job", Value: "api"}}, Samples: []Sample{{Value: 1}}},
+		}})
+		assert.ErrorIs(t, err, ErrInvalidRequest)
+	})
+}
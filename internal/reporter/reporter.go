@@ -9,20 +9,30 @@ import (
 	"github.com/soltanat/metrics/internal/model"
 
 	"github.com/soltanat/metrics/internal"
-	"github.com/soltanat/metrics/internal/client"
 )
 
+// Client
+// Клиент для отправки метрик, например client.Client или client.GRPCClient
+type Client interface {
+	Updates(metrics []model.Metric) error
+}
+
 // Reporter
 // Реализует интерфейс Reporter
 type Reporter struct {
-	client    *client.Client
+	client    Client
 	limitChan chan struct{}
+	labels    model.Labels
 }
 
-func New(client *client.Client, limitChan chan struct{}) *Reporter {
+// New
+// Создает Reporter
+// labels - метки, добавляемые ко всем отправляемым метрикам (например host, agent_id)
+func New(client Client, limitChan chan struct{}, labels model.Labels) *Reporter {
 	reporter := &Reporter{
 		client:    client,
 		limitChan: limitChan,
+		labels:    labels,
 	}
 	return reporter
 }
@@ -65,6 +75,7 @@ func (w *Reporter) RunReporter(ctx context.Context, interval time.Duration, ch c
 			}
 			metrics = metrics[:0]
 		case m := <-ch:
+			m.Labels = m.Labels.Merge(w.labels)
 			metrics = append(metrics, *m)
 		}
 	}
@@ -0,0 +1,55 @@
+package reporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/client"
+	"github.com/soltanat/metrics/internal/handler"
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+func TestReporter_RunReporter(t *testing.T) {
+	s := storage.NewMemStorage()
+	r, err := handler.SetupRoutes(handler.New(s, nil), "", []byte(""))
+	require.NoError(t, err)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *model.Metric)
+	done := make(chan error)
+	rep := New(client.New(srv.URL, http.DefaultTransport), make(chan struct{}, 1), model.Labels{
+		"host":     "a",
+		"agent_id": "1",
+	})
+	go func() {
+		done <- rep.RunReporter(ctx, 50*time.Millisecond, ch)
+	}()
+
+	ch <- model.NewGauge("Alloc", 2.5)
+
+	// метрика агента хранится с метками host и agent_id, но доступна по одному имени
+	var resp *resty.Response
+	assert.Eventually(t, func() bool {
+		resp, err = resty.New().R().Get(srv.URL + "/value/gauge/Alloc/")
+		return err == nil && resp.StatusCode() == http.StatusOK
+	}, 2*time.Second, 10*time.Millisecond)
+	require.NotNil(t, resp)
+	assert.Equal(t, "2.5", resp.String())
+
+	resp, err = resty.New().R().SetQueryParam("host", "b").Get(srv.URL + "/value/gauge/Alloc/")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode())
+
+	cancel()
+	assert.NoError(t, <-done)
+}
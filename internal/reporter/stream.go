@@ -0,0 +1,177 @@
+package reporter
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/soltanat/metrics/internal/client"
+	"github.com/soltanat/metrics/internal/logger"
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// maxStreamBatch
+// Максимальное количество метрик в пакете потока
+const maxStreamBatch = 100
+
+// maxPendingBatches
+// Максимальное количество неподтвержденных пакетов, при превышении самые старые пакеты отбрасываются,
+// чтобы память агента не росла, пока сервер недоступен
+const maxPendingBatches = 1000
+
+// Pusher
+// Клиент, открывающий поток отправки пакетов метрик, например client.GRPCClient
+type Pusher interface {
+	Push(ctx context.Context) (*client.PushStream, error)
+}
+
+// StreamReporter
+// Реализует интерфейс Reporter с отправкой метрик в потоке gRPC Push
+// Метрики отправляются сразу по мере поступления из канала, уже накопившиеся в канале метрики объединяются в пакет
+// Раз в интервал поток закрывается, чтобы получить подтверждения сохраненных пакетов,
+// неподтвержденные пакеты повторно отправляются в новом потоке
+type StreamReporter struct {
+	client Pusher
+	labels model.Labels
+}
+
+// NewStream
+// Создает StreamReporter
+// labels - метки, добавляемые ко всем отправляемым метрикам (например host, agent_id)
+func NewStream(client Pusher, labels model.Labels) *StreamReporter {
+	return &StreamReporter{client: client, labels: labels}
+}
+
+// RunReporter
+// Запускает StreamReporter
+// При завершении контекста закрывает поток и дожидается подтверждений
+func (r *StreamReporter) RunReporter(ctx context.Context, interval time.Duration, ch chan *model.Metric) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s := &pushSession{client: r.client, pending: make(map[uint64][]model.Metric)}
+	defer s.flush()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.flush()
+			s.resend()
+		case m, ok := <-ch:
+			if !ok {
+				return nil
+			}
+			batch := []model.Metric{r.labeled(m)}
+		drain:
+			for len(batch) < maxStreamBatch {
+				select {
+				case m, ok := <-ch:
+					if !ok {
+						break drain
+					}
+					batch = append(batch, r.labeled(m))
+				default:
+					break drain
+				}
+			}
+			s.send(batch)
+		}
+	}
+}
+
+func (r *StreamReporter) labeled(m *model.Metric) model.Metric {
+	m.Labels = m.Labels.Merge(r.labels)
+	return *m
+}
+
+// pushSession
+// Состояние отправки: текущий поток и отправленные, но не подтвержденные пакеты
+type pushSession struct {
+	client  Pusher
+	stream  *client.PushStream
+	nextID  uint64
+	pending map[uint64][]model.Metric
+}
+
+// send
+// Отправляет пакет в текущий поток, открывая его при необходимости
+// Если отправить не удалось, пакет остается неподтвержденным и будет отправлен повторно
+func (s *pushSession) send(batch []model.Metric) {
+	if len(s.pending) >= maxPendingBatches {
+		s.dropOldest()
+	}
+	s.nextID++
+	s.pending[s.nextID] = batch
+	s.sendPending(s.nextID)
+}
+
+// dropOldest
+// Отбрасывает самый старый неподтвержденный пакет
+func (s *pushSession) dropOldest() {
+	var oldest uint64
+	for id := range s.pending {
+		if oldest == 0 || id < oldest {
+			oldest = id
+		}
+	}
+	l := logger.Get()
+	l.Warn().Uint64("batch_id", oldest).Int("metrics", len(s.pending[oldest])).
+		Msg("too many pending batches, dropping oldest")
+	delete(s.pending, oldest)
+}
+
+func (s *pushSession) sendPending(id uint64) bool {
+	l := logger.Get()
+	if s.stream == nil {
+		stream, err := s.client.Push(context.Background())
+		if err != nil {
+			l.Error().Err(err).Msg("unable to open push stream")
+			return false
+		}
+		s.stream = stream
+	}
+	if err := s.stream.Send(id, s.pending[id]); err != nil {
+		l.Error().Err(err).Uint64("batch_id", id).Msg("unable to send batch")
+		s.flush()
+		return false
+	}
+	return true
+}
+
+// flush
+// Закрывает текущий поток и удаляет подтвержденные пакеты, в том числе подтвержденные до ошибки потока
+func (s *pushSession) flush() {
+	if s.stream == nil {
+		return
+	}
+	l := logger.Get()
+	committed, rejected, err := s.stream.Close()
+	s.stream = nil
+	if err != nil {
+		l.Error().Err(err).Int("pending", len(s.pending)-len(committed)-len(rejected)).Msg("unable to close push stream")
+	}
+	for _, id := range committed {
+		delete(s.pending, id)
+	}
+	for _, id := range rejected {
+		l.Error().Uint64("batch_id", id).Int("metrics", len(s.pending[id])).Msg("batch rejected by server")
+		delete(s.pending, id)
+	}
+}
+
+// resend
+// Повторно отправляет неподтвержденные пакеты в порядке отправки
+func (s *pushSession) resend() {
+	ids := make([]uint64, 0, len(s.pending))
+	for id := range s.pending {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if !s.sendPending(id) {
+			return
+		}
+	}
+}
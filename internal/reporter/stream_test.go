@@ -0,0 +1,99 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/soltanat/metrics/internal/client"
+	"github.com/soltanat/metrics/internal/grpcserver"
+	"github.com/soltanat/metrics/internal/model"
+	pb "github.com/soltanat/metrics/internal/proto"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+func TestStreamReporter_RunReporter(t *testing.T) {
+	var mu sync.Mutex
+	stored := make([]model.Metric, 0)
+
+	s := &storage.MockStorage{}
+	// первый пакет не сохраняется и должен быть отправлен повторно
+	s.On("StoreBatch", mock.Anything).Return(errors.New("db is down")).Once()
+	s.On("StoreBatch", mock.Anything).Run(func(args mock.Arguments) {
+		mu.Lock()
+		defer mu.Unlock()
+		stored = append(stored, args.Get(0).([]model.Metric)...)
+	}).Return(nil)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	pb.RegisterMetricsServer(server, grpcserver.New(s, nil))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+
+	cli, err := client.NewGRPC("bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}))
+	require.NoError(t, err)
+	defer cli.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan *model.Metric)
+	done := make(chan error)
+	r := NewStream(cli, model.Labels{"host": "a"})
+	go func() {
+		done <- r.RunReporter(ctx, 50*time.Millisecond, ch)
+	}()
+
+	ch <- model.NewCounter("PollCount", 1)
+	ch <- model.NewGauge("Alloc", 2)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(stored) == 2
+	}, 2*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+
+	counter := model.NewCounter("PollCount", 1)
+	counter.Labels = model.Labels{"host": "a"}
+	gauge := model.NewGauge("Alloc", 2)
+	gauge.Labels = model.Labels{"host": "a"}
+	assert.ElementsMatch(t, []model.Metric{*counter, *gauge}, stored)
+}
+
+type failingPusher struct{}
+
+func (failingPusher) Push(context.Context) (*client.PushStream, error) {
+	return nil, errors.New("connection refused")
+}
+
+func TestPushSession_PendingLimit(t *testing.T) {
+	s := &pushSession{client: failingPusher{}, pending: make(map[uint64][]model.Metric)}
+
+	for i := 0; i < maxPendingBatches+5; i++ {
+		s.send([]model.Metric{*model.NewCounter("PollCount", int64(i))})
+	}
+	s.resend()
+
+	assert.Len(t, s.pending, maxPendingBatches)
+	// отброшены самые старые пакеты
+	for id := uint64(1); id <= 5; id++ {
+		assert.NotContains(t, s.pending, id)
+	}
+	assert.Contains(t, s.pending, uint64(6))
+	assert.Contains(t, s.pending, uint64(maxPendingBatches+5))
+}
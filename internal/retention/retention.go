@@ -0,0 +1,83 @@
+// Package retention
+// Фоновое прореживание и удаление истории значений метрик
+package retention
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/soltanat/metrics/internal/logger"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+// Retention
+// Периодически применяет правила хранения к истории значений хранилища
+type Retention struct {
+	retainer storage.Retainer
+	rules    []storage.RetentionRule
+	interval time.Duration
+	stopCh   chan struct{}
+	closeCh  chan struct{}
+}
+
+// New
+// Инициализирует Retention
+// rules - правила хранения, interval - периодичность применения правил
+func New(retainer storage.Retainer, rules []storage.RetentionRule, interval time.Duration) *Retention {
+	return &Retention{
+		retainer: retainer,
+		rules:    rules,
+		interval: interval,
+		stopCh:   make(chan struct{}),
+		closeCh:  make(chan struct{}),
+	}
+}
+
+// Start
+// Применяет правила хранения и запускает их периодическое применение
+// Первое применение сразу при запуске переводит историю хранилища в режим хранения по правилам
+// (см. storage.MemStorage.ApplyRetention)
+func (r *Retention) Start() error {
+	if r.interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if len(r.rules) == 0 {
+		return fmt.Errorf("no retention rules")
+	}
+	r.apply()
+	go func() {
+		l := logger.Get()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.apply()
+			case <-r.stopCh:
+				r.closeCh <- struct{}{}
+				l.Info().Msg("retention stopped")
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *Retention) apply() {
+	l := logger.Get()
+	start := time.Now()
+	if err := r.retainer.ApplyRetention(r.rules, start); err != nil {
+		l.Error().Err(err).Msg("retention error")
+	} else {
+		l.Info().Dur("duration", time.Since(start)).Msg("retention applied")
+	}
+}
+
+// Stop
+// Останавливает периодическое применение правил хранения
+func (r *Retention) Stop() {
+	r.stopCh <- struct{}{}
+	<-r.closeCh
+}
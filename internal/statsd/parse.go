@@ -0,0 +1,98 @@
+// Package statsd
+// Прием метрик по протоколу StatsD через UDP
+package statsd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// Kind
+// Тип метрики StatsD
+type Kind string
+
+const (
+	// KindCounter счетчик: name:1|c
+	KindCounter Kind = "c"
+	// KindGauge значение: name:3.2|g, со знаком - изменение текущего значения: name:+1|g
+	KindGauge Kind = "g"
+	// KindTiming время выполнения в миллисекундах: name:320|ms, h - синоним
+	KindTiming Kind = "ms"
+)
+
+// Sample
+// Разобранная строка StatsD
+// Relative - значение gauge указано со знаком и изменяет текущее значение
+// Rate - доля отправленных значений (@0.1), 1 если не указана
+type Sample struct {
+	Name     string
+	Kind     Kind
+	Value    float64
+	Relative bool
+	Rate     float64
+	Labels   model.Labels
+}
+
+// Parse
+// Разбирает строку name:value|type[|@rate][|#tag:value,...]
+// Теги в формате DogStatsD становятся метками, теги без значения пропускаются
+func Parse(line string) (Sample, error) {
+	s := Sample{Rate: 1}
+
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return s, fmt.Errorf("invalid line %q: missing name", line)
+	}
+	s.Name = name
+
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return s, fmt.Errorf("invalid line %q: missing type", line)
+	}
+
+	switch kind := Kind(parts[1]); kind {
+	case KindCounter, KindGauge, KindTiming:
+		s.Kind = kind
+	case "h":
+		s.Kind = KindTiming
+	default:
+		return s, fmt.Errorf("invalid line %q: unsupported type %q", line, parts[1])
+	}
+
+	raw := parts[0]
+	s.Relative = s.Kind == KindGauge && (strings.HasPrefix(raw, "+") || strings.HasPrefix(raw, "-"))
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return s, fmt.Errorf("invalid line %q: invalid value %q", line, raw)
+	}
+	s.Value = value
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return s, fmt.Errorf("invalid line %q: invalid sample rate %q", line, part)
+			}
+			s.Rate = rate
+		case strings.HasPrefix(part, "#"):
+			for _, tag := range strings.Split(part[1:], ",") {
+				k, v, ok := strings.Cut(tag, ":")
+				if !ok || k == "" {
+					continue
+				}
+				if s.Labels == nil {
+					s.Labels = make(model.Labels)
+				}
+				s.Labels[k] = v
+			}
+		default:
+			return s, fmt.Errorf("invalid line %q: unexpected %q", line, part)
+		}
+	}
+	return s, nil
+}
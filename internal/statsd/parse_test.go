@@ -0,0 +1,58 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want Sample
+	}{
+		{name: "counter", line: "requests:1|c", want: Sample{Name: "requests", Kind: KindCounter, Value: 1, Rate: 1}},
+		{name: "sampled counter", line: "requests:2|c|@0.1", want: Sample{Name: "requests", Kind: KindCounter, Value: 2, Rate: 0.1}},
+		{name: "gauge", line: "temperature:3.2|g", want: Sample{Name: "temperature", Kind: KindGauge, Value: 3.2, Rate: 1}},
+		{name: "gauge increment", line: "queue:+4|g", want: Sample{Name: "queue", Kind: KindGauge, Value: 4, Relative: true, Rate: 1}},
+		{name: "gauge decrement", line: "queue:-1.5|g", want: Sample{Name: "queue", Kind: KindGauge, Value: -1.5, Relative: true, Rate: 1}},
+		{name: "timing", line: "latency:320|ms", want: Sample{Name: "latency", Kind: KindTiming, Value: 320, Rate: 1}},
+		{name: "histogram as timing", line: "latency:12|h|@0.5", want: Sample{Name: "latency", Kind: KindTiming, Value: 12, Rate: 0.5}},
+		{
+			name: "tags",
+			line: "requests:1|c|#host:a,env:prod,bare",
+			want: Sample{Name: "requests", Kind: KindCounter, Value: 1, Rate: 1, Labels: model.Labels{"host": "a", "env": "prod"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, line := range []string{
+		"requests",
+		":1|c",
+		"requests:1",
+		"requests:abc|c",
+		"requests:1|x",
+		"users:1|s",
+		"requests:1|c|@0",
+		"requests:1|c|@2",
+		"requests:1|c|oops",
+		"requests:NaN|g",
+	} {
+		t.Run(line, func(t *testing.T) {
+			_, err := Parse(line)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/soltanat/metrics/internal/logger"
+	"github.com/soltanat/metrics/internal/middleware/subnet"
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+// maxPacketSize
+// Максимальный размер UDP пакета
+const maxPacketSize = 65535
+
+// gaugeTTL
+// Время хранения последнего значения gauge, которое не обновлялось
+const gaugeTTL = time.Hour
+
+// timing
+// Значения времени выполнения за интервал
+type timing struct {
+	count float64
+	sum   float64
+	min   float64
+	max   float64
+}
+
+// series
+// Накопленное за интервал значение серии
+type series struct {
+	name    string
+	labels  model.Labels
+	counter float64
+	gauge   float64
+	timing  timing
+}
+
+// lastGauge
+// Последнее значение gauge, seen - время последнего изменения
+type lastGauge struct {
+	value float64
+	seen  time.Time
+}
+
+// Aggregator
+// Накапливает значения StatsD за интервал
+// Counter суммируется с учетом доли отправленных значений, для gauge сохраняется последнее значение,
+// для timing - количество, сумма, минимум и максимум
+// Последние значения gauge забываются, если gauge не обновлялся дольше часа,
+// после этого изменение со знаком применяется к нулю
+type Aggregator struct {
+	mu       sync.Mutex
+	counters map[string]*series
+	gauges   map[string]*series
+	timings  map[string]*series
+	// lastGauges последние значения gauge, к которым применяются изменения со знаком в следующих интервалах
+	lastGauges map[string]*lastGauge
+	lastSweep  time.Time
+	now        func() time.Time
+}
+
+// NewAggregator
+// Создает Aggregator
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		counters:   make(map[string]*series),
+		gauges:     make(map[string]*series),
+		timings:    make(map[string]*series),
+		lastGauges: make(map[string]*lastGauge),
+		now:        time.Now,
+	}
+}
+
+// Add
+// Добавляет значение в текущий интервал
+func (a *Aggregator) Add(s Sample) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := model.SeriesKey(s.Name, s.Labels)
+	switch s.Kind {
+	case KindCounter:
+		a.series(a.counters, key, s).counter += s.Value / s.Rate
+	case KindGauge:
+		value := s.Value
+		if last, ok := a.lastGauges[key]; ok && s.Relative {
+			value += last.value
+		}
+		a.lastGauges[key] = &lastGauge{value: value, seen: a.now()}
+		a.series(a.gauges, key, s).gauge = value
+	case KindTiming:
+		t := &a.series(a.timings, key, s).timing
+		if t.count == 0 || s.Value < t.min {
+			t.min = s.Value
+		}
+		if t.count == 0 || s.Value > t.max {
+			t.max = s.Value
+		}
+		t.count += 1 / s.Rate
+		t.sum += s.Value
+	}
+}
+
+func (a *Aggregator) series(m map[string]*series, key string, s Sample) *series {
+	v, ok := m[key]
+	if !ok {
+		v = &series{name: s.Name, labels: s.Labels}
+		m[key] = v
+	}
+	return v
+}
+
+// Flush
+// Возвращает метрики за интервал и начинает новый интервал
+// Counter сохраняется как counter с округленной суммой, gauge - как gauge,
+// timing - как gauge name_count, name_sum, name_min и name_max
+// Заодно удаляются последние значения gauge, которые не обновлялись дольше gaugeTTL
+func (a *Aggregator) Flush() []model.Metric {
+	a.mu.Lock()
+	counters, gauges, timings := a.counters, a.gauges, a.timings
+	a.counters = make(map[string]*series)
+	a.gauges = make(map[string]*series)
+	a.timings = make(map[string]*series)
+	if now := a.now(); now.Sub(a.lastSweep) > time.Minute {
+		for key, last := range a.lastGauges {
+			if now.Sub(last.seen) > gaugeTTL {
+				delete(a.lastGauges, key)
+			}
+		}
+		a.lastSweep = now
+	}
+	a.mu.Unlock()
+
+	metrics := make([]model.Metric, 0, len(counters)+len(gauges)+4*len(timings))
+	for _, s := range counters {
+		m := model.NewCounter(s.name, int64(math.Round(s.counter)))
+		m.Labels = s.labels
+		metrics = append(metrics, *m)
+	}
+	for _, s := range gauges {
+		m := model.NewGauge(s.name, s.gauge)
+		m.Labels = s.labels
+		metrics = append(metrics, *m)
+	}
+	for _, s := range timings {
+		for _, v := range []struct {
+			suffix string
+			value  float64
+		}{
+			{"_count", s.timing.count},
+			{"_sum", s.timing.sum},
+			{"_min", s.timing.min},
+			{"_max", s.timing.max},
+		} {
+			m := model.NewGauge(s.name+v.suffix, v.value)
+			m.Labels = s.labels
+			metrics = append(metrics, *m)
+		}
+	}
+	return metrics
+}
+
+// Restore
+// Возвращает в текущий интервал приращения counter из метрик Flush, которые не удалось сохранить
+// Gauge и timing не возвращаются: в следующих интервалах их заменяют новые значения
+func (a *Aggregator) Restore(metrics []model.Metric) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := range metrics {
+		m := &metrics[i]
+		if m.Type != model.MetricTypeCounter {
+			continue
+		}
+		s := Sample{Name: m.Name, Labels: m.Labels}
+		a.series(a.counters, m.Key(), s).counter += float64(m.Counter)
+	}
+}
+
+// Server
+// UDP сервер StatsD: принимает пакеты, накапливает значения и раз в интервал сохраняет их в хранилище
+type Server struct {
+	addr       string
+	storage    storage.Storage
+	interval   time.Duration
+	aggregator *Aggregator
+	trusted    *net.IPNet
+	conn       net.PacketConn
+	stopCh     chan struct{}
+	serveDone  chan struct{}
+	runDone    chan struct{}
+}
+
+// New
+// Инициализирует Server
+// addr - адрес UDP, interval - интервал накопления значений
+func New(addr string, s storage.Storage, interval time.Duration) *Server {
+	return &Server{
+		addr:       addr,
+		storage:    s,
+		interval:   interval,
+		aggregator: NewAggregator(),
+		stopCh:     make(chan struct{}),
+		serveDone:  make(chan struct{}),
+		runDone:    make(chan struct{}),
+	}
+}
+
+// WithTrustedSubnet
+// Принимать пакеты только от отправителей из доверенной подсети
+func (s *Server) WithTrustedSubnet(trusted *net.IPNet) *Server {
+	s.trusted = trusted
+	return s
+}
+
+// Addr
+// Возвращает адрес, на котором запущен сервер
+func (s *Server) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Start
+// Начинает прием пакетов и периодическое сохранение значений
+func (s *Server) Start() error {
+	if s.interval <= 0 {
+		return fmt.Errorf("flush interval must be positive")
+	}
+	conn, err := net.ListenPacket("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+
+	go s.serve()
+	go s.run()
+	return nil
+}
+
+// Stop
+// Останавливает прием пакетов и сохраняет накопленные значения, в том числе из уже принятых пакетов
+func (s *Server) Stop() {
+	_ = s.conn.Close()
+	<-s.serveDone
+	close(s.stopCh)
+	<-s.runDone
+}
+
+func (s *Server) serve() {
+	defer close(s.serveDone)
+	l := logger.Get()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			l.Error().Err(err).Msg("unable to read statsd packet")
+			continue
+		}
+		if !subnet.Contains(s.trusted, addr) {
+			l.Warn().Str("remote", addr.String()).Msg("statsd packet from untrusted address")
+			continue
+		}
+		s.handlePacket(buf[:n])
+	}
+}
+
+// handlePacket
+// Разбирает строки пакета, некорректные строки пропускаются
+func (s *Server) handlePacket(packet []byte) {
+	l := logger.Get()
+	for _, line := range strings.Split(string(packet), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sample, err := Parse(line)
+		if err != nil {
+			l.Error().Err(err).Msg("unable to parse statsd line")
+			continue
+		}
+		s.aggregator.Add(sample)
+	}
+}
+
+func (s *Server) run() {
+	defer close(s.runDone)
+	l := logger.Get()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.flush()
+		case <-s.stopCh:
+			s.flush()
+			l.Info().Msg("statsd stopped")
+			return
+		}
+	}
+}
+
+func (s *Server) flush() {
+	metrics := s.aggregator.Flush()
+	if len(metrics) == 0 {
+		return
+	}
+	if err := s.storage.StoreBatch(metrics); err != nil {
+		l := logger.Get()
+		l.Error().Err(err).Int("metrics", len(metrics)).Msg("unable to store statsd metrics")
+		s.aggregator.Restore(metrics)
+	}
+}
@@ -0,0 +1,154 @@
+package statsd
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/soltanat/metrics/internal/model"
+	"github.com/soltanat/metrics/internal/storage"
+)
+
+func add(t *testing.T, a *Aggregator, lines ...string) {
+	for _, line := range lines {
+		s, err := Parse(line)
+		require.NoError(t, err)
+		a.Add(s)
+	}
+}
+
+func TestAggregator(t *testing.T) {
+	a := NewAggregator()
+	add(t, a,
+		"requests:1|c",
+		"requests:2|c|@0.5",
+		"requests:1|c|#host:a",
+		"queue:10|g",
+		"queue:+5|g",
+		"queue:-3|g",
+		"latency:100|ms",
+		"latency:300|ms|@0.5",
+		"latency:200|ms",
+	)
+
+	assert.ElementsMatch(t, []model.Metric{
+		{Type: model.MetricTypeCounter, Name: "requests", Counter: 5},
+		{Type: model.MetricTypeCounter, Name: "requests", Counter: 1, Labels: model.Labels{"host": "a"}},
+		{Type: model.MetricTypeGauge, Name: "queue", Gauge: 12},
+		{Type: model.MetricTypeGauge, Name: "latency_count", Gauge: 4},
+		{Type: model.MetricTypeGauge, Name: "latency_sum", Gauge: 600},
+		{Type: model.MetricTypeGauge, Name: "latency_min", Gauge: 100},
+		{Type: model.MetricTypeGauge, Name: "latency_max", Gauge: 300},
+	}, a.Flush())
+
+	t.Run("next interval", func(t *testing.T) {
+		assert.Empty(t, a.Flush())
+
+		// изменение gauge применяется к значению из предыдущего интервала
+		add(t, a, "queue:+1|g")
+		assert.Equal(t, []model.Metric{{Type: model.MetricTypeGauge, Name: "queue", Gauge: 13}}, a.Flush())
+	})
+
+	t.Run("expired gauge", func(t *testing.T) {
+		now := time.Now()
+		a := NewAggregator()
+		a.now = func() time.Time { return now }
+		add(t, a, "queue:10|g")
+		a.Flush()
+		require.Len(t, a.lastGauges, 1)
+
+		// gauge не обновлялся дольше gaugeTTL, изменение применяется к нулю
+		now = now.Add(gaugeTTL + time.Minute)
+		a.Flush()
+		assert.Empty(t, a.lastGauges)
+		add(t, a, "queue:+1|g")
+		assert.Equal(t, []model.Metric{{Type: model.MetricTypeGauge, Name: "queue", Gauge: 1}}, a.Flush())
+	})
+}
+
+func TestServer_StoreError(t *testing.T) {
+	s := &storage.MockStorage{}
+	s.On("StoreBatch", mock.Anything).Return(errors.New("db is down")).Once()
+	var stored []model.Metric
+	s.On("StoreBatch", mock.Anything).Run(func(args mock.Arguments) {
+		stored = args.Get(0).([]model.Metric)
+	}).Return(nil).Once()
+
+	server := New("127.0.0.1:0", s, time.Hour)
+	add(t, server.aggregator, "requests:2|c|#host:a", "queue:10|g")
+	server.flush()
+
+	// приращение counter, которое не удалось сохранить, сохраняется вместе со следующим интервалом
+	add(t, server.aggregator, "requests:3|c|#host:a")
+	server.flush()
+
+	counter := model.NewCounter("requests", 5)
+	counter.Labels = model.Labels{"host": "a"}
+	assert.Equal(t, []model.Metric{*counter}, stored)
+	s.AssertExpectations(t)
+}
+
+func TestServer(t *testing.T) {
+	s := &storage.MockStorage{}
+	stored := make(chan []model.Metric, 10)
+	s.On("StoreBatch", mock.Anything).Run(func(args mock.Arguments) {
+		stored <- args.Get(0).([]model.Metric)
+	}).Return(nil)
+
+	server := New("127.0.0.1:0", s, time.Hour)
+	require.NoError(t, server.Start())
+
+	conn, err := net.Dial("udp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("requests:1|c\nbroken\nrequests:2|c\ntemperature:21.5|g\n"))
+	require.NoError(t, err)
+
+	// пакет принимается асинхронно, Stop сохраняет все принятые значения
+	require.Eventually(t, func() bool {
+		server.aggregator.mu.Lock()
+		defer server.aggregator.mu.Unlock()
+		return len(server.aggregator.gauges) == 1
+	}, time.Second, 10*time.Millisecond)
+	server.Stop()
+
+	select {
+	case metrics := <-stored:
+		assert.ElementsMatch(t, []model.Metric{
+			{Type: model.MetricTypeCounter, Name: "requests", Counter: 3},
+			{Type: model.MetricTypeGauge, Name: "temperature", Gauge: 21.5},
+		}, metrics)
+	default:
+		t.Fatal("metrics are not stored on stop")
+	}
+}
+
+func TestServer_TrustedSubnet(t *testing.T) {
+	s := &storage.MockStorage{}
+	_, trusted, err := net.ParseCIDR("10.0.0.0/8")
+	require.NoError(t, err)
+
+	server := New("127.0.0.1:0", s, time.Hour).WithTrustedSubnet(trusted)
+	require.NoError(t, server.Start())
+
+	conn, err := net.Dial("udp", server.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("temperature:21.5|g\n"))
+	require.NoError(t, err)
+
+	// пакет с адреса вне доверенной подсети отбрасывается
+	require.Never(t, func() bool {
+		server.aggregator.mu.Lock()
+		defer server.aggregator.mu.Unlock()
+		return len(server.aggregator.gauges) > 0
+	}, 200*time.Millisecond, 10*time.Millisecond)
+	server.Stop()
+
+	s.AssertNotCalled(t, "StoreBatch", mock.Anything)
+}
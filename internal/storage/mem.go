@@ -2,29 +2,59 @@ package storage
 
 import (
 	"sync"
+	"time"
 
 	"github.com/soltanat/metrics/internal/model"
 )
 
+// defaultHistorySize
+// Количество точек, хранимых для каждой серии
+const defaultHistorySize = 1024
+
 // MemStorage
 // Реализует хранилище метрик в памяти
+// Значения хранятся по ключу серии (model.SeriesKey), для серий с метками
+// имя и метки сохраняются в series
+// История значений каждой серии хранится в кольцевом буфере ограниченного размера,
+// при заданных правилах хранения (ApplyRetention) размер буфера ограничен сроком хранения исходных точек
 type MemStorage struct {
-	gauge   map[string]float64
-	counter map[string]int64
-	mu      *sync.RWMutex
+	gauge          map[string]float64
+	counter        map[string]int64
+	histogram      map[string]*model.Histogram
+	summary        map[string]*model.Summary
+	series         map[string]series
+	gaugeHistory   map[string]*history
+	counterHistory map[string]*history
+	historySize    int
+	// growHistory буферы истории расширяются вместо перезаписи, устанавливается при применении правил хранения
+	growHistory bool
+	mu          *sync.RWMutex
+}
+
+// series
+// Имя и метки серии
+type series struct {
+	name   string
+	labels model.Labels
 }
 
 func NewMemStorage() *MemStorage {
 	return &MemStorage{
-		gauge:   make(map[string]float64),
-		counter: make(map[string]int64),
-		mu:      &sync.RWMutex{},
+		gauge:          make(map[string]float64),
+		counter:        make(map[string]int64),
+		histogram:      make(map[string]*model.Histogram),
+		summary:        make(map[string]*model.Summary),
+		series:         make(map[string]series),
+		gaugeHistory:   make(map[string]*history),
+		counterHistory: make(map[string]*history),
+		historySize:    defaultHistorySize,
+		mu:             &sync.RWMutex{},
 	}
 }
 
 // Store
 // Сохраняет метрику
-// Для counter добавляет значение, для gauge заменяет значение
+// Для counter добавляет значение, для gauge заменяет значение, для histogram и summary объединяет наблюдения
 func (s *MemStorage) Store(metric *model.Metric) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -33,7 +63,7 @@ func (s *MemStorage) Store(metric *model.Metric) error {
 
 // StoreBatch
 // Сохраняет слайс метрик
-// Для counter добавляет значения, для gauge заменяет значения
+// Для counter добавляет значения, для gauge заменяет значения, для histogram и summary объединяет наблюдения
 func (s *MemStorage) StoreBatch(metrics []model.Metric) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -46,50 +76,193 @@ func (s *MemStorage) StoreBatch(metrics []model.Metric) error {
 }
 
 func (s *MemStorage) store(metric *model.Metric) error {
+	key := metric.Key()
+	now := time.Now()
 	switch metric.Type {
 	case model.MetricTypeCounter:
-		s.counter[metric.Name] += metric.Counter
+		s.counter[key] += metric.Counter
+		s.record(s.counterHistory, key, model.Point{Timestamp: now, Value: float64(s.counter[key])})
 	case model.MetricTypeGauge:
-		s.gauge[metric.Name] = metric.Gauge
+		s.gauge[key] = metric.Gauge
+		s.record(s.gaugeHistory, key, model.Point{Timestamp: now, Value: metric.Gauge})
+	case model.MetricTypeHistogram:
+		if metric.Histogram == nil {
+			return model.ErrInvalidHistogram
+		}
+		h, ok := s.histogram[key]
+		if !ok {
+			s.histogram[key] = metric.Histogram.Clone()
+			break
+		}
+		if err := h.Merge(metric.Histogram); err != nil {
+			return err
+		}
+	case model.MetricTypeSummary:
+		if metric.Summary == nil {
+			return model.ErrInvalidSummary
+		}
+		sm, ok := s.summary[key]
+		if !ok {
+			s.summary[key] = metric.Summary.Clone()
+			break
+		}
+		if err := sm.Merge(metric.Summary); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	if len(metric.Labels) > 0 {
+		if _, ok := s.series[key]; !ok {
+			s.series[key] = series{name: metric.Name, labels: metric.Labels.Merge(nil)}
+		}
 	}
 	return nil
 }
 
+// record
+// Добавляет точку в историю серии
+func (s *MemStorage) record(histories map[string]*history, key string, p model.Point) {
+	if histories == nil {
+		return
+	}
+	h, ok := histories[key]
+	if !ok {
+		h = newHistory(s.historySize)
+		h.raw.grow = s.growHistory
+		histories[key] = h
+	}
+	h.raw.push(p)
+}
+
+// lookup
+// Возвращает имя и метки серии по ключу
+func (s *MemStorage) lookup(key string) (string, model.Labels) {
+	if sr, ok := s.series[key]; ok {
+		return sr.name, sr.labels.Merge(nil)
+	}
+	return key, nil
+}
+
 // GetGauge
-// Возвращает метрику gauge по имени
-func (s *MemStorage) GetGauge(name string) (*model.Metric, error) {
+// Возвращает метрику gauge по имени и меткам
+func (s *MemStorage) GetGauge(name string, labels model.Labels) (*model.Metric, error) {
 	s.mu.RLock()
-	v, ok := s.gauge[name]
+	v, ok := s.gauge[model.SeriesKey(name, labels)]
 	s.mu.RUnlock()
 	if !ok {
 		return nil, model.ErrMetricNotFound
 	}
-	return model.NewGauge(name, v), nil
+	m := model.NewGauge(name, v)
+	m.Labels = labels.Merge(nil)
+	return m, nil
 }
 
 // GetCounter
-// Возвращает метрику counter по имени
-func (s *MemStorage) GetCounter(name string) (*model.Metric, error) {
+// Возвращает метрику counter по имени и меткам
+func (s *MemStorage) GetCounter(name string, labels model.Labels) (*model.Metric, error) {
 	s.mu.RLock()
-	v, ok := s.counter[name]
+	v, ok := s.counter[model.SeriesKey(name, labels)]
 	s.mu.RUnlock()
 	if !ok {
 		return nil, model.ErrMetricNotFound
 	}
-	return model.NewCounter(name, v), nil
+	m := model.NewCounter(name, v)
+	m.Labels = labels.Merge(nil)
+	return m, nil
+}
+
+// GetHistogram
+// Возвращает метрику histogram по имени и меткам
+func (s *MemStorage) GetHistogram(name string, labels model.Labels) (*model.Metric, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := s.histogram[model.SeriesKey(name, labels)]
+	if !ok {
+		return nil, model.ErrMetricNotFound
+	}
+	return &model.Metric{
+		Type:      model.MetricTypeHistogram,
+		Name:      name,
+		Histogram: h.Clone(),
+		Labels:    labels.Merge(nil),
+	}, nil
+}
+
+// GetSummary
+// Возвращает метрику summary по имени и меткам
+func (s *MemStorage) GetSummary(name string, labels model.Labels) (*model.Metric, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sm, ok := s.summary[model.SeriesKey(name, labels)]
+	if !ok {
+		return nil, model.ErrMetricNotFound
+	}
+	return &model.Metric{
+		Type:    model.MetricTypeSummary,
+		Name:    name,
+		Summary: sm.Clone(),
+		Labels:  labels.Merge(nil),
+	}, nil
 }
 
 // GetList
 // Возвращает все метрики в виде слайса
 func (s *MemStorage) GetList() ([]model.Metric, error) {
 	s.mu.RLock()
-	metrics := make([]model.Metric, 0, len(s.counter)+len(s.gauge))
+	metrics := make([]model.Metric, 0, len(s.counter)+len(s.gauge)+len(s.histogram)+len(s.summary))
 	for k, v := range s.counter {
-		metrics = append(metrics, *model.NewCounter(k, v))
+		name, labels := s.lookup(k)
+		m := model.NewCounter(name, v)
+		m.Labels = labels
+		metrics = append(metrics, *m)
 	}
 	for k, v := range s.gauge {
-		metrics = append(metrics, *model.NewGauge(k, v))
+		name, labels := s.lookup(k)
+		m := model.NewGauge(name, v)
+		m.Labels = labels
+		metrics = append(metrics, *m)
+	}
+	for k, v := range s.histogram {
+		name, labels := s.lookup(k)
+		metrics = append(metrics, model.Metric{
+			Type:      model.MetricTypeHistogram,
+			Name:      name,
+			Histogram: v.Clone(),
+			Labels:    labels,
+		})
+	}
+	for k, v := range s.summary {
+		name, labels := s.lookup(k)
+		metrics = append(metrics, model.Metric{
+			Type:    model.MetricTypeSummary,
+			Name:    name,
+			Summary: v.Clone(),
+			Labels:  labels,
+		})
 	}
 	s.mu.RUnlock()
 	return metrics, nil
 }
+
+// GetSeries
+// Возвращает точки серии в интервале [from, to]
+func (s *MemStorage) GetSeries(metricType model.MetricType, name string, labels model.Labels, from, to time.Time) ([]model.Point, error) {
+	var histories map[string]*history
+	switch metricType {
+	case model.MetricTypeGauge:
+		histories = s.gaugeHistory
+	case model.MetricTypeCounter:
+		histories = s.counterHistory
+	default:
+		return nil, model.ErrInvalidMetricType
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	h, ok := histories[model.SeriesKey(name, labels)]
+	if !ok {
+		return []model.Point{}, nil
+	}
+	return h.rangeOf(from, to), nil
+}
@@ -5,6 +5,7 @@ import (
 	"reflect"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -19,9 +20,15 @@ func TestNewMemStorage(t *testing.T) {
 		{
 			"success new",
 			&MemStorage{
-				gauge:   make(map[string]float64),
-				counter: make(map[string]int64),
-				mu:      &sync.RWMutex{},
+				gauge:          make(map[string]float64),
+				counter:        make(map[string]int64),
+				histogram:      make(map[string]*model.Histogram),
+				summary:        make(map[string]*model.Summary),
+				series:         make(map[string]series),
+				gaugeHistory:   make(map[string]*history),
+				counterHistory: make(map[string]*history),
+				historySize:    defaultHistorySize,
+				mu:             &sync.RWMutex{},
 			},
 		},
 	}
@@ -82,7 +89,7 @@ func TestMemStorage_GetCounter(t *testing.T) {
 				counter: tt.fields.counter,
 				mu:      tt.fields.mu,
 			}
-			got, err := s.GetCounter(tt.args.name)
+			got, err := s.GetCounter(tt.args.name, nil)
 			if !tt.wantErr(t, err, fmt.Sprintf("GetCounter(%v)", tt.args.name)) {
 				return
 			}
@@ -139,7 +146,7 @@ func TestMemStorage_GetGauge(t *testing.T) {
 				counter: tt.fields.counter,
 				mu:      tt.fields.mu,
 			}
-			got, err := s.GetGauge(tt.args.name)
+			got, err := s.GetGauge(tt.args.name, nil)
 			if !tt.wantErr(t, err, fmt.Sprintf("GetGauge(%v)", tt.args.name)) {
 				return
 			}
@@ -259,3 +266,106 @@ func TestMemStorage_Store(t *testing.T) {
 		})
 	}
 }
+
+func TestMemStorage_Labels(t *testing.T) {
+	s := NewMemStorage()
+
+	hostA := model.Labels{"host": "a"}
+	hostB := model.Labels{"host": "b"}
+
+	gaugeA := model.NewGauge("HeapAlloc", 1)
+	gaugeA.Labels = hostA
+	gaugeB := model.NewGauge("HeapAlloc", 2)
+	gaugeB.Labels = hostB
+	counterA := model.NewCounter("PollCount", 1)
+	counterA.Labels = hostA
+
+	assert.NoError(t, s.StoreBatch([]model.Metric{*gaugeA, *gaugeB, *counterA, *counterA}))
+
+	got, err := s.GetGauge("HeapAlloc", hostA)
+	assert.NoError(t, err)
+	assert.Equal(t, gaugeA, got)
+
+	got, err = s.GetGauge("HeapAlloc", model.Labels{"host": "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, gaugeB, got)
+
+	got, err = s.GetCounter("PollCount", hostA)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), got.Counter)
+
+	_, err = s.GetGauge("HeapAlloc", nil)
+	assert.ErrorIs(t, err, model.ErrMetricNotFound)
+
+	list, err := s.GetList()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []model.Metric{
+		{Type: model.MetricTypeGauge, Name: "HeapAlloc", Gauge: 1, Labels: hostA},
+		{Type: model.MetricTypeGauge, Name: "HeapAlloc", Gauge: 2, Labels: hostB},
+		{Type: model.MetricTypeCounter, Name: "PollCount", Counter: 2, Labels: hostA},
+	}, list)
+}
+
+func TestMemStorage_GetSeries(t *testing.T) {
+	s := NewMemStorage()
+	s.historySize = 3
+
+	start := time.Now()
+	for i := 1; i <= 5; i++ {
+		assert.NoError(t, s.Store(model.NewGauge("gauge", float64(i))))
+		assert.NoError(t, s.Store(model.NewCounter("counter", 1)))
+	}
+	end := time.Now()
+
+	values := func(points []model.Point) []float64 {
+		v := make([]float64, 0, len(points))
+		for _, p := range points {
+			v = append(v, p.Value)
+		}
+		return v
+	}
+
+	points, err := s.GetSeries(model.MetricTypeGauge, "gauge", nil, start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{3, 4, 5}, values(points))
+
+	points, err = s.GetSeries(model.MetricTypeCounter, "counter", nil, start, end)
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{3, 4, 5}, values(points))
+
+	points, err = s.GetSeries(model.MetricTypeGauge, "gauge", nil, end.Add(time.Second), end.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Empty(t, points)
+
+	points, err = s.GetSeries(model.MetricTypeGauge, "unknown", nil, start, end)
+	assert.NoError(t, err)
+	assert.Empty(t, points)
+}
+
+func TestMemStorage_Histogram(t *testing.T) {
+	s := NewMemStorage()
+
+	first := model.NewHistogram("latency", []float64{0.1, 1})
+	first.Histogram.Observe(0.05)
+	first.Histogram.Observe(0.5)
+	second := model.NewHistogram("latency", []float64{0.1, 1})
+	second.Histogram.Observe(5)
+
+	assert.NoError(t, s.Store(first))
+	assert.NoError(t, s.StoreBatch([]model.Metric{*second}))
+
+	got, err := s.GetHistogram("latency", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.Histogram{
+		Buckets: []float64{0.1, 1},
+		Counts:  []int64{1, 1, 1},
+		Sum:     5.55,
+		Count:   3,
+	}, got.Histogram)
+
+	mismatch := model.NewHistogram("latency", []float64{1, 10})
+	assert.ErrorIs(t, s.Store(mismatch), model.ErrHistogramBucketsMismatch)
+
+	_, err = s.GetHistogram("unknown", nil)
+	assert.ErrorIs(t, err, model.ErrMetricNotFound)
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 
@@ -11,6 +12,31 @@ import (
 	"github.com/soltanat/metrics/internal/model"
 )
 
+// Запросы обновляют текущее значение серии и записывают полученное значение в историю
+const (
+	gaugeUpsertQuery = `WITH m AS (
+		INSERT INTO metrics.metrics_gauge (name, labels, value) VALUES ($1, $2, $3)
+		ON CONFLICT (name, labels) DO UPDATE SET value = $3
+		RETURNING name, labels, value
+	)
+	INSERT INTO metrics.metrics_gauge_history (name, labels, value) SELECT name, labels, value FROM m`
+	counterUpsertQuery = `WITH m AS (
+		INSERT INTO metrics.metrics_counter (name, labels, value) VALUES ($1, $2, $3)
+		ON CONFLICT (name, labels) DO UPDATE SET value = metrics_counter.value + $3
+		RETURNING name, labels, value
+	)
+	INSERT INTO metrics.metrics_counter_history (name, labels, value) SELECT name, labels, value FROM m`
+	histogramUpsertQuery = `INSERT INTO metrics.metrics_histogram (name, labels, buckets, counts, sum, count)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name, labels) DO UPDATE SET
+			counts = ARRAY(
+				SELECT a + b FROM unnest(metrics_histogram.counts, EXCLUDED.counts) WITH ORDINALITY AS t(a, b, i) ORDER BY i
+			),
+			sum = metrics_histogram.sum + EXCLUDED.sum,
+			count = metrics_histogram.count + EXCLUDED.count
+		WHERE metrics_histogram.buckets = EXCLUDED.buckets`
+)
+
 // PostgresStorage
 // Реализует хранилище метрик в PostgreSQL
 type PostgresStorage struct {
@@ -23,31 +49,39 @@ func NewPostgresStorage(conn *pgxpool.Pool) *PostgresStorage {
 
 // Store
 // Сохраняет метрику
-// Для counter добавляет значение, для gauge заменяет значение
+// Для counter добавляет значение, для gauge заменяет значение, для histogram и summary объединяет наблюдения
 func (s *PostgresStorage) Store(metric *model.Metric) error {
-	if metric.Type == model.MetricTypeCounter {
-		_, err := s.conn.Exec(
-			context.Background(),
-			`INSERT INTO metrics.metrics_counter (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = metrics_counter.value + $2`, metric.Name, metric.Counter,
-		)
+	if metric.Type == model.MetricTypeSummary {
+		ctx := context.Background()
+		tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
 		if err != nil {
 			return err
 		}
-	} else if metric.Type == model.MetricTypeGauge {
-		_, err := s.conn.Exec(
-			context.Background(),
-			"INSERT INTO metrics.metrics_gauge (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = $2", metric.Name, metric.Gauge,
-		)
-		if err != nil {
+		if err := storeSummary(ctx, tx, metric); err != nil {
+			_ = tx.Rollback(ctx)
 			return err
 		}
+		return tx.Commit(ctx)
+	}
+
+	query, args, err := upsertQuery(metric)
+	if err != nil || query == "" {
+		return err
+	}
+
+	tag, err := s.conn.Exec(context.Background(), query, args...)
+	if err != nil {
+		return err
+	}
+	if metric.Type == model.MetricTypeHistogram && tag.RowsAffected() == 0 {
+		return model.ErrHistogramBucketsMismatch
 	}
 	return nil
 }
 
 // StoreBatch
-// Сохраняет слайс метрик в транзакции
-// Для counter добавляет значения, для gauge заменяет значения
+// Сохраняет слайс метрик в транзакции
+// Для counter добавляет значения, для gauge заменяет значения, для histogram и summary объединяет наблюдения
 func (s *PostgresStorage) StoreBatch(metrics []model.Metric) error {
 	ctx := context.Background()
 	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
@@ -56,25 +90,37 @@ func (s *PostgresStorage) StoreBatch(metrics []model.Metric) error {
 	}
 
 	batch := &pgx.Batch{}
-	for _, m := range metrics {
-		if m.Type == model.MetricTypeGauge {
-			batch.Queue(`INSERT INTO metrics.metrics_gauge (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = $2`, m.Name, m.Gauge)
-		} else if m.Type == model.MetricTypeCounter {
-			batch.Queue(`INSERT INTO metrics.metrics_counter (name, value) VALUES ($1, $2) ON CONFLICT (name) DO UPDATE SET value = metrics_counter.value + $2`, m.Name, m.Counter)
+	types := make([]model.MetricType, 0, len(metrics))
+	for i := range metrics {
+		if metrics[i].Type == model.MetricTypeSummary {
+			if err := storeSummary(ctx, tx, &metrics[i]); err != nil {
+				_ = tx.Rollback(ctx)
+				return err
+			}
+			continue
+		}
+		query, args, err := upsertQuery(&metrics[i])
+		if err != nil {
+			_ = tx.Rollback(ctx)
+			return err
 		}
+		if query == "" {
+			continue
+		}
+		batch.Queue(query, args...)
+		types = append(types, metrics[i].Type)
 		if batch.Len() > 1000 {
-			br := tx.SendBatch(ctx, batch)
-			err = br.Close()
+			err = sendBatch(ctx, tx, batch, types)
 			if err != nil {
 				_ = tx.Rollback(ctx)
 				return err
 			}
 			batch = &pgx.Batch{}
+			types = types[:0]
 		}
 	}
 
-	br := tx.SendBatch(ctx, batch)
-	err = br.Close()
+	err = sendBatch(ctx, tx, batch, types)
 	if err != nil {
 		_ = tx.Rollback(ctx)
 		return err
@@ -88,11 +134,88 @@ func (s *PostgresStorage) StoreBatch(metrics []model.Metric) error {
 	return nil
 }
 
+// upsertQuery
+// Возвращает запрос и аргументы для сохранения метрики
+// Для неизвестного типа возвращает пустой запрос
+func upsertQuery(m *model.Metric) (string, []any, error) {
+	switch m.Type {
+	case model.MetricTypeGauge:
+		return gaugeUpsertQuery, []any{m.Name, dbLabels(m.Labels), m.Gauge}, nil
+	case model.MetricTypeCounter:
+		return counterUpsertQuery, []any{m.Name, dbLabels(m.Labels), m.Counter}, nil
+	case model.MetricTypeHistogram:
+		if m.Histogram == nil {
+			return "", nil, model.ErrInvalidHistogram
+		}
+		h := m.Histogram
+		return histogramUpsertQuery, []any{m.Name, dbLabels(m.Labels), h.Buckets, h.Counts, h.Sum, h.Count}, nil
+	}
+	return "", nil, nil
+}
+
+// storeSummary
+// Объединяет скетч summary с сохраненным в транзакции
+// Строка блокируется на время объединения, чтобы параллельные запросы не потеряли наблюдения
+func storeSummary(ctx context.Context, tx pgx.Tx, m *model.Metric) error {
+	if m.Summary == nil {
+		return model.ErrInvalidSummary
+	}
+	labels := dbLabels(m.Labels)
+
+	_, err := tx.Exec(ctx,
+		"INSERT INTO metrics.metrics_summary (name, labels, sketch) VALUES ($1, $2, $3) ON CONFLICT (name, labels) DO NOTHING",
+		m.Name, labels, &model.Summary{Accuracy: m.Summary.Accuracy},
+	)
+	if err != nil {
+		return err
+	}
+
+	sketch := &model.Summary{}
+	err = tx.QueryRow(ctx,
+		"SELECT sketch FROM metrics.metrics_summary WHERE name = $1 AND labels = $2 FOR UPDATE",
+		m.Name, labels,
+	).Scan(sketch)
+	if err != nil {
+		return err
+	}
+	if err := sketch.Merge(m.Summary); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx,
+		"UPDATE metrics.metrics_summary SET sketch = $3 WHERE name = $1 AND labels = $2",
+		m.Name, labels, sketch,
+	)
+	return err
+}
+
+// sendBatch
+// Выполняет пакет запросов в транзакции
+// Для histogram проверяет, что запись обновлена, иначе границы бакетов не совпали
+func sendBatch(ctx context.Context, tx pgx.Tx, batch *pgx.Batch, types []model.MetricType) error {
+	br := tx.SendBatch(ctx, batch)
+	for _, t := range types {
+		tag, err := br.Exec()
+		if err != nil {
+			_ = br.Close()
+			return err
+		}
+		if t == model.MetricTypeHistogram && tag.RowsAffected() == 0 {
+			_ = br.Close()
+			return model.ErrHistogramBucketsMismatch
+		}
+	}
+	return br.Close()
+}
+
 // GetGauge
-// Возвращает метрику gauge по имени
+// Возвращает метрику gauge по имени и меткам
 // Если метрики нет, возвращает ошибку model.ErrMetricNotFound
-func (s *PostgresStorage) GetGauge(name string) (*model.Metric, error) {
-	row := s.conn.QueryRow(context.Background(), "SELECT value FROM metrics.metrics_gauge WHERE name = $1", name)
+func (s *PostgresStorage) GetGauge(name string, labels model.Labels) (*model.Metric, error) {
+	row := s.conn.QueryRow(
+		context.Background(),
+		"SELECT value FROM metrics.metrics_gauge WHERE name = $1 AND labels = $2", name, dbLabels(labels),
+	)
 	var v float64
 	err := row.Scan(&v)
 	if err != nil {
@@ -101,14 +224,19 @@ func (s *PostgresStorage) GetGauge(name string) (*model.Metric, error) {
 		}
 		return nil, err
 	}
-	return model.NewGauge(name, v), nil
+	m := model.NewGauge(name, v)
+	m.Labels = labels.Merge(nil)
+	return m, nil
 }
 
 // GetCounter
-// Возвращает метрику counter по имени
+// Возвращает метрику counter по имени и меткам
 // Если метрики нет, возвращает ошибку model.ErrMetricNotFound
-func (s *PostgresStorage) GetCounter(name string) (*model.Metric, error) {
-	row := s.conn.QueryRow(context.Background(), "SELECT value FROM metrics.metrics_counter WHERE name = $1", name)
+func (s *PostgresStorage) GetCounter(name string, labels model.Labels) (*model.Metric, error) {
+	row := s.conn.QueryRow(
+		context.Background(),
+		"SELECT value FROM metrics.metrics_counter WHERE name = $1 AND labels = $2", name, dbLabels(labels),
+	)
 	var v int64
 	err := row.Scan(&v)
 	if err != nil {
@@ -117,13 +245,63 @@ func (s *PostgresStorage) GetCounter(name string) (*model.Metric, error) {
 		}
 		return nil, err
 	}
-	return model.NewCounter(name, v), nil
+	m := model.NewCounter(name, v)
+	m.Labels = labels.Merge(nil)
+	return m, nil
+}
+
+// GetHistogram
+// Возвращает метрику histogram по имени и меткам
+// Если метрики нет, возвращает ошибку model.ErrMetricNotFound
+func (s *PostgresStorage) GetHistogram(name string, labels model.Labels) (*model.Metric, error) {
+	row := s.conn.QueryRow(
+		context.Background(),
+		"SELECT buckets, counts, sum, count FROM metrics.metrics_histogram WHERE name = $1 AND labels = $2", name, dbLabels(labels),
+	)
+	h := &model.Histogram{}
+	err := row.Scan(&h.Buckets, &h.Counts, &h.Sum, &h.Count)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrMetricNotFound
+		}
+		return nil, err
+	}
+	return &model.Metric{
+		Type:      model.MetricTypeHistogram,
+		Name:      name,
+		Histogram: h,
+		Labels:    labels.Merge(nil),
+	}, nil
+}
+
+// GetSummary
+// Возвращает метрику summary по имени и меткам
+// Если метрики нет, возвращает ошибку model.ErrMetricNotFound
+func (s *PostgresStorage) GetSummary(name string, labels model.Labels) (*model.Metric, error) {
+	row := s.conn.QueryRow(
+		context.Background(),
+		"SELECT sketch FROM metrics.metrics_summary WHERE name = $1 AND labels = $2", name, dbLabels(labels),
+	)
+	sketch := &model.Summary{}
+	err := row.Scan(sketch)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, model.ErrMetricNotFound
+		}
+		return nil, err
+	}
+	return &model.Metric{
+		Type:    model.MetricTypeSummary,
+		Name:    name,
+		Summary: sketch,
+		Labels:  labels.Merge(nil),
+	}, nil
 }
 
 // GetList
 // Возвращает слайс метрик
 func (s *PostgresStorage) GetList() ([]model.Metric, error) {
-	row, err := s.conn.Query(context.Background(), "SELECT name, value FROM metrics.metrics_gauge")
+	row, err := s.conn.Query(context.Background(), "SELECT name, labels, value FROM metrics.metrics_gauge")
 	if err != nil {
 		return nil, err
 	}
@@ -131,28 +309,186 @@ func (s *PostgresStorage) GetList() ([]model.Metric, error) {
 	metrics := make([]model.Metric, 0)
 	for row.Next() {
 		var name string
+		var labels model.Labels
 		var v float64
-		err = row.Scan(&name, &v)
+		err = row.Scan(&name, &labels, &v)
 		if err != nil {
 			return nil, err
 		}
-		metrics = append(metrics, *model.NewGauge(name, v))
+		m := model.NewGauge(name, v)
+		m.Labels = labels.Merge(nil)
+		metrics = append(metrics, *m)
 	}
 
-	row, err = s.conn.Query(context.Background(), "SELECT name, value FROM metrics.metrics_counter")
+	row, err = s.conn.Query(context.Background(), "SELECT name, labels, value FROM metrics.metrics_counter")
 	if err != nil {
 		return nil, err
 	}
 	defer row.Close()
 	for row.Next() {
 		var name string
+		var labels model.Labels
 		var v int64
-		err = row.Scan(&name, &v)
+		err = row.Scan(&name, &labels, &v)
+		if err != nil {
+			return nil, err
+		}
+		m := model.NewCounter(name, v)
+		m.Labels = labels.Merge(nil)
+		metrics = append(metrics, *m)
+	}
+
+	row, err = s.conn.Query(context.Background(), "SELECT name, labels, buckets, counts, sum, count FROM metrics.metrics_histogram")
+	if err != nil {
+		return nil, err
+	}
+	defer row.Close()
+	for row.Next() {
+		var name string
+		var labels model.Labels
+		h := &model.Histogram{}
+		err = row.Scan(&name, &labels, &h.Buckets, &h.Counts, &h.Sum, &h.Count)
 		if err != nil {
 			return nil, err
 		}
-		metrics = append(metrics, *model.NewCounter(name, v))
+		metrics = append(metrics, model.Metric{
+			Type:      model.MetricTypeHistogram,
+			Name:      name,
+			Histogram: h,
+			Labels:    labels.Merge(nil),
+		})
+	}
+
+	row, err = s.conn.Query(context.Background(), "SELECT name, labels, sketch FROM metrics.metrics_summary")
+	if err != nil {
+		return nil, err
+	}
+	defer row.Close()
+	for row.Next() {
+		var name string
+		var labels model.Labels
+		sketch := &model.Summary{}
+		err = row.Scan(&name, &labels, sketch)
+		if err != nil {
+			return nil, err
+		}
+		metrics = append(metrics, model.Metric{
+			Type:    model.MetricTypeSummary,
+			Name:    name,
+			Summary: sketch,
+			Labels:  labels.Merge(nil),
+		})
 	}
 
 	return metrics, nil
 }
+
+// GetSeries
+// Возвращает точки серии из истории в интервале [from, to]
+func (s *PostgresStorage) GetSeries(
+	metricType model.MetricType, name string, labels model.Labels, from, to time.Time,
+) ([]model.Point, error) {
+	var query string
+	switch metricType {
+	case model.MetricTypeGauge:
+		query = "SELECT value, created_at FROM metrics.metrics_gauge_history WHERE name = $1 AND labels = $2 AND created_at BETWEEN $3 AND $4 ORDER BY created_at"
+	case model.MetricTypeCounter:
+		query = "SELECT value::DOUBLE PRECISION, created_at FROM metrics.metrics_counter_history WHERE name = $1 AND labels = $2 AND created_at BETWEEN $3 AND $4 ORDER BY created_at"
+	default:
+		return nil, model.ErrInvalidMetricType
+	}
+
+	rows, err := s.conn.Query(context.Background(), query, name, dbLabels(labels), from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	points := make([]model.Point, 0)
+	for rows.Next() {
+		var p model.Point
+		if err := rows.Scan(&p.Value, &p.Timestamp); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
+// dbLabels
+// Возвращает метки для записи в jsonb колонку, пустой набор вместо nil
+func dbLabels(labels model.Labels) model.Labels {
+	if labels == nil {
+		return model.Labels{}
+	}
+	return labels
+}
+
+// ApplyRetention
+// Переносит устаревшие точки истории на следующий уровень хранения с агрегацией
+// (среднее для gauge, последнее накопленное значение для counter)
+// и удаляет точки последнего уровня старше его срока хранения
+// Шаг агрегации точки хранится в колонке resolution в секундах, 0 - исходные значения
+func (s *PostgresStorage) ApplyRetention(rules []RetentionRule, now time.Time) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	tx, err := s.conn.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range []struct {
+		table string
+		agg   string
+	}{
+		{table: "metrics.metrics_gauge_history", agg: "avg(value)"},
+		{table: "metrics.metrics_counter_history", agg: "max(value)"},
+	} {
+		if err := applyTableRetention(ctx, tx, t.table, t.agg, rules, now); err != nil {
+			_ = tx.Rollback(ctx)
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func applyTableRetention(ctx context.Context, tx pgx.Tx, table, agg string, rules []RetentionRule, now time.Time) error {
+	rollupQuery := `INSERT INTO ` + table + ` (name, labels, value, created_at, resolution)
+		SELECT name, labels, ` + agg + `, to_timestamp(floor(extract(epoch FROM created_at) / $2::INTEGER) * $2::INTEGER) AS bucket, $2::INTEGER
+		FROM ` + table + ` WHERE resolution = $1 AND created_at < $3
+		GROUP BY name, labels, bucket`
+	deleteQuery := `DELETE FROM ` + table + ` WHERE resolution = $1 AND created_at < $2`
+
+	if rules[0].Resolution != 0 {
+		// исходные значения сразу агрегируются в первый уровень по завершенным интервалам
+		cutoff := now.Truncate(rules[0].Resolution)
+		if err := rollup(ctx, tx, rollupQuery, deleteQuery, 0, rules[0].Resolution, cutoff); err != nil {
+			return err
+		}
+	}
+
+	for i, rule := range rules {
+		cutoff := retentionCutoff(rules, i, now)
+		if i+1 < len(rules) {
+			if err := rollup(ctx, tx, rollupQuery, deleteQuery, rule.Resolution, rules[i+1].Resolution, cutoff); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := tx.Exec(ctx, deleteQuery, int64(rule.Resolution.Seconds()), cutoff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rollup(ctx context.Context, tx pgx.Tx, rollupQuery, deleteQuery string, from, to time.Duration, cutoff time.Time) error {
+	if _, err := tx.Exec(ctx, rollupQuery, int64(from.Seconds()), int64(to.Seconds()), cutoff); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, deleteQuery, int64(from.Seconds()), cutoff)
+	return err
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// RetentionRule
+// Правило хранения истории значений
+// resolution: шаг агрегации точек, 0 - исходные значения
+// retention: сколько хранить точки с этим шагом
+type RetentionRule struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// Retainer
+// Интерфейс хранилища, поддерживающего прореживание и удаление истории
+type Retainer interface {
+	ApplyRetention(rules []RetentionRule, now time.Time) error
+}
+
+// ParseRetentionRules
+// Разбирает правила хранения в формате resolution:retention через запятую,
+// например raw:24h,1m:720h,1h:8760h
+// Шаг агрегации должен возрастать от правила к правилу, raw допускается только первым
+func ParseRetentionRules(raw string) ([]RetentionRule, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	parts := strings.Split(raw, ",")
+	rules := make([]RetentionRule, 0, len(parts))
+	for i, part := range parts {
+		resolutionRaw, retentionRaw, ok := strings.Cut(strings.TrimSpace(part), ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid retention rule %q, expected resolution:retention", part)
+		}
+
+		var rule RetentionRule
+		if resolutionRaw != "raw" {
+			resolution, err := time.ParseDuration(resolutionRaw)
+			if err != nil {
+				return nil, fmt.Errorf("invalid resolution in rule %q: %w", part, err)
+			}
+			if resolution <= 0 {
+				return nil, fmt.Errorf("resolution must be positive in rule %q", part)
+			}
+			rule.Resolution = resolution
+		}
+		retention, err := time.ParseDuration(retentionRaw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retention in rule %q: %w", part, err)
+		}
+		if retention <= 0 {
+			return nil, fmt.Errorf("retention must be positive in rule %q", part)
+		}
+		rule.Retention = retention
+
+		if i > 0 && rule.Resolution <= rules[i-1].Resolution {
+			return nil, fmt.Errorf("resolution must increase, rule %q", part)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// retentionCutoff
+// Возвращает границу, старше которой точки правила i переносятся на следующий уровень или удаляются
+// Граница выравнивается по шагу следующего уровня, чтобы агрегировались только полные интервалы
+func retentionCutoff(rules []RetentionRule, i int, now time.Time) time.Time {
+	cutoff := now.Add(-rules[i].Retention)
+	if i+1 < len(rules) {
+		cutoff = cutoff.Truncate(rules[i+1].Resolution)
+	}
+	return cutoff
+}
+
+// aggregate
+// Группирует точки по интервалам resolution и сворачивает значения каждого интервала функцией fn
+// Время агрегированной точки - начало интервала
+func aggregate(points []model.Point, resolution time.Duration, fn func([]float64) float64) []model.Point {
+	result := make([]model.Point, 0)
+	var values []float64
+	var bucket time.Time
+	for i, p := range points {
+		b := p.Timestamp.Truncate(resolution)
+		if i > 0 && !b.Equal(bucket) {
+			result = append(result, model.Point{Timestamp: bucket, Value: fn(values)})
+			values = values[:0]
+		}
+		bucket = b
+		values = append(values, p.Value)
+	}
+	if len(values) > 0 {
+		result = append(result, model.Point{Timestamp: bucket, Value: fn(values)})
+	}
+	return result
+}
+
+// avg
+// Среднее значение, используется для gauge
+func avg(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// maxValue
+// Максимальное значение, используется для накопленных значений counter
+func maxValue(values []float64) float64 {
+	m := math.Inf(-1)
+	for _, v := range values {
+		m = math.Max(m, v)
+	}
+	return m
+}
+
+// ApplyRetention
+// Переносит устаревшие точки истории на следующий уровень хранения с агрегацией
+// (среднее для gauge, последнее накопленное значение для counter)
+// и удаляет точки последнего уровня старше его срока хранения
+// После первого применения правил буферы исходных точек расширяются вместо перезаписи старых точек,
+// чтобы точки не терялись до переноса на следующий уровень
+func (s *MemStorage) ApplyRetention(rules []RetentionRule, now time.Time) error {
+	if len(rules) == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.growHistory = true
+	for _, h := range s.gaugeHistory {
+		h.raw.grow = true
+		h.applyRetention(rules, now, avg)
+	}
+	for _, h := range s.counterHistory {
+		h.raw.grow = true
+		h.applyRetention(rules, now, maxValue)
+	}
+	return nil
+}
+
+// applyRetention
+// Уровень 0 - исходные точки, если первое правило raw, иначе исходные точки сразу агрегируются в первое правило
+func (h *history) applyRetention(rules []RetentionRule, now time.Time, fn func([]float64) float64) {
+	tiers := len(rules)
+	if rules[0].Resolution == 0 {
+		tiers--
+	}
+	for len(h.tiers) < tiers {
+		h.tiers = append(h.tiers, nil)
+	}
+
+	first := 0
+	if rules[0].Resolution == 0 {
+		dropped := h.raw.dropBefore(retentionCutoff(rules, 0, now))
+		if len(rules) > 1 {
+			h.tiers[0] = append(h.tiers[0], aggregate(dropped, rules[1].Resolution, fn)...)
+		}
+		first = 1
+	} else {
+		dropped := h.raw.dropBefore(now.Truncate(rules[0].Resolution))
+		h.tiers[0] = append(h.tiers[0], aggregate(dropped, rules[0].Resolution, fn)...)
+	}
+
+	for i := first; i < len(rules); i++ {
+		tier := i - first
+		cutoff := retentionCutoff(rules, i, now)
+		n := 0
+		for n < len(h.tiers[tier]) && h.tiers[tier][n].Timestamp.Before(cutoff) {
+			n++
+		}
+		if n == 0 {
+			continue
+		}
+		if tier+1 < len(h.tiers) {
+			h.tiers[tier+1] = append(h.tiers[tier+1], aggregate(h.tiers[tier][:n], rules[i+1].Resolution, fn)...)
+		}
+		h.tiers[tier] = append([]model.Point(nil), h.tiers[tier][n:]...)
+	}
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+func TestParseRetentionRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    []RetentionRule
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			raw:  "",
+			want: nil,
+		},
+		{
+			name: "raw and rollups",
+			raw:  "raw:24h, 1m:720h,1h:8760h",
+			want: []RetentionRule{
+				{Resolution: 0, Retention: 24 * time.Hour},
+				{Resolution: time.Minute, Retention: 720 * time.Hour},
+				{Resolution: time.Hour, Retention: 8760 * time.Hour},
+			},
+		},
+		{
+			name: "without raw",
+			raw:  "1m:1h",
+			want: []RetentionRule{{Resolution: time.Minute, Retention: time.Hour}},
+		},
+		{
+			name:    "missing retention",
+			raw:     "raw",
+			wantErr: true,
+		},
+		{
+			name:    "invalid resolution",
+			raw:     "raw:1h,abc:2h",
+			wantErr: true,
+		},
+		{
+			name:    "invalid retention",
+			raw:     "1m:-1h",
+			wantErr: true,
+		},
+		{
+			name:    "raw not first",
+			raw:     "1m:1h,raw:24h",
+			wantErr: true,
+		},
+		{
+			name:    "resolution not increasing",
+			raw:     "1h:24h,1m:720h",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRetentionRules(tt.raw)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMemStorage_ApplyRetention(t *testing.T) {
+	s := NewMemStorage()
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rules := []RetentionRule{
+		{Resolution: 0, Retention: 10 * time.Minute},
+		{Resolution: time.Minute, Retention: time.Hour},
+	}
+
+	points := []model.Point{
+		{Timestamp: now.Add(-30 * time.Minute), Value: 1},
+		{Timestamp: now.Add(-30*time.Minute + 20*time.Second), Value: 3},
+		{Timestamp: now.Add(-5 * time.Minute), Value: 4},
+	}
+	for _, p := range points {
+		s.record(s.gaugeHistory, "gauge", p)
+		s.record(s.counterHistory, "counter", p)
+	}
+
+	assert.NoError(t, s.ApplyRetention(rules, now))
+
+	got, err := s.GetSeries(model.MetricTypeGauge, "gauge", nil, now.Add(-time.Hour), now)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Point{
+		{Timestamp: now.Add(-30 * time.Minute), Value: 2},
+		{Timestamp: now.Add(-5 * time.Minute), Value: 4},
+	}, got)
+
+	got, err = s.GetSeries(model.MetricTypeCounter, "counter", nil, now.Add(-time.Hour), now)
+	assert.NoError(t, err)
+	assert.Equal(t, []model.Point{
+		{Timestamp: now.Add(-30 * time.Minute), Value: 3},
+		{Timestamp: now.Add(-5 * time.Minute), Value: 4},
+	}, got)
+
+	later := now.Add(2 * time.Hour)
+	assert.NoError(t, s.ApplyRetention(rules, later))
+
+	got, err = s.GetSeries(model.MetricTypeGauge, "gauge", nil, now.Add(-time.Hour), later)
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestMemStorage_ApplyRetention_GrowsRawHistory(t *testing.T) {
+	s := NewMemStorage()
+	s.historySize = 4
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	rules := []RetentionRule{
+		{Resolution: 0, Retention: time.Hour},
+		{Resolution: time.Minute, Retention: 24 * time.Hour},
+	}
+
+	// без правил хранения буфер ограничен historySize
+	for i := 0; i < 10; i++ {
+		s.record(s.gaugeHistory, "bounded", model.Point{Timestamp: now.Add(time.Duration(i-20) * time.Minute), Value: float64(i)})
+	}
+	got, err := s.GetSeries(model.MetricTypeGauge, "bounded", nil, now.Add(-time.Hour), now)
+	assert.NoError(t, err)
+	assert.Len(t, got, 4)
+
+	// после применения правил точки не перезаписываются до переноса на следующий уровень
+	assert.NoError(t, s.ApplyRetention(rules, now))
+	for i := 0; i < 12; i++ {
+		s.record(s.gaugeHistory, "gauge", model.Point{Timestamp: now.Add(time.Duration(i-63) * time.Minute), Value: float64(i)})
+	}
+	got, err = s.GetSeries(model.MetricTypeGauge, "gauge", nil, now.Add(-2*time.Hour), now)
+	assert.NoError(t, err)
+	assert.Len(t, got, 12)
+
+	// точки старше часа переносятся на уровень 1m, остальные остаются исходными
+	assert.NoError(t, s.ApplyRetention(rules, now))
+	got, err = s.GetSeries(model.MetricTypeGauge, "gauge", nil, now.Add(-2*time.Hour), now)
+	assert.NoError(t, err)
+	assert.Len(t, got, 12)
+	h := s.gaugeHistory["gauge"]
+	assert.Len(t, h.tiers[0], 3)
+	assert.Equal(t, 9, h.raw.size)
+	assert.Equal(t, 16, len(h.raw.points))
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/soltanat/metrics/internal"
 	"github.com/soltanat/metrics/internal/model"
 )
@@ -18,26 +20,42 @@ func NewBackoffPostgresStorage(s Storage) *BackoffPostgresStorage {
 func (s *BackoffPostgresStorage) Store(metric *model.Metric) error {
 	return internal.Backoff(func() error {
 		return s.storage.Store(metric)
-	})
+	}, model.ErrHistogramBucketsMismatch, model.ErrSummaryAccuracyMismatch)
 }
 
 func (s *BackoffPostgresStorage) StoreBatch(metrics []model.Metric) error {
 	return internal.Backoff(func() error {
 		return s.storage.StoreBatch(metrics)
-	})
+	}, model.ErrHistogramBucketsMismatch, model.ErrSummaryAccuracyMismatch)
+}
+
+func (s *BackoffPostgresStorage) GetGauge(name string, labels model.Labels) (metric *model.Metric, err error) {
+	err = internal.Backoff(func() error {
+		metric, err = s.storage.GetGauge(name, labels)
+		return err
+	}, model.ErrMetricNotFound)
+	return
+}
+
+func (s *BackoffPostgresStorage) GetCounter(name string, labels model.Labels) (metric *model.Metric, err error) {
+	err = internal.Backoff(func() error {
+		metric, err = s.storage.GetCounter(name, labels)
+		return err
+	}, model.ErrMetricNotFound)
+	return
 }
 
-func (s *BackoffPostgresStorage) GetGauge(name string) (metric *model.Metric, err error) {
+func (s *BackoffPostgresStorage) GetHistogram(name string, labels model.Labels) (metric *model.Metric, err error) {
 	err = internal.Backoff(func() error {
-		metric, err = s.storage.GetGauge(name)
+		metric, err = s.storage.GetHistogram(name, labels)
 		return err
 	}, model.ErrMetricNotFound)
 	return
 }
 
-func (s *BackoffPostgresStorage) GetCounter(name string) (metric *model.Metric, err error) {
+func (s *BackoffPostgresStorage) GetSummary(name string, labels model.Labels) (metric *model.Metric, err error) {
 	err = internal.Backoff(func() error {
-		metric, err = s.storage.GetCounter(name)
+		metric, err = s.storage.GetSummary(name, labels)
 		return err
 	}, model.ErrMetricNotFound)
 	return
@@ -50,3 +68,13 @@ func (s *BackoffPostgresStorage) GetList() (metrics []model.Metric, err error) {
 	})
 	return
 }
+
+func (s *BackoffPostgresStorage) GetSeries(
+	metricType model.MetricType, name string, labels model.Labels, from, to time.Time,
+) (points []model.Point, err error) {
+	err = internal.Backoff(func() error {
+		points, err = s.storage.GetSeries(metricType, name, labels, from, to)
+		return err
+	}, model.ErrInvalidMetricType)
+	return
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/soltanat/metrics/internal/model"
+)
+
+// ring
+// Кольцевой буфер точек серии
+// При переполнении перезаписываются самые старые точки, если буфер не расширяемый (grow),
+// иначе размер буфера удваивается
+type ring struct {
+	points   []model.Point
+	start    int
+	size     int
+	capacity int
+	grow     bool
+}
+
+func newRing(capacity int) *ring {
+	return &ring{points: make([]model.Point, capacity), capacity: capacity}
+}
+
+// push
+// Добавляет точку в буфер
+func (r *ring) push(p model.Point) {
+	if len(r.points) == 0 {
+		return
+	}
+	if r.size == len(r.points) && r.grow {
+		r.resize(2 * len(r.points))
+	}
+	if r.size < len(r.points) {
+		r.points[(r.start+r.size)%len(r.points)] = p
+		r.size++
+		return
+	}
+	r.points[r.start] = p
+	r.start = (r.start + 1) % len(r.points)
+}
+
+// resize
+// Переносит точки в буфер размера capacity, capacity не меньше количества точек
+func (r *ring) resize(capacity int) {
+	points := make([]model.Point, capacity)
+	for i := 0; i < r.size; i++ {
+		points[i] = r.points[(r.start+i)%len(r.points)]
+	}
+	r.points = points
+	r.start = 0
+}
+
+// rangeOf
+// Возвращает точки в интервале [from, to] в порядке добавления
+func (r *ring) rangeOf(from, to time.Time) []model.Point {
+	points := make([]model.Point, 0)
+	for i := 0; i < r.size; i++ {
+		p := r.points[(r.start+i)%len(r.points)]
+		if p.Timestamp.Before(from) || p.Timestamp.After(to) {
+			continue
+		}
+		points = append(points, p)
+	}
+	return points
+}
+
+// dropBefore
+// Удаляет из буфера точки старше t и возвращает их
+// Точки добавляются в порядке времени, поэтому удаляются с начала буфера
+func (r *ring) dropBefore(t time.Time) []model.Point {
+	dropped := make([]model.Point, 0)
+	for r.size > 0 {
+		p := r.points[r.start]
+		if !p.Timestamp.Before(t) {
+			break
+		}
+		dropped = append(dropped, p)
+		r.points[r.start] = model.Point{}
+		r.start = (r.start + 1) % len(r.points)
+		r.size--
+	}
+	// расширенный буфер уменьшается, когда заполнен меньше чем на четверть
+	if r.grow && len(r.points) > r.capacity && r.size < len(r.points)/4 {
+		r.resize(max(len(r.points)/2, r.capacity))
+	}
+	return dropped
+}
+
+// history
+// История значений серии
+// raw - последние принятые значения, tiers - агрегированные точки по уровням хранения
+type history struct {
+	raw   *ring
+	tiers [][]model.Point
+}
+
+func newHistory(capacity int) *history {
+	return &history{raw: newRing(capacity)}
+}
+
+// rangeOf
+// Возвращает точки всех уровней в интервале [from, to] в порядке времени
+func (h *history) rangeOf(from, to time.Time) []model.Point {
+	points := make([]model.Point, 0)
+	for i := len(h.tiers) - 1; i >= 0; i-- {
+		for _, p := range h.tiers[i] {
+			if p.Timestamp.Before(from) || p.Timestamp.After(to) {
+				continue
+			}
+			points = append(points, p)
+		}
+	}
+	return append(points, h.raw.rangeOf(from, to)...)
+}
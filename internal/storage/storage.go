@@ -1,15 +1,65 @@
 package storage
 
 import (
+	"errors"
+	"time"
+
 	"github.com/soltanat/metrics/internal/model"
 )
 
 // Storage
 // Интерфейс хранилища метрик
+// Метрика идентифицируется именем и набором меток
 type Storage interface {
 	Store(metric *model.Metric) error
 	StoreBatch(metrics []model.Metric) error
-	GetGauge(name string) (*model.Metric, error)
-	GetCounter(name string) (*model.Metric, error)
+	GetGauge(name string, labels model.Labels) (*model.Metric, error)
+	GetCounter(name string, labels model.Labels) (*model.Metric, error)
+	GetHistogram(name string, labels model.Labels) (*model.Metric, error)
+	GetSummary(name string, labels model.Labels) (*model.Metric, error)
 	GetList() ([]model.Metric, error)
+	GetSeries(metricType model.MetricType, name string, labels model.Labels, from, to time.Time) ([]model.Point, error)
+}
+
+// Get
+// Возвращает метрику типа metricType с именем name и метками labels
+// Если метки не заданы и метрики без меток нет, возвращает единственную серию с таким именем и типом,
+// например метрику агента с метками host и agent_id, а для нескольких серий - model.ErrAmbiguousMetric
+func Get(s Storage, metricType model.MetricType, name string, labels model.Labels) (*model.Metric, error) {
+	var metric *model.Metric
+	var err error
+	switch metricType {
+	case model.MetricTypeGauge:
+		metric, err = s.GetGauge(name, labels)
+	case model.MetricTypeCounter:
+		metric, err = s.GetCounter(name, labels)
+	case model.MetricTypeHistogram:
+		metric, err = s.GetHistogram(name, labels)
+	case model.MetricTypeSummary:
+		metric, err = s.GetSummary(name, labels)
+	default:
+		return nil, model.ErrMetricNotFound
+	}
+	if !errors.Is(err, model.ErrMetricNotFound) || len(labels) > 0 {
+		return metric, err
+	}
+
+	metrics, err := s.GetList()
+	if err != nil {
+		return nil, err
+	}
+	var found *model.Metric
+	for i := range metrics {
+		if metrics[i].Type != metricType || metrics[i].Name != name {
+			continue
+		}
+		if found != nil {
+			return nil, model.ErrAmbiguousMetric
+		}
+		found = &metrics[i]
+	}
+	if found == nil {
+		return nil, model.ErrMetricNotFound
+	}
+	return found, nil
 }
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"time"
+
 	"github.com/stretchr/testify/mock"
 
 	"github.com/soltanat/metrics/internal/model"
@@ -20,9 +22,20 @@ func (m *MockStorage) StoreBatch(metric []model.Metric) error {
 	return args.Error(0)
 }
 
-func (m *MockStorage) GetGauge(name string) (*model.Metric, error) {
-	args := m.Called(name)
+func (m *MockStorage) GetGauge(name string, labels model.Labels) (*model.Metric, error) {
+	args := m.Called(name, labels)
+
+	var r0 *model.Metric
+	if args.Get(0) == nil {
+		r0 = nil
+	} else {
+		r0 = args.Get(0).(*model.Metric)
+	}
+	return r0, args.Error(1)
+}
 
+func (m *MockStorage) GetCounter(name string, labels model.Labels) (*model.Metric, error) {
+	args := m.Called(name, labels)
 	var r0 *model.Metric
 	if args.Get(0) == nil {
 		r0 = nil
@@ -32,8 +45,19 @@ func (m *MockStorage) GetGauge(name string) (*model.Metric, error) {
 	return r0, args.Error(1)
 }
 
-func (m *MockStorage) GetCounter(name string) (*model.Metric, error) {
-	args := m.Called(name)
+func (m *MockStorage) GetHistogram(name string, labels model.Labels) (*model.Metric, error) {
+	args := m.Called(name, labels)
+	var r0 *model.Metric
+	if args.Get(0) == nil {
+		r0 = nil
+	} else {
+		r0 = args.Get(0).(*model.Metric)
+	}
+	return r0, args.Error(1)
+}
+
+func (m *MockStorage) GetSummary(name string, labels model.Labels) (*model.Metric, error) {
+	args := m.Called(name, labels)
 	var r0 *model.Metric
 	if args.Get(0) == nil {
 		r0 = nil
@@ -47,3 +71,14 @@ func (m *MockStorage) GetList() ([]model.Metric, error) {
 	args := m.Called()
 	return args.Get(0).([]model.Metric), args.Error(1)
 }
+
+func (m *MockStorage) GetSeries(
+	metricType model.MetricType, name string, labels model.Labels, from, to time.Time,
+) ([]model.Point, error) {
+	args := m.Called(metricType, name, labels, from, to)
+	var r0 []model.Point
+	if args.Get(0) != nil {
+		r0 = args.Get(0).([]model.Point)
+	}
+	return r0, args.Error(1)
+}
@@ -0,0 +1,113 @@
+// Package tlsconfig
+// Настройка TLS и взаимного TLS сервера и агента, выпуск тестовых сертификатов
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrInvalidConfig
+// Ошибка настройки TLS
+var ErrInvalidConfig = errors.New("invalid tls config")
+
+// ParseClientAuth
+// Разбирает режим проверки сертификата клиента:
+// none - не запрашивается, optional - проверяется, если передан, require - обязателен
+func ParseClientAuth(raw string) (tls.ClientAuthType, error) {
+	switch strings.TrimSpace(raw) {
+	case "", "none":
+		return tls.NoClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("%w: unknown client auth %q, expected none, optional or require", ErrInvalidConfig, raw)
+	}
+}
+
+// Server
+// Создает конфигурацию TLS сервера с сертификатом certFile и ключом keyFile
+// clientCAFile - сертификат CA, которым проверяются сертификаты клиентов, обязателен при clientAuth отличном от none
+func Server(certFile, keyFile, clientCAFile string, clientAuth tls.ClientAuthType) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load server certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   clientAuth,
+	}
+	if clientAuth != tls.NoClientCert {
+		if clientCAFile == "" {
+			return nil, fmt.Errorf("%w: client CA is required for client certificate verification", ErrInvalidConfig)
+		}
+		cfg.ClientCAs, err = loadPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// Client
+// Создает конфигурацию TLS клиента
+// caFile - сертификат CA сервера, если пустой - используются системные сертификаты
+// certFile, keyFile - сертификат и ключ клиента для взаимного TLS, необязательные
+// serverName - имя сервера для проверки сертификата, если отличается от адреса
+func Client(caFile, certFile, keyFile, serverName string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: serverName}
+	if caFile != "" {
+		pool, err := loadPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("%w: client certificate and key must be set together", ErrInvalidConfig)
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Identity
+// Возвращает имя клиента из проверенного сертификата соединения: Common Name, а если он пустой - первое DNS имя
+// Возвращает false, если клиент не передал сертификат или сертификат не проверен
+func Identity(state *tls.ConnectionState) (string, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	leaf := state.VerifiedChains[0][0]
+	if leaf.Subject.CommonName != "" {
+		return leaf.Subject.CommonName, true
+	}
+	if len(leaf.DNSNames) > 0 {
+		return leaf.DNSNames[0], true
+	}
+	return "", false
+}
+
+func loadPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%w: no certificates in %s", ErrInvalidConfig, file)
+	}
+	return pool, nil
+}
@@ -0,0 +1,116 @@
+package tlsconfig
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
+)
+
+// Usage
+// Назначение выпускаемого сертификата
+type Usage int
+
+const (
+	// UsageServer сертификат сервера
+	UsageServer Usage = iota
+	// UsageClient сертификат клиента для взаимного TLS
+	UsageClient
+)
+
+// Certificate
+// Выпущенный сертификат и его ключ
+type Certificate struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// CertPEM
+// Возвращает сертификат в PEM
+func (c *Certificate) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Cert.Raw})
+}
+
+// KeyPEM
+// Возвращает ключ в PEM (PKCS8)
+func (c *Certificate) KeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(c.Key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// NewCA
+// Выпускает самоподписанный сертификат локального CA для тестовых установок
+func NewCA(commonName string, validFor time.Duration) (*Certificate, error) {
+	tmpl := &x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	return issue(tmpl, nil, validFor)
+}
+
+// Issue
+// Выпускает сертификат, подписанный ca
+// hosts - DNS имена и IP адреса сертификата сервера, для сертификата клиента необязательны
+func (ca *Certificate) Issue(commonName string, hosts []string, usage Usage, validFor time.Duration) (*Certificate, error) {
+	tmpl := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: commonName},
+		KeyUsage: x509.KeyUsageDigitalSignature,
+	}
+	switch usage {
+	case UsageServer:
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	case UsageClient:
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	return issue(tmpl, ca, validFor)
+}
+
+// issue
+// Создает ключ ECDSA P-256 и подписывает сертификат ключом parent, при parent == nil сертификат самоподписанный
+func issue(tmpl *x509.Certificate, parent *Certificate, validFor time.Duration) (*Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl.SerialNumber = serial
+	tmpl.NotBefore = now.Add(-time.Minute)
+	tmpl.NotAfter = now.Add(validFor)
+
+	parentCert, signer := tmpl, crypto.Signer(key)
+	if parent != nil {
+		parentCert, signer = parent.Cert, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, key.Public(), signer)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &Certificate{Cert: cert, Key: key}, nil
+}
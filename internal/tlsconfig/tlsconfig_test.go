@@ -0,0 +1,130 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePair
+// Записывает сертификат и ключ в каталог dir и возвращает пути к файлам
+func writePair(t *testing.T, dir, name string, c *Certificate) (string, string) {
+	keyPEM, err := c.KeyPEM()
+	require.NoError(t, err)
+	certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+	require.NoError(t, os.WriteFile(certFile, c.CertPEM(), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPEM, 0o600))
+	return certFile, keyFile
+}
+
+func TestParseClientAuth(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    tls.ClientAuthType
+		wantErr bool
+	}{
+		{raw: "", want: tls.NoClientCert},
+		{raw: "none", want: tls.NoClientCert},
+		{raw: "optional", want: tls.VerifyClientCertIfGiven},
+		{raw: "require", want: tls.RequireAndVerifyClientCert},
+		{raw: "always", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := ParseClientAuth(tt.raw)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidConfig)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := NewCA("test CA", time.Hour)
+	require.NoError(t, err)
+	server, err := ca.Issue("server", []string{"localhost", "127.0.0.1"}, UsageServer, time.Hour)
+	require.NoError(t, err)
+	agent, err := ca.Issue("agent-1", nil, UsageClient, time.Hour)
+	require.NoError(t, err)
+	otherCA, err := NewCA("other CA", time.Hour)
+	require.NoError(t, err)
+	stranger, err := otherCA.Issue("agent-2", nil, UsageClient, time.Hour)
+	require.NoError(t, err)
+
+	caFile, _ := writePair(t, dir, "ca", ca)
+	otherCAFile, _ := writePair(t, dir, "other-ca", otherCA)
+	serverCert, serverKey := writePair(t, dir, "server", server)
+	agentCert, agentKey := writePair(t, dir, "agent", agent)
+	strangerCert, strangerKey := writePair(t, dir, "stranger", stranger)
+
+	serverConfig, err := Server(serverCert, serverKey, caFile, tls.VerifyClientCertIfGiven)
+	require.NoError(t, err)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := Identity(r.TLS)
+		_, _ = w.Write([]byte(identity))
+	}))
+	srv.TLS = serverConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		ca           string
+		cert, key    string
+		wantIdentity string
+		wantErr      bool
+	}{
+		{name: "client certificate", ca: caFile, cert: agentCert, key: agentKey, wantIdentity: "agent-1"},
+		{name: "without client certificate", ca: caFile, wantIdentity: ""},
+		// клиент не передает сертификат, не выпущенный принимаемым сервером CA
+		{name: "certificate of other CA", ca: caFile, cert: strangerCert, key: strangerKey, wantIdentity: ""},
+		{name: "unknown server CA", ca: otherCAFile, cert: agentCert, key: agentKey, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Client(tt.ca, tt.cert, tt.key, "")
+			require.NoError(t, err)
+			c := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+
+			resp, err := c.Get(srv.URL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantIdentity, string(body))
+		})
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := NewCA("test CA", time.Hour)
+	require.NoError(t, err)
+	server, err := ca.Issue("server", []string{"localhost"}, UsageServer, time.Hour)
+	require.NoError(t, err)
+	serverCert, serverKey := writePair(t, dir, "server", server)
+
+	_, err = Server(serverCert, serverKey, "", tls.RequireAndVerifyClientCert)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = Server(serverCert, serverKey, serverKey, tls.RequireAndVerifyClientCert)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+	_, err = Client("", serverCert, "", "")
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
@@ -0,0 +1,11 @@
+DROP INDEX metrics.metrics_counter_name_labels_idx;
+DROP INDEX metrics.metrics_gauge_name_labels_idx;
+
+DELETE FROM metrics.metrics_counter WHERE labels <> '{}'::jsonb;
+DELETE FROM metrics.metrics_gauge WHERE labels <> '{}'::jsonb;
+
+CREATE UNIQUE INDEX metrics_counter_name_idx ON metrics.metrics_counter (name);
+CREATE UNIQUE INDEX metrics_gauge_name_idx ON metrics.metrics_gauge (name);
+
+ALTER TABLE metrics.metrics_counter DROP COLUMN labels;
+ALTER TABLE metrics.metrics_gauge DROP COLUMN labels;
\ No newline at end of file
@@ -0,0 +1,8 @@
+ALTER TABLE metrics.metrics_counter ADD COLUMN labels JSONB NOT NULL DEFAULT '{}'::jsonb;
+ALTER TABLE metrics.metrics_gauge ADD COLUMN labels JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+DROP INDEX metrics.metrics_counter_name_idx;
+DROP INDEX metrics.metrics_gauge_name_idx;
+
+CREATE UNIQUE INDEX metrics_counter_name_labels_idx ON metrics.metrics_counter (name, labels);
+CREATE UNIQUE INDEX metrics_gauge_name_labels_idx ON metrics.metrics_gauge (name, labels);
@@ -0,0 +1,2 @@
+DROP TABLE metrics.metrics_counter_history;
+DROP TABLE metrics.metrics_gauge_history;
\ No newline at end of file
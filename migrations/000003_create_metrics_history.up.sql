@@ -0,0 +1,20 @@
+CREATE TABLE metrics.metrics_counter_history
+(
+    id         BIGSERIAL PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    labels     JSONB        NOT NULL DEFAULT '{}'::jsonb,
+    value      BIGINT       NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT current_timestamp
+);
+
+CREATE TABLE metrics.metrics_gauge_history
+(
+    id         BIGSERIAL PRIMARY KEY,
+    name       VARCHAR(255)     NOT NULL,
+    labels     JSONB            NOT NULL DEFAULT '{}'::jsonb,
+    value      DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT current_timestamp
+);
+
+CREATE INDEX metrics_counter_history_series_idx ON metrics.metrics_counter_history (name, labels, created_at);
+CREATE INDEX metrics_gauge_history_series_idx ON metrics.metrics_gauge_history (name, labels, created_at);
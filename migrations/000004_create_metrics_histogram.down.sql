@@ -0,0 +1 @@
+DROP TABLE metrics.metrics_histogram;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE metrics.metrics_histogram
+(
+    id         SERIAL PRIMARY KEY,
+    name       VARCHAR(255)       NOT NULL,
+    labels     JSONB              NOT NULL DEFAULT '{}'::jsonb,
+    buckets    DOUBLE PRECISION[] NOT NULL,
+    counts     BIGINT[]           NOT NULL,
+    sum        DOUBLE PRECISION   NOT NULL,
+    count      BIGINT             NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
+
+CREATE UNIQUE INDEX metrics_histogram_name_labels_idx ON metrics.metrics_histogram (name, labels);
@@ -0,0 +1 @@
+DROP TABLE metrics.metrics_summary;
\ No newline at end of file
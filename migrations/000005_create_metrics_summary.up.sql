@@ -0,0 +1,10 @@
+CREATE TABLE metrics.metrics_summary
+(
+    id         SERIAL PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    labels     JSONB        NOT NULL DEFAULT '{}'::jsonb,
+    sketch     JSONB        NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT current_timestamp
+);
+
+CREATE UNIQUE INDEX metrics_summary_name_labels_idx ON metrics.metrics_summary (name, labels);
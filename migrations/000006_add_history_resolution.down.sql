@@ -0,0 +1,5 @@
+DROP INDEX metrics.metrics_counter_history_resolution_idx;
+DROP INDEX metrics.metrics_gauge_history_resolution_idx;
+
+ALTER TABLE metrics.metrics_counter_history DROP COLUMN resolution;
+ALTER TABLE metrics.metrics_gauge_history DROP COLUMN resolution;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE metrics.metrics_counter_history ADD COLUMN resolution INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE metrics.metrics_gauge_history ADD COLUMN resolution INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX metrics_counter_history_resolution_idx ON metrics.metrics_counter_history (resolution, created_at);
+CREATE INDEX metrics_gauge_history_resolution_idx ON metrics.metrics_gauge_history (resolution, created_at);
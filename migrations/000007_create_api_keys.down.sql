@@ -0,0 +1 @@
+DROP TABLE metrics.api_keys;
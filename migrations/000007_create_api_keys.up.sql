@@ -0,0 +1,8 @@
+CREATE TABLE metrics.api_keys
+(
+    name       VARCHAR(255) PRIMARY KEY,
+    token_hash CHAR(64)     NOT NULL UNIQUE,
+    scopes     TEXT[]       NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT current_timestamp,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);